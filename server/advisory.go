@@ -0,0 +1,357 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ije/gox/log"
+	"github.com/ije/gox/utils"
+)
+
+// advisoryDBUpdatedFile is the file that is written by the `esmd advisories` command after
+// the advisory database is updated, the server reloads the database when the file is changed.
+const advisoryDBUpdatedFile = ".updated"
+
+// Advisory is the security advisory of a package version.
+type Advisory struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	// "critical", "high", "moderate", "low" or "unknown"
+	Severity string `json:"severity"`
+}
+
+// advisoryDB is the advisory database that is loaded from the OSV files, indexed by the package name.
+type advisoryDB struct {
+	packages  map[string][]*osvAdvisory
+	updatedAt time.Time
+}
+
+// osvAdvisory is the advisory in the OSV format, see https://ossf.github.io/osv-schema/
+type osvAdvisory struct {
+	ID               string        `json:"id"`
+	Summary          string        `json:"summary"`
+	Withdrawn        string        `json:"withdrawn"`
+	Affected         []osvAffected `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []struct {
+		Type   string          `json:"type"`
+		Events []osvRangeEvent `json:"events"`
+	} `json:"ranges"`
+	Versions []string `json:"versions"`
+}
+
+type osvRangeEvent struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+}
+
+var advisories atomic.Pointer[advisoryDB]
+
+// getAdvisoryDir returns the directory of the advisory database.
+func getAdvisoryDir() string {
+	if config.Advisories.Dir != "" {
+		return config.Advisories.Dir
+	}
+	return path.Join(config.WorkDir, "advisories")
+}
+
+// loadAdvisoryDB loads the npm advisories of the OSV files in the directory.
+func loadAdvisoryDB(dir string) (*advisoryDB, error) {
+	files, err := findFiles(dir, "", func(filename string) bool {
+		return strings.HasSuffix(filename, ".json")
+	})
+	if err != nil {
+		return nil, err
+	}
+	db := &advisoryDB{packages: map[string][]*osvAdvisory{}}
+	for _, filename := range files {
+		data, err := os.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		var advisory osvAdvisory
+		if json.Unmarshal(data, &advisory) != nil || advisory.ID == "" || advisory.Withdrawn != "" {
+			continue
+		}
+		names := map[string]bool{}
+		for _, affected := range advisory.Affected {
+			if name := affected.Package.Name; affected.Package.Ecosystem == "npm" && name != "" && !names[name] {
+				names[name] = true
+				db.packages[name] = append(db.packages[name], &advisory)
+			}
+		}
+	}
+	if fi, err := os.Stat(path.Join(dir, advisoryDBUpdatedFile)); err == nil {
+		db.updatedAt = fi.ModTime()
+	}
+	return db, nil
+}
+
+// startAdvisoryDB loads the advisory database and reloads it when it's updated by the `esmd advisories` command.
+func startAdvisoryDB(logger *log.Logger) {
+	dir := getAdvisoryDir()
+	for {
+		if fi, err := os.Stat(path.Join(dir, advisoryDBUpdatedFile)); err == nil {
+			if current := advisories.Load(); current == nil || !fi.ModTime().Equal(current.updatedAt) {
+				db, err := loadAdvisoryDB(dir)
+				if err != nil {
+					logger.Errorf("failed to load advisory database: %v", err)
+				} else {
+					advisories.Store(db)
+					logger.Infof("advisory database loaded, %d packages", len(db.packages))
+				}
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// getPackageAdvisories returns the advisories of the package version, the critical ones come first.
+func getPackageAdvisories(pkgName string, pkgVersion string) []Advisory {
+	db := advisories.Load()
+	if db == nil {
+		return nil
+	}
+	list, ok := db.packages[pkgName]
+	if !ok {
+		return nil
+	}
+	version, err := semver.NewVersion(pkgVersion)
+	if err != nil {
+		return nil
+	}
+	var ret []Advisory
+	for _, advisory := range list {
+		for _, affected := range advisory.Affected {
+			if affected.Package.Ecosystem == "npm" && affected.Package.Name == pkgName && affected.isAffected(pkgVersion, version) {
+				severity := strings.ToLower(advisory.DatabaseSpecific.Severity)
+				if severity == "" {
+					severity = "unknown"
+				}
+				ret = append(ret, Advisory{ID: advisory.ID, Summary: advisory.Summary, Severity: severity})
+				break
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return advisorySeverityLevel(ret[i].Severity) > advisorySeverityLevel(ret[j].Severity)
+	})
+	return ret
+}
+
+// isAffected checks the version with the `versions` list and the `ranges` of the affected package.
+func (affected *osvAffected) isAffected(rawVersion string, version *semver.Version) bool {
+	for _, v := range affected.Versions {
+		if v == rawVersion {
+			return true
+		}
+	}
+	for _, r := range affected.Ranges {
+		if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+			continue
+		}
+		// the events are sorted by the version
+		isAffected := false
+		for _, e := range r.Events {
+			if e.Introduced != "" {
+				if e.Introduced == "0" || compareSemver(version, e.Introduced) >= 0 {
+					isAffected = true
+				}
+			} else if e.Fixed != "" {
+				if compareSemver(version, e.Fixed) >= 0 {
+					isAffected = false
+				}
+			} else if e.LastAffected != "" {
+				if compareSemver(version, e.LastAffected) > 0 {
+					isAffected = false
+				}
+			}
+		}
+		if isAffected {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSemver compares the version with the raw version, the invalid raw version is treated as the greatest.
+func compareSemver(version *semver.Version, raw string) int {
+	v, err := semver.NewVersion(raw)
+	if err != nil {
+		return -1
+	}
+	return version.Compare(v)
+}
+
+func advisorySeverityLevel(severity string) int {
+	switch severity {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "moderate":
+		return 2
+	case "low":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// advisoryBlockedError is returned when a package is blocked by a critical advisory with the
+// `advisories.blockCritical` option, the router responds it with status 403.
+type advisoryBlockedError struct {
+	pkg      string
+	advisory *Advisory
+}
+
+func (e *advisoryBlockedError) Error() string {
+	return fmt.Sprintf("package '%s' is blocked by the critical advisory %s: %s", e.pkg, e.advisory.ID, e.advisory.Summary)
+}
+
+// isAdvisoryBlockedError returns true if the error is an `advisoryBlockedError`.
+func isAdvisoryBlockedError(err error) bool {
+	_, ok := err.(*advisoryBlockedError)
+	return ok
+}
+
+// getCriticalAdvisory returns the first critical advisory in the list.
+func getCriticalAdvisory(list []Advisory) *Advisory {
+	for i, a := range list {
+		if a.Severity == "critical" {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// formatAdvisoriesHeader formats the advisories as the value of the `X-ESM-Advisories` header,
+// e.g. "GHSA-xxxx-xxxx-xxxx; pkg=foo@1.0.0; severity=critical, ...".
+func formatAdvisoriesHeader(pkgAdvisories map[string][]Advisory) string {
+	pkgs := make([]string, 0, len(pkgAdvisories))
+	for pkg := range pkgAdvisories {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	var values []string
+	for _, pkg := range pkgs {
+		for _, a := range pkgAdvisories[pkg] {
+			values = append(values, a.ID+"; pkg="+pkg+"; severity="+a.Severity)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// checkAdvisories sets the `X-ESM-Advisories` header, and returns an error if a critical advisory is
+// found with the `advisories.blockCritical` option.
+func checkAdvisories(header http.Header, pkgAdvisories map[string][]Advisory) error {
+	if len(pkgAdvisories) == 0 {
+		return nil
+	}
+	header.Set("X-ESM-Advisories", formatAdvisoriesHeader(pkgAdvisories))
+	if config.Advisories.BlockCritical {
+		pkgs := make([]string, 0, len(pkgAdvisories))
+		for pkg := range pkgAdvisories {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+		for _, pkg := range pkgs {
+			if a := getCriticalAdvisory(pkgAdvisories[pkg]); a != nil {
+				return &advisoryBlockedError{pkg: pkg, advisory: a}
+			}
+		}
+	}
+	return nil
+}
+
+// getBuildAdvisories returns the advisories of the packages in the build meta, see `BuildMeta.Packages`.
+func getBuildAdvisories(packages []string) map[string][]Advisory {
+	var ret map[string][]Advisory
+	for _, pkg := range packages {
+		if i := strings.LastIndexByte(pkg, '@'); i > 0 {
+			if list := getPackageAdvisories(pkg[:i], pkg[i+1:]); len(list) > 0 {
+				if ret == nil {
+					ret = map[string][]Advisory{}
+				}
+				ret[pkg] = list
+			}
+		}
+	}
+	return ret
+}
+
+// checkBundledAdvisories returns an `advisoryBlockedError` if a bundled package has a critical advisory.
+func checkBundledAdvisories(bundledPackages map[string]*BuildAnalysisPackage) error {
+	names := make([]string, 0, len(bundledPackages))
+	for name := range bundledPackages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if version := bundledPackages[name].Version; version != "" {
+			if a := getCriticalAdvisory(getPackageAdvisories(name, version)); a != nil {
+				return &advisoryBlockedError{pkg: name + "@" + version, advisory: a}
+			}
+		}
+	}
+	return nil
+}
+
+// reportInstalledAdvisories adds the advisories of the installed packages that are not bundled to the
+// `X-ESM-Advisories` header, they are reported but not blocked, see `BuildMeta.Installed`.
+func reportInstalledAdvisories(header http.Header, pkgAdvisories map[string][]Advisory, installed []string) {
+	n := len(pkgAdvisories)
+	for pkg, list := range getBuildAdvisories(installed) {
+		if _, ok := pkgAdvisories[pkg]; !ok {
+			pkgAdvisories[pkg] = list
+		}
+	}
+	if len(pkgAdvisories) > n {
+		header.Set("X-ESM-Advisories", formatAdvisoriesHeader(pkgAdvisories))
+	}
+}
+
+// writeAdvisoryWarnings writes the `console.warn` statements of the advisories of the package, the bundled
+// packages and the installed dependencies.
+func (ctx *BuildContext) writeAdvisoryWarnings(w io.Writer, bundledPackages map[string]*BuildAnalysisPackage) {
+	packages := map[string]string{ctx.pkgJson.Name: ctx.pkgJson.Version}
+	for name, pkg := range bundledPackages {
+		if pkg.Version != "" {
+			packages[name] = pkg.Version
+		}
+	}
+	for _, p := range ctx.installedDeps {
+		if _, ok := packages[p.Name]; !ok {
+			packages[p.Name] = p.Version
+		}
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, a := range getPackageAdvisories(name, packages[name]) {
+			fmt.Fprintf(w, `console.warn("%%c[esm.sh]%%c %%cvulnerable%%c %s@%s: " + %s, "color:grey", "", "color:red", "");%s`, name, packages[name], utils.MustEncodeJSON(a.ID+" ("+a.Severity+") "+a.Summary), "\n")
+		}
+	}
+}
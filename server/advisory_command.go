@@ -0,0 +1,125 @@
+package server
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// osvNpmAdvisoriesUrl is the zip archive of all the npm advisories in the OSV database.
+const osvNpmAdvisoriesUrl = "https://osv-vulnerabilities.storage.googleapis.com/npm/all.zip"
+
+// UpdateAdvisories implements the `esmd advisories` command, it downloads the npm advisories of the OSV
+// database to the advisory directory, the running server reloads the database automatically, e.g.
+//
+//	esmd advisories --dir ./advisories
+func UpdateAdvisories(args []string) {
+	var cfile string
+	var dir string
+	var source string
+	flags := flag.NewFlagSet("advisories", flag.ExitOnError)
+	flags.StringVar(&cfile, "config", "config.json", "the config file path")
+	flags.StringVar(&dir, "dir", "", "the advisory directory, default is the `advisories.dir` of the config or \"~/.esmd/advisories\"")
+	flags.StringVar(&source, "source", osvNpmAdvisoriesUrl, "the url or the local path of the OSV zip archive")
+	flags.Parse(args)
+
+	if existsFile(cfile) {
+		c, err := LoadConfig(cfile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		config = c
+	}
+	if dir == "" {
+		dir = getAdvisoryDir()
+	}
+
+	n, err := updateAdvisoryDB(dir, source)
+	if err != nil {
+		fmt.Printf("[error] failed to update advisories: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("updated %d advisories in %s\n", n, dir)
+}
+
+// updateAdvisoryDB replaces the advisories in the directory with the OSV zip archive.
+func updateAdvisoryDB(dir string, source string) (n int, err error) {
+	zipPath := source
+	if isHttpSepcifier(source) {
+		tmpDir, err := os.MkdirTemp("", "esmd-advisories-")
+		if err != nil {
+			return 0, err
+		}
+		defer os.RemoveAll(tmpDir)
+		zipPath = path.Join(tmpDir, "all.zip")
+		err = downloadVendorFile(source, nil, "", zipPath)
+		if err != nil {
+			return 0, err
+		}
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+
+	// extract the advisories to a new directory then replace the old one
+	err = ensureDir(path.Dir(dir))
+	if err != nil {
+		return
+	}
+	newDir := dir + ".new"
+	os.RemoveAll(newDir)
+	err = ensureDir(newDir)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(newDir)
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		err = extractZipFile(f, path.Join(newDir, name))
+		if err != nil {
+			return
+		}
+		n++
+	}
+	err = os.WriteFile(path.Join(newDir, advisoryDBUpdatedFile), []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+	if err != nil {
+		return
+	}
+	oldDir := dir + ".old"
+	os.RemoveAll(oldDir)
+	if existsDir(dir) {
+		err = os.Rename(dir, oldDir)
+		if err != nil {
+			return
+		}
+		defer os.RemoveAll(oldDir)
+	}
+	err = os.Rename(newDir, dir)
+	return
+}
+
+func extractZipFile(f *zip.File, savePath string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(savePath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = io.Copy(w, io.LimitReader(r, 10*MB))
+	return err
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestAdvisories(t *testing.T) {
+	dir := path.Join(os.TempDir(), "advisory_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"GHSA-0001.json":  `{"id":"GHSA-0001","summary":"Prototype pollution","affected":[{"package":{"ecosystem":"npm","name":"foo"},"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"1.2.0"}]}]}],"database_specific":{"severity":"CRITICAL"}}`,
+		"GHSA-0002.json":  `{"id":"GHSA-0002","summary":"ReDoS","affected":[{"package":{"ecosystem":"npm","name":"foo"},"ranges":[{"type":"SEMVER","events":[{"introduced":"2.0.0"},{"last_affected":"2.1.0"}]}]},{"package":{"ecosystem":"npm","name":"bar"},"versions":["1.0.0"]}],"database_specific":{"severity":"MODERATE"}}`,
+		"GHSA-0003.json":  `{"id":"GHSA-0003","summary":"Withdrawn","withdrawn":"2024-01-01T00:00:00Z","affected":[{"package":{"ecosystem":"npm","name":"foo"},"ranges":[{"type":"SEMVER","events":[{"introduced":"0"}]}]}]}`,
+		"PYSEC-0001.json": `{"id":"PYSEC-0001","affected":[{"package":{"ecosystem":"PyPI","name":"foo"},"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"}]}]}]}`,
+	}
+
+	// update the advisory database with the local zip archive
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create("osv/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	os.MkdirAll(dir, 0755)
+	zipPath := path.Join(dir, "all.zip")
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	advisoryDir := path.Join(dir, "advisories")
+	n, err := updateAdvisoryDB(advisoryDir, zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || !existsFile(path.Join(advisoryDir, advisoryDBUpdatedFile)) {
+		t.Fatalf("invalid advisory database, %d advisories", n)
+	}
+
+	db, err := loadAdvisoryDB(advisoryDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.packages["foo"]) != 2 || len(db.packages["bar"]) != 1 {
+		t.Fatalf("invalid advisory database %v", db.packages)
+	}
+	defer advisories.Store(advisories.Load())
+	advisories.Store(db)
+
+	for version, ids := range map[string]string{
+		"1.0.0":       "GHSA-0001",
+		"1.2.0":       "",
+		"2.0.0-beta":  "",
+		"2.0.0":       "GHSA-0002",
+		"2.1.0":       "GHSA-0002",
+		"2.1.1":       "",
+		"invalid-ver": "",
+	} {
+		var a []string
+		for _, advisory := range getPackageAdvisories("foo", version) {
+			a = append(a, advisory.ID)
+		}
+		if strings.Join(a, ",") != ids {
+			t.Fatalf("invalid advisories %v of foo@%s, shoud be '%s'", a, version, ids)
+		}
+	}
+	if list := getPackageAdvisories("bar", "1.0.0"); len(list) != 1 || list[0].Severity != "moderate" {
+		t.Fatalf("invalid advisories of bar@1.0.0 %v", list)
+	}
+	if list := getPackageAdvisories("bar", "1.0.1"); len(list) != 0 {
+		t.Fatalf("invalid advisories of bar@1.0.1 %v", list)
+	}
+
+	pkgAdvisories := getBuildAdvisories([]string{"foo@1.0.0", "bar@1.0.0", "baz@1.0.0"})
+	if len(pkgAdvisories) != 2 {
+		t.Fatalf("invalid build advisories %v", pkgAdvisories)
+	}
+	header := http.Header{}
+	if err := checkAdvisories(header, pkgAdvisories); err != nil {
+		t.Fatal(err)
+	}
+	if v := header.Get("X-ESM-Advisories"); v != "GHSA-0002; pkg=bar@1.0.0; severity=moderate, GHSA-0001; pkg=foo@1.0.0; severity=critical" {
+		t.Fatalf("invalid X-ESM-Advisories header '%s'", v)
+	}
+	config.Advisories.BlockCritical = true
+	defer func() { config.Advisories.BlockCritical = false }()
+	if err := checkAdvisories(http.Header{}, pkgAdvisories); !isAdvisoryBlockedError(err) || !strings.Contains(err.Error(), "GHSA-0001") {
+		t.Fatalf("the critical advisory shoud be blocked: %v", err)
+	}
+	delete(pkgAdvisories, "foo@1.0.0")
+	if err := checkAdvisories(http.Header{}, pkgAdvisories); err != nil {
+		t.Fatal(err)
+	}
+
+	// the warnings of dev builds
+	ctx := &BuildContext{pkgJson: &PackageJSON{Name: "foo", Version: "2.0.0"}}
+	warnings := bytes.NewBuffer(nil)
+	ctx.writeAdvisoryWarnings(warnings, map[string]*BuildAnalysisPackage{"bar": {Version: "1.0.0"}, "baz": {Version: "1.0.0"}})
+	if s := warnings.String(); strings.Count(s, "console.warn(") != 2 || !strings.Contains(s, "bar@1.0.0") || !strings.Contains(s, `foo@2.0.0: " + "GHSA-0002 (moderate) ReDoS"`) {
+		t.Fatalf("invalid advisory warnings:\n%s", s)
+	}
+}
+
+func TestInstalledAdvisories(t *testing.T) {
+	server := newTestNpmRegistry(t)
+	defer server.Close()
+	server.addPackage(t, "foo", "1.0.0", "MIT", map[string]string{"bar": "^1.0.0"})
+	server.addPackage(t, "bar", "1.0.0", "MIT", nil)
+
+	workDir := config.WorkDir
+	defer func() { config.WorkDir = workDir }()
+	config.WorkDir = path.Join(os.TempDir(), "advisory_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(config.WorkDir)
+	// clear the package info cached by the installation
+	defer cacheStore.Clear()
+
+	var advisory osvAdvisory
+	json.Unmarshal([]byte(`{"id":"GHSA-0001","summary":"RCE","affected":[{"package":{"ecosystem":"npm","name":"bar"},"versions":["1.0.0"]}],"database_specific":{"severity":"CRITICAL"}}`), &advisory)
+	defer advisories.Store(advisories.Load())
+	advisories.Store(&advisoryDB{packages: map[string][]*osvAdvisory{"bar": {&advisory}}})
+	config.Advisories.BlockCritical = true
+	defer func() { config.Advisories.BlockCritical = false }()
+
+	// the installed dependencies are not blocked by the critical advisories
+	npmrc := &NpmRC{NpmRegistry: NpmRegistry{Registry: server.URL + "/"}}
+	p, err := npmrc.installPackage(Package{Name: "foo", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd := path.Join(config.WorkDir, "wd")
+	ensureDir(path.Join(wd, "node_modules"))
+	installed := npmrc.installDependencies(wd, p, false, nil)
+	if len(installed) != 1 || !existsFile(path.Join(wd, "node_modules", "bar", "index.js")) {
+		t.Fatalf("the dependency shoud be installed %v", installed)
+	}
+
+	// but they are blocked if they are bundled
+	err = checkBundledAdvisories(map[string]*BuildAnalysisPackage{"foo": {Version: "1.0.0"}, "bar": {Version: "1.0.0"}})
+	if !isAdvisoryBlockedError(err) || !strings.Contains(err.Error(), "'bar@1.0.0'") {
+		t.Fatalf("the bundled package shoud be blocked by the critical advisory: %v", err)
+	}
+
+	// the advisories of the installed dependencies that are not bundled are reported only
+	ctx := &BuildContext{pkgJson: p, installedDeps: installed}
+	if pkgs := ctx.getInstalledPackages([]string{"foo@1.0.0"}); len(pkgs) != 1 || pkgs[0] != "bar@1.0.0" {
+		t.Fatalf("invalid installed packages %v", pkgs)
+	}
+	if pkgs := ctx.getInstalledPackages([]string{"foo@1.0.0", "bar@1.0.0"}); len(pkgs) != 0 {
+		t.Fatalf("the bundled packages shoud be excluded %v", pkgs)
+	}
+	header := http.Header{}
+	pkgAdvisories := map[string][]Advisory{}
+	reportInstalledAdvisories(header, pkgAdvisories, []string{"bar@1.0.0"})
+	if v := header.Get("X-ESM-Advisories"); v != "GHSA-0001; pkg=bar@1.0.0; severity=critical" || len(pkgAdvisories) != 1 {
+		t.Fatalf("invalid X-ESM-Advisories header '%s'", v)
+	}
+	warnings := bytes.NewBuffer(nil)
+	ctx.writeAdvisoryWarnings(warnings, nil)
+	if s := warnings.String(); !strings.Contains(s, "bar@1.0.0") {
+		t.Fatalf("invalid advisory warnings:\n%s", s)
+	}
+}
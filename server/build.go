@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/esm-dev/esm.sh/server/npm_replacements"
 	"github.com/esm-dev/esm.sh/server/storage"
@@ -49,6 +50,25 @@ type BuildContext struct {
 	esmImports  [][2]string
 	cjsRequires [][3]string
 	smOffset    int
+	trace       *[]string
+	// the build queue that runs the build, the nested builds are added to it
+	queue *BuildQueue
+	// the build is a chunk of the shared module
+	chunk bool
+	// the shared modules whose chunks are being built, to avoid circular chunks
+	pendingChunks *set.Set[string]
+	// the chunks are built one by one in the build queue slot of current build
+	chunkLock sync.Mutex
+	// the dependencies that are installed in `BundleDeps` mode
+	installedDeps []*PackageJSON
+	// the packages that are bundled into the chunks and their licenses, see `BuildMeta.Packages`
+	chunkPackages []string
+	chunkLicenses []string
+	// the optional dependencies of the bundled packages, keyed by the package directory
+	optionalDeps sync.Map
+	// the merged dependency overrides, see `getOverrides`
+	overrides     map[string]string
+	overridesOnce sync.Once
 }
 
 var (
@@ -91,6 +111,66 @@ func (ctx *BuildContext) Path() string {
 	return ctx.path
 }
 
+// newBuildContextFromPath creates the build context by the build path, e.g. the `Imports` and
+// `Dts` of the build meta.
+func newBuildContextFromPath(npmrc *NpmRC, logger *log.Logger, db Database, buildStorage storage.Storage, pathname string) (*BuildContext, error) {
+	externalAll := strings.HasPrefix(pathname, "/*")
+	if externalAll {
+		pathname = "/" + pathname[2:]
+	}
+	esm, _, _, hasTargetSegment, err := praseEsmPath(npmrc, pathname)
+	if err != nil {
+		return nil, err
+	}
+	var args BuildArgs
+	if a := strings.Split(esm.SubModuleName, "/"); len(a) > 1 && strings.HasPrefix(a[0], "X-") {
+		args, err = decodeBuildArgs(strings.TrimPrefix(a[0], "X-"))
+		if err != nil {
+			return nil, err
+		}
+		esm.SubPath = strings.Join(strings.Split(esm.SubPath, "/")[1:], "/")
+		esm.SubModuleName = stripEntryModuleExt(esm.SubPath)
+	}
+	ctx := &BuildContext{
+		npmrc:       npmrc,
+		logger:      logger,
+		db:          db,
+		storage:     buildStorage,
+		esm:         esm,
+		args:        args,
+		externalAll: externalAll,
+	}
+	if endsWith(esm.SubPath, ".d.ts", ".d.mts", ".d.cts") {
+		ctx.target = "types"
+		return ctx, nil
+	}
+	a := strings.Split(esm.SubModuleName, "/")
+	if !hasTargetSegment || !strings.HasSuffix(esm.SubPath, ".mjs") || len(a) < 2 || !isBuildTarget(a[0]) {
+		return nil, fmt.Errorf("invalid build path '%s'", pathname)
+	}
+	ctx.target = a[0]
+	submodule := strings.Join(a[1:], "/")
+	if strings.HasSuffix(submodule, ".bundle") {
+		submodule = strings.TrimSuffix(submodule, ".bundle")
+		ctx.bundleMode = BundleDeps
+	} else if strings.HasSuffix(submodule, ".nobundle") {
+		submodule = strings.TrimSuffix(submodule, ".nobundle")
+		ctx.bundleMode = BundleFalse
+	}
+	if strings.HasSuffix(submodule, ".development") {
+		submodule = strings.TrimSuffix(submodule, ".development")
+		ctx.dev = true
+	}
+	basename := strings.TrimSuffix(path.Base(esm.PkgName), ".js")
+	if submodule == basename {
+		submodule = ""
+	} else if submodule == "__"+basename {
+		submodule = basename
+	}
+	ctx.esm.SubModuleName = submodule
+	return ctx, nil
+}
+
 func (ctx *BuildContext) Exists() (meta *BuildMeta, ok bool, err error) {
 	key := ctx.npmrc.zoneId + ":" + ctx.Path()
 	meta, err = withLRUCache(key, func() (*BuildMeta, error) {
@@ -164,6 +244,12 @@ func (ctx *BuildContext) Build() (meta *BuildMeta, err error) {
 	if err != nil {
 		ctx.logger.Errorf("db.put(%s): %v", key, err)
 		err = errors.New("db: " + err.Error())
+		return
+	}
+
+	// update the license inventory of the package, served at `/_licenses`
+	if e := saveLicenseInventory(ctx.db, ctx.npmrc.zoneId, ctx.esm.PkgName, meta.Licenses); e != nil {
+		ctx.logger.Errorf("failed to save the license inventory of %s: %v", ctx.esm.PkgName, e)
 	}
 	return
 }
@@ -190,6 +276,19 @@ func (ctx *BuildContext) buildPath() {
 		return
 	}
 
+	// the CSS build of the sub-module, e.g. "/pkg@1.0.0/es2022/dist/style.css"
+	if strings.HasSuffix(esm.SubModuleName, ".css") {
+		ctx.path = fmt.Sprintf(
+			"/%s%s/%s%s/%s",
+			asteriskPrefix,
+			esm.Name(),
+			ctx.getBuildArgsPrefix(false),
+			ctx.target,
+			esm.SubModuleName,
+		)
+		return
+	}
+
 	name := strings.TrimSuffix(path.Base(esm.PkgName), ".js")
 	if esm.SubModuleName != "" {
 		if esm.SubModuleName == name {
@@ -254,7 +353,18 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 		if analyzeMode {
 			return
 		}
-		meta = &BuildMeta{CSSEntry: entry.main}
+		var css []byte
+		css, err = ctx.bundleCSS(path.Join(ctx.wd, "node_modules", ctx.esm.PkgName, entry.main))
+		if err != nil {
+			return
+		}
+		err = ctx.storage.Put(ctx.getCSSSavepath(), bytes.NewReader(css))
+		if err != nil {
+			ctx.logger.Errorf("storage.put(%s): %v", ctx.getCSSSavepath(), err)
+			err = errors.New("storage: " + err.Error())
+			return
+		}
+		meta = &BuildMeta{CSSEntry: entry.main, CSSInJS: true}
 		return
 	}
 
@@ -322,12 +432,13 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 		if err != nil {
 			return
 		}
-		importUrl := ctx.getImportPath(dep, ctx.getBuildArgsPrefix(false), ctx.externalAll)
+		importUrl := ctx.getImportPath(dep, ctx.getImportArgsPrefix(), ctx.externalAll)
 		buf := bytes.NewBuffer(nil)
 		fmt.Fprintf(buf, `export * from "%s";`, importUrl)
 		if meta.ExportDefault {
 			fmt.Fprintf(buf, `export { default } from "%s";`, importUrl)
 		}
+		ctx.hashChunkPath(buf.Bytes())
 		err = ctx.storage.Put(ctx.getSavepath(), buf)
 		if err != nil {
 			ctx.logger.Errorf("storage.put(%s): %v", ctx.getSavepath(), err)
@@ -382,6 +493,14 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 	esmifyPlugin := esbuild.Plugin{
 		Name: "esmify",
 		Setup: func(build esbuild.PluginBuild) {
+			// the scoped CSS of CSS modules
+			build.OnResolve(
+				esbuild.OnResolveOptions{Filter: ".*", Namespace: "css-module"},
+				func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+					return esbuild.OnResolveResult{Path: args.Importer, Namespace: "css-module-style", PluginData: args.PluginData}, nil
+				},
+			)
+
 			// resovler
 			build.OnResolve(
 				esbuild.OnResolveOptions{Filter: ".*"},
@@ -409,6 +528,18 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 						}, nil
 					}
 
+					// resolve deno.land/x module urls through esm.sh
+					if specifier, ok := toDenoXSpecifier(args.Path); ok && !ctx.externalAll {
+						externalPath, err := ctx.resolveExternalModule(specifier, args.Kind, false, analyzeMode)
+						if err != nil {
+							return esbuild.OnResolveResult{}, err
+						}
+						return esbuild.OnResolveResult{
+							Path:     externalPath,
+							External: true,
+						}, nil
+					}
+
 					// skip data: and http: imports
 					if strings.HasPrefix(args.Path, "data:") || strings.HasPrefix(args.Path, "https:") || strings.HasPrefix(args.Path, "http:") {
 						return esbuild.OnResolveResult{
@@ -528,6 +659,14 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 						}, nil
 					}
 
+					// platform-specific optional dependencies (native modules) do not work via http import
+					if !strings.HasPrefix(specifier, "/") && !isRelPathSpecifier(specifier) && ctx.isNativeOptionalDep(args.Importer, toPackageName(specifier)) {
+						return esbuild.OnResolveResult{
+							Path:     fmt.Sprintf("/error.js?type=unsupported-node-native-module&name=%s&importer=%s", toPackageName(specifier), ctx.esm.Specifier()),
+							External: true,
+						}, nil
+					}
+
 					var filename string
 					if strings.HasPrefix(specifier, "/") {
 						filename = specifier
@@ -559,11 +698,12 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 						}, nil
 					}
 
-					// bundles all dependencies in `bundle` mode, apart from peerDependencies and `?external` flag
+					// bundles all dependencies in `bundle` mode, apart from peerDependencies, overridden dependencies and `?external` flag
 					if ctx.bundleMode == BundleDeps && !ctx.args.external.Has(toPackageName(specifier)) && !implicitExternal.Has(specifier) {
 						pkgName := toPackageName(specifier)
 						_, ok := pkgJson.PeerDependencies[pkgName]
-						if !ok {
+						// IIFE modules bundle the peer dependencies as well
+						if (!ok || ctx.args.format == "iife") && !ctx.isOverridden(pkgName) {
 							return esbuild.OnResolveResult{}, nil
 						}
 					}
@@ -669,6 +809,13 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 							}
 
 							if len(args.With) > 0 && args.With["type"] == "css" {
+								// bundle the CSS as a constructable stylesheet for browsers
+								if ctx.isBrowserTarget() {
+									return esbuild.OnResolveResult{
+										Path:      path.Join(ctx.wd, "node_modules", ctx.esm.PkgName, modulePath),
+										Namespace: "css-sheet",
+									}, nil
+								}
 								return esbuild.OnResolveResult{
 									Path:        "/" + ctx.esm.Name() + utils.NormalizePathname(modulePath),
 									External:    true,
@@ -742,6 +889,18 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 									}
 									if !analyzeMode && ctx.splitting != nil && ctx.splitting.Has(short) {
 										specifier = pkgJson.Name + utils.NormalizePathname(stripEntryModuleExt(short))
+										// import the shared module from the chunk
+										if endsWith(short, moduleExts...) && !withTypeJSON && (ctx.pendingChunks == nil || !ctx.pendingChunks.Has(short)) {
+											chunkPath, err := ctx.resolveChunk(short, specifier, args.Kind)
+											if err != nil {
+												return esbuild.OnResolveResult{}, err
+											}
+											return esbuild.OnResolveResult{
+												Path:        chunkPath,
+												External:    true,
+												SideEffects: pkgSideEffects,
+											}, nil
+										}
 										externalPath, err := ctx.resolveExternalModule(specifier, args.Kind, withTypeJSON, false)
 										if err != nil {
 											return esbuild.OnResolveResult{}, err
@@ -759,6 +918,13 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 											Namespace: "wasm",
 										}, nil
 									}
+									// compile CSS modules to the scoped class maps
+									if strings.HasSuffix(filename, ".module.css") {
+										return esbuild.OnResolveResult{
+											Path:      filename,
+											Namespace: "css-module",
+										}, nil
+									}
 									// transfrom svelte component
 									if strings.HasSuffix(filename, ".svelte") {
 										return esbuild.OnResolveResult{
@@ -899,6 +1065,42 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 				},
 			)
 
+			// CSS module loader
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: ".*", Namespace: "css-module"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					js, css, err := ctx.compileCSSModule(args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+					contents := string(js)
+					if len(css) > 0 {
+						contents = "import \"css-module-style\";\n" + contents
+					}
+					return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderJS, PluginData: css}, nil
+				},
+			)
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: ".*", Namespace: "css-module-style"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					contents := string(args.PluginData.([]byte))
+					return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderCSS}, nil
+				},
+			)
+
+			// CSS stylesheet loader
+			build.OnLoad(
+				esbuild.OnLoadOptions{Filter: ".*", Namespace: "css-sheet"},
+				func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					css, err := ctx.bundleCSS(args.Path)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+					contents := cssSheetModule(css)
+					return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderJS}, nil
+				},
+			)
+
 			// svelte SFC loader
 			build.OnLoad(
 				esbuild.OnLoadOptions{Filter: ".*", Namespace: "svelte"},
@@ -1022,11 +1224,13 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 	} else if ctx.target == "node" {
 		conditions = append(conditions, "node")
 	}
+	target, engines := getEsbuildTarget(ctx.target)
 	options := esbuild.BuildOptions{
 		AbsWorkingDir:     ctx.wd,
 		PreserveSymlinks:  true,
 		Format:            esbuild.FormatESModule,
-		Target:            targets[ctx.target],
+		Target:            target,
+		Engines:           engines,
 		Platform:          esbuild.PlatformBrowser,
 		Define:            define,
 		Supported:         supported,
@@ -1043,6 +1247,9 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 		Plugins:           []esbuild.Plugin{esmifyPlugin},
 		Outdir:            "/esbuild",
 		Write:             false,
+		Metafile:          true,
+		// move the legal comments to the `.LEGAL.txt` file
+		LegalComments: esbuild.LegalCommentsExternal,
 	}
 	if entryPoint != "" {
 		options.EntryPoints = []string{entryPoint}
@@ -1052,7 +1259,8 @@ func (ctx *BuildContext) buildModule(analyzeMode bool) (meta *BuildMeta, include
 	if ctx.target == "node" {
 		options.Platform = esbuild.PlatformNode
 	}
-	if config.SourceMap {
+	// the source map is dropped for the non-ESM formats
+	if config.SourceMap && ctx.args.format == "" {
 		options.Sourcemap = esbuild.SourceMapExternal
 	}
 	for _, pkgName := range []string{"preact", "react", "solid-js", "mono-jsx", "vue", "hono"} {
@@ -1122,7 +1330,39 @@ REBUILD:
 		ctx.logger.Warnf("esbuild(%s): %s", ctx.Path(), w.Text)
 	}
 
+	// analyze the build once, the packages that are bundled into the build are used by the license
+	// checking, the advisory warnings and the build meta
+	var analysis *BuildAnalysis
+	var bundledPackages map[string]*BuildAnalysisPackage
+	if res.Metafile != "" {
+		if a, e := ctx.analyzeBuild(res.Metafile); e == nil {
+			analysis = a
+			bundledPackages = a.Packages
+		} else {
+			ctx.logger.Warnf("build(%s): failed to analyze the build: %v", ctx.Path(), e)
+		}
+	}
+
+	// check the licenses of the bundled packages
+	if !config.LicensePolicy.IsEmpty() {
+		for name, pkg := range bundledPackages {
+			if pkg.Version != "" {
+				if err = checkLicensePolicy(name+"@"+pkg.Version, pkg.License); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	// block the bundled packages that have critical advisories
+	if config.Advisories.BlockCritical {
+		if err = checkBundledAdvisories(bundledPackages); err != nil {
+			return
+		}
+	}
+
 	imports := set.New[string]()
+	outputSize := 0
 
 	for _, file := range res.OutputFiles {
 		if strings.HasSuffix(file.Path, ".js") {
@@ -1131,7 +1371,11 @@ REBUILD:
 			defer recycle()
 			header.WriteString("/* esm.sh - ")
 			if ctx.esm.GhPrefix {
-				header.WriteString("github:")
+				if ctx.esm.GitHost != "" {
+					header.WriteString(ctx.esm.GitHost + ":")
+				} else {
+					header.WriteString("github:")
+				}
 			} else if ctx.esm.PrPrefix {
 				header.WriteString("pkg.pr.new/")
 			}
@@ -1236,6 +1480,19 @@ REBUILD:
 				}
 			}
 
+			// inject polyfills of the runtime APIs that are missing in the target
+			if ctx.args.polyfill && ctx.isBrowserTarget() {
+				names, e := getPolyfills(ctx.target, jsContent)
+				if e != nil {
+					ctx.logger.Warnf("build(%s): failed to analyze the polyfills: %v", ctx.Path(), e)
+				}
+				for _, name := range names {
+					header.WriteString(`import "/polyfill/` + name + `.mjs";`)
+					header.WriteByte('\n')
+					imports.Add("/polyfill/" + name + ".mjs")
+				}
+			}
+
 			// apply cjs requires
 			if len(ctx.cjsRequires) > 0 {
 				requires := make([][3]string, 0, len(ctx.cjsRequires))
@@ -1333,6 +1590,11 @@ REBUILD:
 				}
 			}
 
+			// warn the advisories of the package and the bundled packages in development mode
+			if ctx.dev && !ctx.esm.GhPrefix && !ctx.esm.PrPrefix && !ctx.chunk {
+				ctx.writeAdvisoryWarnings(header, bundledPackages)
+			}
+
 			// to fix the source map
 			ctx.smOffset += strings.Count(header.String(), "\n")
 
@@ -1346,13 +1608,28 @@ REBUILD:
 			finalJS.Write(jsContent)
 
 			// check if the package is deprecated
-			if !ctx.esm.GhPrefix && !ctx.esm.PrPrefix {
+			if !ctx.esm.GhPrefix && !ctx.esm.PrPrefix && !ctx.chunk {
 				deprecated, _ := ctx.npmrc.isDeprecated(ctx.pkgJson.Name, ctx.pkgJson.Version)
 				if deprecated != "" {
 					fmt.Fprintf(finalJS, `console.warn("%%c[esm.sh]%%c %%cdeprecated%%c %s@%s: " + %s, "color:grey", "", "color:red", "");%s`, ctx.esm.PkgName, ctx.esm.PkgVersion, utils.MustEncodeJSON(deprecated), "\n")
 				}
 			}
 
+			// convert the module to the output format
+			if ctx.args.format != "" {
+				code, formatImports, e := ctx.convertFormat(finalJS.Bytes())
+				if e != nil {
+					err = e
+					return
+				}
+				finalJS.Reset()
+				finalJS.Write(code)
+				imports = set.New(formatImports...)
+				dropSourceMap = true
+			}
+
+			ctx.hashChunkPath(finalJS.Bytes())
+
 			// add sourcemap Url
 			if config.SourceMap && !dropSourceMap {
 				finalJS.WriteString("//# sourceMappingURL=")
@@ -1360,6 +1637,7 @@ REBUILD:
 				finalJS.WriteString(".map")
 			}
 
+			outputSize = finalJS.Len()
 			err = ctx.storage.Put(ctx.getSavepath(), finalJS)
 			if err != nil {
 				ctx.logger.Errorf("storage.put(%s): %v", ctx.getSavepath(), err)
@@ -1369,10 +1647,10 @@ REBUILD:
 		}
 	}
 
+	var legalComments []byte
 	for _, file := range res.OutputFiles {
 		if strings.HasSuffix(file.Path, ".css") {
-			savePath := ctx.getSavepath()
-			savePath = strings.TrimSuffix(savePath, path.Ext(savePath)) + ".css"
+			savePath := ctx.getCSSSavepath()
 			err = ctx.storage.Put(savePath, bytes.NewReader(file.Contents))
 			if err != nil {
 				ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
@@ -1380,6 +1658,9 @@ REBUILD:
 				return
 			}
 			meta.CSSInJS = true
+		} else if strings.HasSuffix(file.Path, ".LEGAL.txt") {
+			// the legal comments of the JS and CSS outputs
+			legalComments = append(legalComments, file.Contents...)
 		} else if config.SourceMap && strings.HasSuffix(file.Path, ".js.map") {
 			var sourceMap map[string]interface{}
 			if json.Unmarshal(file.Contents, &sourceMap) == nil {
@@ -1405,6 +1686,17 @@ REBUILD:
 		}
 	}
 
+	// save the legal comments to the `.LEGAL.txt` file
+	if len(legalComments) > 0 {
+		savePath := ctx.getLegalCommentsSavepath()
+		err = ctx.storage.Put(savePath, bytes.NewReader(legalComments))
+		if err != nil {
+			ctx.logger.Errorf("storage.put(%s): %v", savePath, err)
+			err = errors.New("storage: " + err.Error())
+			return
+		}
+	}
+
 	// sort imports
 	for _, path := range imports.Values() {
 		if strings.HasPrefix(path, "/") {
@@ -1413,6 +1705,16 @@ REBUILD:
 	}
 	sort.Strings(meta.Imports)
 
+	// save the bundle analysis report
+	if analysis != nil {
+		analysis.setOutput(outputSize, meta.Imports)
+		meta.Packages, meta.Licenses = ctx.getBuildPackages(analysis.Packages)
+		meta.Installed = ctx.getInstalledPackages(meta.Packages)
+		if e := ctx.saveAnalysis(analysis); e != nil {
+			ctx.logger.Warnf("build(%s): failed to save the bundle analysis: %v", ctx.Path(), e)
+		}
+	}
+
 	// resolve types(dts)
 	meta.Dts, err = ctx.resolveDTS(entry)
 	return
@@ -1502,6 +1804,11 @@ func (ctx *BuildContext) install() (err error) {
 			}
 		}
 
+		err = checkLicensePolicy(p.Name+"@"+p.Version, p.License)
+		if err != nil {
+			return err
+		}
+
 		ctx.wd = path.Join(ctx.npmrc.StoreDir(), ctx.esm.Name())
 		ctx.pkgJson = p
 	}
@@ -1509,7 +1816,13 @@ func (ctx *BuildContext) install() (err error) {
 	// - install dependencies in `BundleDeps` mode
 	// - install '@babel/runtime' and '@swc/helpers' if they are present in the dependencies in `BundleDefault` mode
 	if ctx.bundleMode == BundleDeps {
-		ctx.npmrc.installDependencies(ctx.wd, ctx.pkgJson, false, nil)
+		ctx.installedDeps = ctx.npmrc.installDependencies(ctx.wd, ctx.pkgJson, false, nil)
+		// the denied licenses of the dependencies are logged only, the build fails if they are bundled
+		for _, p := range ctx.installedDeps {
+			if e := checkLicensePolicy(p.Name+"@"+p.Version, p.License); e != nil {
+				ctx.logger.Warnf("install(%s): %v", ctx.esm.Specifier(), e)
+			}
+		}
 	} else if ctx.bundleMode == BundleDefault {
 		if v, ok := ctx.pkgJson.Dependencies["@babel/runtime"]; ok {
 			ctx.npmrc.installDependencies(ctx.wd, &PackageJSON{Dependencies: map[string]string{"@babel/runtime": v}}, false, nil)
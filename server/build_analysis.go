@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ije/gox/utils"
+)
+
+// BuildAnalysis is the bundle analysis report of a build, it's generated from the esbuild metafile
+// and stored alongside the build, served at `/_analyze/<build path>`.
+type BuildAnalysis struct {
+	Path string `json:"path"`
+	// the size of the build output in bytes
+	Size     int                              `json:"size"`
+	Inputs   []BuildAnalysisInput             `json:"inputs"`
+	Packages map[string]*BuildAnalysisPackage `json:"packages"`
+	Imports  []string                         `json:"imports"`
+	// the external packages that are imported by the build, name -> version
+	External map[string]string     `json:"external"`
+	Exports  *BuildAnalysisExports `json:"exports,omitempty"`
+	Metafile json.RawMessage       `json:"metafile,omitempty"`
+}
+
+// BuildAnalysisInput is the bundled input file of a build.
+type BuildAnalysisInput struct {
+	Path          string `json:"path"`
+	Package       string `json:"package,omitempty"`
+	Bytes         int    `json:"bytes"`
+	BytesInOutput int    `json:"bytesInOutput"`
+}
+
+// BuildAnalysisPackage is the package that is bundled into a build.
+type BuildAnalysisPackage struct {
+	Version       string `json:"version"`
+	License       string `json:"license,omitempty"`
+	Inputs        int    `json:"inputs"`
+	BytesInOutput int    `json:"bytesInOutput"`
+}
+
+// BuildAnalysisExports is the tree-shaking result of the `?exports` query.
+type BuildAnalysisExports struct {
+	Names []string `json:"names"`
+	Size  int      `json:"size"`
+}
+
+type esbuildMetafile struct {
+	Inputs map[string]struct {
+		Bytes int `json:"bytes"`
+	} `json:"inputs"`
+	Outputs map[string]struct {
+		Inputs map[string]struct {
+			BytesInOutput int `json:"bytesInOutput"`
+		} `json:"inputs"`
+	} `json:"outputs"`
+}
+
+// getAnalysisSavepath returns the storage path of the bundle analysis report.
+func (ctx *BuildContext) getAnalysisSavepath() string {
+	return ctx.getSavepath() + ".analysis.json"
+}
+
+// analyzeBuild creates the bundle analysis report of the build by the esbuild metafile, the output size
+// and the imports are set by `setOutput` after the output files are processed.
+func (ctx *BuildContext) analyzeBuild(metafile string) (*BuildAnalysis, error) {
+	var mf esbuildMetafile
+	if err := json.Unmarshal([]byte(metafile), &mf); err != nil {
+		return nil, err
+	}
+	analysis := &BuildAnalysis{
+		Path:     ctx.Path(),
+		Inputs:   []BuildAnalysisInput{},
+		Packages: map[string]*BuildAnalysisPackage{},
+		Imports:  []string{},
+		External: map[string]string{},
+		Metafile: json.RawMessage(metafile),
+	}
+	for name, output := range mf.Outputs {
+		if !strings.HasSuffix(name, ".js") {
+			continue
+		}
+		for inputPath, input := range output.Inputs {
+			pkgDir, pkgName := getInputPackage(inputPath)
+			analysis.Inputs = append(analysis.Inputs, BuildAnalysisInput{
+				Path:          inputPath,
+				Package:       pkgName,
+				Bytes:         mf.Inputs[inputPath].Bytes,
+				BytesInOutput: input.BytesInOutput,
+			})
+			if pkgName == "" {
+				continue
+			}
+			pkg, ok := analysis.Packages[pkgName]
+			if !ok {
+				pkg = &BuildAnalysisPackage{}
+				if !path.IsAbs(pkgDir) {
+					pkgDir = path.Join(ctx.wd, pkgDir)
+				}
+				var raw PackageJSONRaw
+				if utils.ParseJSONFile(path.Join(pkgDir, "package.json"), &raw) == nil {
+					pkg.Version = raw.Version
+					pkg.License = raw.LicenseString()
+				}
+				analysis.Packages[pkgName] = pkg
+			}
+			pkg.Inputs++
+			pkg.BytesInOutput += input.BytesInOutput
+		}
+	}
+	sort.Slice(analysis.Inputs, func(i, j int) bool {
+		a, b := analysis.Inputs[i], analysis.Inputs[j]
+		if a.BytesInOutput != b.BytesInOutput {
+			return a.BytesInOutput > b.BytesInOutput
+		}
+		return a.Path < b.Path
+	})
+	return analysis, nil
+}
+
+// setOutput sets the output size and the imports of the build, and the external packages of the imports.
+func (analysis *BuildAnalysis) setOutput(size int, imports []string) {
+	analysis.Size = size
+	if imports != nil {
+		analysis.Imports = imports
+	}
+	for _, importPath := range imports {
+		if strings.HasPrefix(importPath, "/node/") || strings.HasPrefix(importPath, "/polyfill/") {
+			continue
+		}
+		pkgName, version, _, _ := splitEsmPath(strings.TrimPrefix(importPath, "/*"))
+		if version != "" {
+			analysis.External[pkgName] = version
+		}
+	}
+}
+
+// getInputPackage returns the package directory and the package name of the esbuild input path,
+// e.g. "node_modules/@scope/foo/dist/index.js" -> ("node_modules/@scope/foo", "@scope/foo").
+func getInputPackage(inputPath string) (pkgDir string, pkgName string) {
+	// strip the namespace, e.g. "css-module:node_modules/foo/style.module.css"
+	if i := strings.Index(inputPath, ":"); i > 0 && !strings.Contains(inputPath[:i], "/") {
+		inputPath = inputPath[i+1:]
+	}
+	i := strings.LastIndex(inputPath, "node_modules/")
+	if i < 0 {
+		return
+	}
+	a := strings.Split(inputPath[i+len("node_modules/"):], "/")
+	if strings.HasPrefix(a[0], "@") && len(a) > 1 {
+		pkgName = a[0] + "/" + a[1]
+	} else {
+		pkgName = a[0]
+	}
+	pkgDir = inputPath[:i+len("node_modules/")+len(pkgName)]
+	return
+}
+
+// saveAnalysis saves the bundle analysis report to the storage.
+func (ctx *BuildContext) saveAnalysis(analysis *BuildAnalysis) error {
+	buf := bytes.NewBuffer(nil)
+	err := json.NewEncoder(buf).Encode(analysis)
+	if err != nil {
+		return err
+	}
+	return ctx.storage.Put(ctx.getAnalysisSavepath(), buf)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestAnalyzeBuild(t *testing.T) {
+	wd := path.Join(os.TempDir(), "analysis_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(wd)
+	writeTestFiles(t, wd, map[string]string{
+		"node_modules/foo/package.json":    `{"name":"foo","version":"1.0.0"}`,
+		"node_modules/@s/dep/package.json": `{"name":"@s/dep","version":"2.1.0"}`,
+	})
+	ctx := &BuildContext{
+		npmrc:  DefaultNpmRC(),
+		wd:     wd,
+		esm:    EsmPath{PkgName: "foo", PkgVersion: "1.0.0"},
+		target: "es2022",
+	}
+	metafile := `{
+		"inputs": {
+			"node_modules/foo/index.js": {"bytes": 100},
+			"node_modules/foo/a.module.css": {"bytes": 20},
+			"node_modules/@s/dep/index.js": {"bytes": 300}
+		},
+		"outputs": {
+			"../../esbuild/index.js.map": {"inputs": {}},
+			"../../esbuild/index.js": {
+				"inputs": {
+					"node_modules/foo/index.js": {"bytesInOutput": 50},
+					"node_modules/foo/a.module.css": {"bytesInOutput": 10},
+					"node_modules/@s/dep/index.js": {"bytesInOutput": 200}
+				}
+			}
+		}
+	}`
+	analysis, err := ctx.analyzeBuild(metafile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis.setOutput(300, []string{"/*react@19.0.0/es2022/react.mjs", "/@s/ext@1.2.3/es2022/ext.mjs", "/node/process.mjs"})
+	if analysis.Path != "/foo@1.0.0/es2022/foo.mjs" || analysis.Size != 300 {
+		t.Fatalf("invalid analysis %s %d", analysis.Path, analysis.Size)
+	}
+	if len(analysis.Inputs) != 3 || analysis.Inputs[0].Path != "node_modules/@s/dep/index.js" || analysis.Inputs[0].Bytes != 300 || analysis.Inputs[0].BytesInOutput != 200 {
+		t.Fatalf("invalid inputs %v", analysis.Inputs)
+	}
+	if pkg := analysis.Packages["foo"]; pkg == nil || pkg.Version != "1.0.0" || pkg.Inputs != 2 || pkg.BytesInOutput != 60 {
+		t.Fatalf("invalid package 'foo' %v", pkg)
+	}
+	if pkg := analysis.Packages["@s/dep"]; pkg == nil || pkg.Version != "2.1.0" || pkg.BytesInOutput != 200 {
+		t.Fatalf("invalid package '@s/dep' %v", pkg)
+	}
+	if len(analysis.External) != 2 || analysis.External["react"] != "19.0.0" || analysis.External["@s/ext"] != "1.2.3" {
+		t.Fatalf("invalid external %v", analysis.External)
+	}
+}
+
+func TestGetInputPackage(t *testing.T) {
+	for inputPath, expected := range map[string][2]string{
+		"node_modules/foo/dist/index.js":                       {"node_modules/foo", "foo"},
+		"node_modules/@scope/foo/index.js":                     {"node_modules/@scope/foo", "@scope/foo"},
+		"node_modules/foo/node_modules/bar/index.js":           {"node_modules/foo/node_modules/bar", "bar"},
+		"css-module:/tmp/wd/node_modules/foo/style.module.css": {"/tmp/wd/node_modules/foo", "foo"},
+		"<stdin>":                       {"", ""},
+		"npm-replacement:object-assign": {"", ""},
+	} {
+		pkgDir, pkgName := getInputPackage(inputPath)
+		if pkgDir != expected[0] || pkgName != expected[1] {
+			t.Fatalf("invalid input package (%s, %s) of '%s', shoud be (%s, %s)", pkgDir, pkgName, inputPath, expected[0], expected[1])
+		}
+	}
+}
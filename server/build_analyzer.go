@@ -17,28 +17,46 @@ type Ref struct {
 	importers *set.Set[string]
 }
 
+// the max number of the entries to analyze the shared modules, e.g. the top-level modules of "lodash-es"
+const maxSplittingEntries = 1000
+
+// analyzeSplitting finds the shared modules of the package entries, the shared modules are built
+// as chunks that are imported by the builds of the entries instead of being bundled into each build.
 func (ctx *BuildContext) analyzeSplitting() (err error) {
-	if ctx.bundleMode == BundleDefault && ctx.pkgJson.Exports.Len() > 1 {
+	if ctx.args.splitting == "false" || ctx.args.format != "" || ctx.bundleMode == BundleFalse {
+		return
+	}
+	if ctx.bundleMode == BundleDefault || ctx.args.splitting == "true" {
 		exportNames := set.New[string]()
-		for _, exportName := range ctx.pkgJson.Exports.keys {
-			exportName := stripEntryModuleExt(exportName)
-			if (exportName == "." || (strings.HasPrefix(exportName, "./") && !strings.ContainsRune(exportName, '*'))) && !endsWith(exportName, ".json", ".css", ".wasm", ".d.ts", ".d.mts", ".d.cts") {
-				v := ctx.pkgJson.Exports.values[exportName]
-				if s, ok := v.(string); ok {
-					if endsWith(s, ".json", ".css", ".wasm", ".d.ts", ".d.mts", ".d.cts") {
-						continue
+		if ctx.pkgJson.Exports.Len() > 1 {
+			for _, exportName := range ctx.pkgJson.Exports.keys {
+				exportName := stripEntryModuleExt(exportName)
+				if (exportName == "." || (strings.HasPrefix(exportName, "./") && !strings.ContainsRune(exportName, '*'))) && !endsWith(exportName, ".json", ".css", ".wasm", ".d.ts", ".d.mts", ".d.cts") {
+					v := ctx.pkgJson.Exports.values[exportName]
+					if s, ok := v.(string); ok {
+						if endsWith(s, ".json", ".css", ".wasm", ".d.ts", ".d.mts", ".d.cts") {
+							continue
+						}
+					} else if obj, ok := v.(JSONObject); ok {
+						// ignore types only exports
+						if len(obj.keys) == 1 && obj.keys[0] == "types" {
+							continue
+						}
 					}
-				} else if obj, ok := v.(JSONObject); ok {
-					// ignore types only exports
-					if len(obj.keys) == 1 && obj.keys[0] == "types" {
-						continue
+					if exportName == "." {
+						exportNames.Add("")
+					} else if strings.HasPrefix(exportName, "./") {
+						exportNames.Add(exportName[2:])
 					}
 				}
-				if exportName == "." {
-					exportNames.Add("")
-				} else if strings.HasPrefix(exportName, "./") {
-					exportNames.Add(exportName[2:])
-				}
+			}
+		} else if ctx.pkgJson.Exports.Len() == 0 && ctx.args.splitting == "true" {
+			for _, name := range ctx.getTopLevelModules() {
+				exportNames.Add(name)
+			}
+			if exportNames.Len() > maxSplittingEntries {
+				ctx.logger.Warnf("build(%s): too many modules to split (%d)", ctx.esm.Specifier(), exportNames.Len())
+				return
 			}
 		}
 		if exportNames.Len() > 1 {
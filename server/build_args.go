@@ -13,11 +13,17 @@ import (
 type BuildArgs struct {
 	alias             map[string]string
 	deps              map[string]string
+	overrides         map[string]string
 	external          set.ReadOnlySet[string]
 	conditions        []string
 	keepNames         bool
 	ignoreAnnotations bool
 	externalRequire   bool
+	polyfill          bool
+	format            string
+	globalName        string
+	// "true" to split the shared modules of all the sub-modules, "false" to disable the splitting
+	splitting string
 }
 
 func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
@@ -42,10 +48,24 @@ func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
 					deps[pkgName] = pkgVersion
 				}
 				args.deps = deps
+			} else if strings.HasPrefix(p, "o") {
+				args.overrides = map[string]string{}
+				for _, p := range strings.Split(p[1:], ",") {
+					selector, version := utils.SplitByFirstByte(p, ':')
+					if selector != "" && version != "" {
+						args.overrides[selector] = version
+					}
+				}
 			} else if strings.HasPrefix(p, "e") {
 				args.external = *set.NewReadOnly(strings.Split(p[1:], ",")...)
 			} else if strings.HasPrefix(p, "c") {
 				args.conditions = append(args.conditions, strings.Split(p[1:], ",")...)
+			} else if strings.HasPrefix(p, "f") {
+				args.format = p[1:]
+			} else if strings.HasPrefix(p, "g") {
+				args.globalName = p[1:]
+			} else if strings.HasPrefix(p, "s") {
+				args.splitting = p[1:]
 			} else {
 				switch p {
 				case "r":
@@ -54,6 +74,8 @@ func decodeBuildArgs(argsString string) (args BuildArgs, err error) {
 					args.keepNames = true
 				case "i":
 					args.ignoreAnnotations = true
+				case "p":
+					args.polyfill = true
 
 				}
 			}
@@ -84,6 +106,16 @@ func encodeBuildArgs(args BuildArgs, isDts bool) string {
 			lines = append(lines, fmt.Sprintf("d%s", strings.Join(ss, ",")))
 		}
 	}
+	if len(args.overrides) > 0 {
+		var ss sort.StringSlice
+		for selector, version := range args.overrides {
+			ss = append(ss, fmt.Sprintf("%s:%s", selector, version))
+		}
+		if len(ss) > 0 {
+			ss.Sort()
+			lines = append(lines, fmt.Sprintf("o%s", strings.Join(ss, ",")))
+		}
+	}
 	if args.external.Len() > 0 {
 		var ss sort.StringSlice
 		for _, name := range args.external.Values() {
@@ -114,6 +146,18 @@ func encodeBuildArgs(args BuildArgs, isDts bool) string {
 		if args.ignoreAnnotations {
 			lines = append(lines, "i")
 		}
+		if args.polyfill {
+			lines = append(lines, "p")
+		}
+		if args.format != "" {
+			lines = append(lines, "f"+args.format)
+		}
+		if args.globalName != "" {
+			lines = append(lines, "g"+args.globalName)
+		}
+		if args.splitting != "" {
+			lines = append(lines, "s"+args.splitting)
+		}
 	}
 	if len(lines) > 0 {
 		return btoaUrl(strings.Join(lines, "\n"))
@@ -121,10 +165,10 @@ func encodeBuildArgs(args BuildArgs, isDts bool) string {
 	return ""
 }
 
-// resolveBuildArgs resolves `alias`, `deps`, `external` of the build args
+// resolveBuildArgs resolves `alias`, `deps`, `overrides`, `external` of the build args
 func resolveBuildArgs(npmrc *NpmRC, installDir string, args *BuildArgs, esm EsmPath) error {
-	if len(args.alias) > 0 || len(args.deps) > 0 || args.external.Len() > 0 {
-		// quick check if the alias, deps, external are all in dependencies of the package
+	if len(args.alias) > 0 || len(args.deps) > 0 || len(args.overrides) > 0 || args.external.Len() > 0 {
+		// quick check if the alias, deps, overrides, external are all in dependencies of the package
 		deps, ok, err := func() (deps *set.Set[string], ok bool, err error) {
 			var p *PackageJSON
 			pkgJsonPath := path.Join(installDir, "node_modules", esm.PkgName, "package.json")
@@ -163,6 +207,13 @@ func resolveBuildArgs(npmrc *NpmRC, installDir string, args *BuildArgs, esm EsmP
 					}
 				}
 			}
+			if len(args.overrides) > 0 {
+				for selector := range args.overrides {
+					if !matchOverrideDeps(selector, deps) {
+						return nil, false, nil
+					}
+				}
+			}
 			if args.external.Len() > 0 {
 				for _, name := range args.external.Values() {
 					if !deps.Has(name) {
@@ -215,6 +266,15 @@ func resolveBuildArgs(npmrc *NpmRC, installDir string, args *BuildArgs, esm EsmP
 			}
 			args.deps = depsArg
 		}
+		if len(args.overrides) > 0 {
+			overrides := map[string]string{}
+			for selector, version := range args.overrides {
+				if matchOverrideDeps(selector, deps) {
+					overrides[selector] = version
+				}
+			}
+			args.overrides = overrides
+		}
 		if args.external.Len() > 0 {
 			external := make([]string, 0, args.external.Len())
 			for _, name := range args.external.Values() {
@@ -239,6 +299,17 @@ func resolveBuildArgs(npmrc *NpmRC, installDir string, args *BuildArgs, esm EsmP
 	return nil
 }
 
+// matchOverrideDeps checks if all packages of the override selector are in the dependencies.
+func matchOverrideDeps(selector string, deps *set.Set[string]) bool {
+	for _, segment := range strings.Split(selector, ">") {
+		pkgName, _ := parseOverrideSelector(segment)
+		if !deps.Has(pkgName) {
+			return false
+		}
+	}
+	return true
+}
+
 func walkDeps(npmrc *NpmRC, installDir string, pkg Package, mark *set.Set[string]) (err error) {
 	if mark.Has(pkg.Name) {
 		return
@@ -267,6 +338,7 @@ func walkDeps(npmrc *NpmRC, installDir string, pkg Package, mark *set.Set[string
 	for name, version := range p.PeerDependencies {
 		pkgDeps[name] = version
 	}
+	optionalDeps := p.OptionalDependencies
 	for name, version := range pkgDeps {
 		depPkg := Package{Name: name, Version: version}
 		p, e := resolveDependencyVersion(version)
@@ -275,6 +347,10 @@ func walkDeps(npmrc *NpmRC, installDir string, pkg Package, mark *set.Set[string
 		}
 		err := walkDeps(npmrc, installDir, depPkg, mark)
 		if err != nil {
+			// ignore the errors of optional dependencies
+			if _, ok := optionalDeps[name]; ok {
+				continue
+			}
 			return err
 		}
 	}
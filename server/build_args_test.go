@@ -16,11 +16,15 @@ func TestEncodeBuildArgs(t *testing.T) {
 				"d": "1.0.0",
 				"e": "1.0.0",
 			},
+			overrides:         map[string]string{"f": "2.0.0", "g@^1.0.0>f": "npm:h@1.0.0"},
 			external:          *set.NewReadOnly("baz", "bar"),
 			conditions:        conditions,
 			externalRequire:   true,
 			keepNames:         true,
 			ignoreAnnotations: true,
+			format:            "iife",
+			globalName:        "Foo.Bar",
+			splitting:         "true",
 		},
 		false,
 	)
@@ -34,6 +38,9 @@ func TestEncodeBuildArgs(t *testing.T) {
 	if len(args.deps) != 3 {
 		t.Fatal("invalid deps")
 	}
+	if len(args.overrides) != 2 || args.overrides["g@^1.0.0>f"] != "npm:h@1.0.0" {
+		t.Fatal("invalid overrides")
+	}
 	if args.external.Len() != 2 {
 		t.Fatal("invalid external")
 	}
@@ -49,4 +56,67 @@ func TestEncodeBuildArgs(t *testing.T) {
 	if !args.ignoreAnnotations {
 		t.Fatal("ignoreAnnotations should be true")
 	}
+	if args.format != "iife" || args.globalName != "Foo.Bar" {
+		t.Fatal("invalid format")
+	}
+	if args.splitting != "true" {
+		t.Fatal("invalid splitting")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	rules := map[string]string{}
+	parseNpmOverrides(map[string]any{
+		"a": "1.0.0",
+		"b": map[string]any{
+			".": "2.0.0",
+			"c": "3.0.0",
+		},
+		"@scope/d@^1.0.0": map[string]any{
+			"e": "$e",
+		},
+	}, "", map[string]string{"e": "^5.0.0"}, rules)
+	if len(rules) != 4 || rules["a"] != "1.0.0" || rules["b"] != "2.0.0" || rules["b>c"] != "3.0.0" || rules["@scope/d@^1.0.0>e"] != "^5.0.0" {
+		t.Fatalf("invalid npm overrides %v", rules)
+	}
+
+	rules = map[string]string{}
+	parseYarnResolutions(map[string]any{
+		"**/a":       "1.0.0",
+		"b/c":        "2.0.0",
+		"@scope/d/e": "3.0.0",
+	}, rules)
+	if len(rules) != 3 || rules["a"] != "1.0.0" || rules["b>c"] != "2.0.0" || rules["@scope/d>e"] != "3.0.0" {
+		t.Fatalf("invalid yarn resolutions %v", rules)
+	}
+
+	for _, rule := range [][2]string{{"foo@1\nereact", "2"}, {"foo", "1\nereact:2"}, {"foo:bar", "1"}, {"foo,bar", "1"}, {"foo", "1,bar:2"}} {
+		if validateOverride(rule[0], rule[1]) {
+			t.Fatalf("override %q shoud be invalid", rule)
+		}
+	}
+	if !validateOverride("foo@^1.0.0>bar", "npm:baz@1.0.0") {
+		t.Fatal("override shoud be valid")
+	}
+
+	name, versionRange := parseOverrideSelector("@scope/d@^1.0.0")
+	if name != "@scope/d" || versionRange != "^1.0.0" {
+		t.Fatalf("invalid selector %s %s", name, versionRange)
+	}
+
+	overrides := map[string]string{"a": "1.0.0", "a@^2.0.0": "2.1.0", "b>a": "3.0.0", "b@^1.0.0>c>a": "4.0.0"}
+	if v, ok := resolveOverride(nil, overrides, "a", "2.0.0"); !ok || v != "2.1.0" {
+		t.Fatalf("shoud be 2.1.0, got %s", v)
+	}
+	if v, ok := resolveOverride(nil, overrides, "a", "1.5.0"); !ok || v != "1.0.0" {
+		t.Fatalf("shoud be 1.0.0, got %s", v)
+	}
+	narrowed := narrowOverrides(nil, overrides, "b", "1.0.0")
+	if narrowed["a"] != "3.0.0" || narrowed["a@^2.0.0"] != "" || narrowed["c>a"] != "4.0.0" {
+		t.Fatalf("invalid narrowed overrides %v", narrowed)
+	}
+	narrowed = narrowOverrides(nil, overrides, "b", "2.0.0")
+	if narrowed["a"] != "3.0.0" || narrowed["c>a"] != "" {
+		t.Fatalf("invalid narrowed overrides %v", narrowed)
+	}
 }
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+	"github.com/ije/esbuild-internal/xxhash"
+	"github.com/ije/gox/set"
+	syncx "github.com/ije/gox/sync"
+)
+
+// chunkMutex locks the chunk directories of the packages, see `buildChunk`.
+var chunkMutex syncx.KeyedMutex
+
+// getTopLevelModules returns the module names in the root directory of the package, they are the
+// entries to analyze the shared modules for the packages without `exports` field, e.g. "lodash-es/map".
+func (ctx *BuildContext) getTopLevelModules() []string {
+	entries, err := os.ReadDir(path.Join(ctx.wd, "node_modules", ctx.esm.PkgName))
+	if err != nil {
+		return nil
+	}
+	mainEntries := set.New[string]()
+	for _, s := range []string{ctx.pkgJson.Main, ctx.pkgJson.Module, "index.js"} {
+		if s != "" {
+			mainEntries.Add(stripModuleExt(strings.TrimPrefix(path.Clean(s), "./")))
+		}
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || !endsWith(name, ".js", ".mjs", ".cjs") {
+			continue
+		}
+		// the main entry usually imports all the other modules
+		if name = stripModuleExt(name); !mainEntries.Has(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getChunkPath returns the path of the chunk, the chunks are placed in the build directory of the package.
+func (ctx *BuildContext) getChunkPath(name string) string {
+	asteriskPrefix := ""
+	if ctx.externalAll {
+		asteriskPrefix = "*"
+	}
+	return fmt.Sprintf(
+		"/%s%s/%s%s/%s.mjs",
+		asteriskPrefix,
+		ctx.esm.Name(),
+		ctx.getBuildArgsPrefix(false),
+		ctx.target,
+		name,
+	)
+}
+
+// hashChunkPath names the chunk by the content hash.
+func (ctx *BuildContext) hashChunkPath(content []byte) {
+	if ctx.chunk {
+		ctx.path = ctx.getChunkPath(fmt.Sprintf("chunk-%016x", xxhash.Sum64(content)))
+	}
+}
+
+// resolveChunk builds the shared module as a chunk and returns the import path of the chunk.
+func (ctx *BuildContext) resolveChunk(modulePath string, specifier string, kind esbuild.ResolveKind) (resolvedPath string, err error) {
+	chunkPath, err := ctx.buildChunk(modulePath)
+	if err != nil {
+		return
+	}
+	resolvedPath = chunkPath
+	if rp, e := relPath(path.Dir(ctx.Path()), chunkPath); e == nil {
+		resolvedPath = rp
+	}
+	if kind == esbuild.ResolveJSRequireCall {
+		ctx.cjsRequires = append(ctx.cjsRequires, [3]string{specifier, chunkPath, resolvedPath})
+		resolvedPath = specifier
+	} else if kind == esbuild.ResolveJSImportStatement {
+		ctx.esmImports = append(ctx.esmImports, [2]string{chunkPath, resolvedPath})
+	}
+	return
+}
+
+// buildChunk builds the shared module of the package as a chunk if it doesn't exist, and returns the chunk path,
+// e.g. "/lodash-es@4.17.21/es2022/chunk-1c3b2a6e9f0d4c87.mjs".
+// The chunk is built in the install directory of current build, and the build meta of the chunk is saved
+// to check the licenses and advisories of the chunk like other builds.
+func (ctx *BuildContext) buildChunk(modulePath string) (chunkPath string, err error) {
+	// the esbuild resolver calls this concurrently, build the chunks one by one to not exceed the
+	// build concurrency
+	ctx.chunkLock.Lock()
+	defer ctx.chunkLock.Unlock()
+
+	// the builds of the same package (e.g. "lodash-es/map" and "lodash-es/filter") share the chunks, lock
+	// the chunk directory to not build the same chunk at the same time. The nested chunks are built with
+	// the lock held by the top-level build, locking the directory instead of the module avoids the deadlock
+	// of the circular shared modules.
+	if !ctx.chunk {
+		unlock := chunkMutex.Lock(ctx.npmrc.zoneId + ":" + path.Dir(ctx.getChunkPath("chunk")))
+		defer unlock()
+	}
+
+	esm := ctx.esm
+	esm.SubPath = modulePath
+	esm.SubModuleName = stripEntryModuleExt(modulePath)
+	pendingChunks := set.New(modulePath)
+	if ctx.pendingChunks != nil {
+		for _, p := range ctx.pendingChunks.Values() {
+			pendingChunks.Add(p)
+		}
+	}
+	b := &BuildContext{
+		npmrc:         ctx.npmrc,
+		logger:        ctx.logger,
+		db:            ctx.db,
+		storage:       ctx.storage,
+		esm:           esm,
+		args:          ctx.args,
+		bundleMode:    ctx.bundleMode,
+		externalAll:   ctx.externalAll,
+		target:        ctx.target,
+		dev:           ctx.dev,
+		wd:            ctx.wd,
+		pkgJson:       ctx.pkgJson,
+		splitting:     ctx.splitting,
+		chunk:         true,
+		pendingChunks: pendingChunks,
+	}
+
+	// the chunk path is stored in the database with the build path of the module
+	key := ctx.npmrc.zoneId + ":" + b.Path() + "#chunk"
+	data, err := ctx.db.Get(key)
+	if err != nil {
+		ctx.logger.Errorf("db.get(%s): %v", key, err)
+		return
+	}
+	if data != nil {
+		chunkPath = string(data)
+		if _, e := ctx.storage.Stat(normalizeSavePath(ctx.npmrc.zoneId, path.Join("modules", chunkPath))); e == nil {
+			metaKey := ctx.npmrc.zoneId + ":" + chunkPath
+			metadata, e := ctx.db.Get(metaKey)
+			if e == nil && metadata != nil {
+				if meta, e := decodeBuildMeta(metadata); e == nil {
+					ctx.chunkPackages = append(ctx.chunkPackages, meta.Packages...)
+					ctx.chunkLicenses = append(ctx.chunkLicenses, meta.Licenses...)
+					return
+				}
+			}
+			// rebuild the chunk if the meta is missing
+		}
+	}
+
+	// build the chunk in the chunk directory to keep the relative import paths,
+	// the path will be updated with the content hash after the chunk is built
+	b.path = b.getChunkPath("chunk")
+	meta, _, err := b.buildModule(false)
+	if err != nil {
+		return "", fmt.Errorf("failed to build the chunk of '%s': %v", modulePath, err)
+	}
+	chunkPath = b.Path()
+	metaKey := ctx.npmrc.zoneId + ":" + chunkPath
+	err = ctx.db.Put(metaKey, encodeBuildMeta(meta))
+	if err != nil {
+		ctx.logger.Errorf("db.put(%s): %v", metaKey, err)
+	}
+	err = ctx.db.Put(key, []byte(chunkPath))
+	if err != nil {
+		ctx.logger.Errorf("db.put(%s): %v", key, err)
+	}
+	ctx.chunkPackages = append(ctx.chunkPackages, meta.Packages...)
+	ctx.chunkLicenses = append(ctx.chunkLicenses, meta.Licenses...)
+	return chunkPath, nil
+}
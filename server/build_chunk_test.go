@@ -0,0 +1,144 @@
+package server
+
+import (
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBuildChunks(t *testing.T) {
+	env := newTestBuildEnv(t, "chunk", map[string]string{
+		"foo/node_modules/foo/package.json":  `{"name":"foo","version":"1.0.0","type":"module","types":"index.d.ts","exports":{".":"./index.js","./a":"./a.js","./b":"./b.js"}}`,
+		"foo/node_modules/foo/index.d.ts":    `export {}`,
+		"foo/node_modules/foo/index.js":      `export const version = "1.0.0"`,
+		"foo/node_modules/foo/a.js":          `import { shared } from "./lib/shared.js"; export const a = () => shared("a")`,
+		"foo/node_modules/foo/b.js":          `import { shared } from "./lib/shared.js"; export const b = () => shared("b")`,
+		"foo/node_modules/foo/lib/shared.js": `import { util } from "./util.js"; export function shared(s) { return util(s) }`,
+		"foo/node_modules/foo/lib/util.js":   `export function util(s) { return "[" + s + "]" }`,
+		"bar/node_modules/bar/package.json":  `{"name":"bar","version":"1.0.0","type":"module","main":"index.js","types":"index.d.ts"}`,
+		"bar/node_modules/bar/index.d.ts":    `export {}`,
+		"bar/node_modules/bar/index.js":      `export { default as map } from "./map.js"; export { default as filter } from "./filter.js"`,
+		"bar/node_modules/bar/map.js":        `import base from "./_base.js"; export default (a, f) => base(a).map(f)`,
+		"bar/node_modules/bar/filter.js":     `import base from "./_base.js"; export default (a, f) => base(a).filter(f)`,
+		"bar/node_modules/bar/_base.js":      `export default function base(a) { return Array.from(a).concat("<base>") }`,
+	})
+
+	build := func(pkgName string, subModule string, args BuildArgs) string {
+		ctx := env.newBuildContext(t, path.Join(env.wd, pkgName), EsmPath{PkgName: pkgName, PkgVersion: "1.0.0", SubPath: subModule, SubModuleName: subModule})
+		ctx.args = args
+		_, err := ctx.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _, err := env.storage.Get(ctx.getSavepath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		code, _ := io.ReadAll(f)
+		return string(code)
+	}
+
+	a := build("foo", "a", BuildArgs{})
+	b := build("foo", "b", BuildArgs{})
+	for _, code := range []string{a, b} {
+		if strings.Contains(code, `"["+`) || !strings.Contains(code, "./chunk-") {
+			t.Fatalf("the shared module shoud be imported from the chunk:\n%s", code)
+		}
+	}
+	chunkA := a[strings.Index(a, "./chunk-"):]
+	chunkA = chunkA[:strings.Index(chunkA, ".mjs")+4]
+	if !strings.Contains(b, chunkA) {
+		t.Fatalf("the builds shoud import the same chunk '%s':\n%s", chunkA, b)
+	}
+	f, _, err := env.storage.Get(normalizeSavePath("", path.Join("modules/foo@1.0.0/es2022", chunkA)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, _ := io.ReadAll(f)
+	f.Close()
+	if !strings.Contains(string(chunk), `"["+`) || !strings.Contains(string(chunk), "as shared") {
+		t.Fatalf("invalid chunk:\n%s", chunk)
+	}
+
+	// the build meta of the chunk is saved
+	chunkCtx, err := newBuildContextFromPath(DefaultNpmRC(), env.logger, env.db, env.storage, path.Join("/foo@1.0.0/es2022", chunkA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkMeta, ok, err := chunkCtx.Exists()
+	if err != nil || !ok {
+		t.Fatalf("the build meta of the chunk shoud be saved, %v", err)
+	}
+	if len(chunkMeta.Licenses) != 1 || chunkMeta.Licenses[0] != "foo@1.0.0" || len(chunkMeta.Packages) != 1 || chunkMeta.Packages[0] != "foo@1.0.0" {
+		t.Fatalf("invalid chunk packages %v, licenses %v", chunkMeta.Packages, chunkMeta.Licenses)
+	}
+
+	// the packages and the licenses of the chunks are carried into the build
+	ctx := &BuildContext{
+		pkgJson:       &PackageJSON{Name: "foo", Version: "1.0.0"},
+		chunkPackages: []string{"foo@1.0.0", "qux@1.0.0", "baz@1.0.0"},
+		chunkLicenses: []string{"foo@1.0.0", "qux@1.0.0 MIT", "baz@1.0.0"},
+	}
+	packages, licenses := ctx.getBuildPackages(nil)
+	if strings.Join(packages, ",") != "foo@1.0.0,baz@1.0.0,qux@1.0.0" {
+		t.Fatalf("invalid packages %v", packages)
+	}
+	if strings.Join(licenses, ",") != "foo@1.0.0,baz@1.0.0,qux@1.0.0 MIT" {
+		t.Fatalf("invalid licenses %v", licenses)
+	}
+
+	// the concurrent builds of the package share the chunks
+	var wg sync.WaitGroup
+	codes := make([]string, 2)
+	errs := make([]error, 2)
+	for i, subModule := range []string{"a", "b"} {
+		ctx := env.newBuildContext(t, path.Join(env.wd, "foo"), EsmPath{PkgName: "foo", PkgVersion: "1.0.0", SubPath: subModule, SubModuleName: subModule})
+		ctx.args = BuildArgs{keepNames: true}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, errs[i] = ctx.Build(); errs[i] == nil {
+				codes[i] = ctx.getSavepath()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, savepath := range codes {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		f, _, err := env.storage.Get(savepath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := io.ReadAll(f)
+		f.Close()
+		codes[i] = string(code)
+	}
+	chunkA = codes[0][strings.Index(codes[0], "./chunk-"):]
+	chunkA = chunkA[:strings.Index(chunkA, ".mjs")+4]
+	if !strings.Contains(codes[1], chunkA) {
+		t.Fatalf("the concurrent builds shoud import the same chunk '%s':\n%s", chunkA, codes[1])
+	}
+
+	// `?splitting=false` disables the splitting
+	a = build("foo", "a", BuildArgs{splitting: "false"})
+	if !strings.Contains(a, `"["+`) || strings.Contains(a, "chunk-") {
+		t.Fatalf("the shared module shoud be bundled:\n%s", a)
+	}
+
+	// `?splitting` splits the shared modules of the top-level modules for the packages without `exports` field
+	if m := build("bar", "map", BuildArgs{}); !strings.Contains(m, "<base>") {
+		t.Fatalf("the shared module shoud be bundled without `?splitting`:\n%s", m)
+	}
+	m := build("bar", "map", BuildArgs{splitting: "true"})
+	f2 := build("bar", "filter", BuildArgs{splitting: "true"})
+	for _, code := range []string{m, f2} {
+		if strings.Contains(code, "<base>") || !strings.Contains(code, "./chunk-") {
+			t.Fatalf("the shared module shoud be imported from the chunk:\n%s", code)
+		}
+	}
+}
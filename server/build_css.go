@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+// cssLoaders is the loaders of CSS builds, the `url()` assets are inlined as data URLs.
+var cssLoaders = map[string]esbuild.Loader{
+	".css":        esbuild.LoaderCSS,
+	".module.css": esbuild.LoaderCSS,
+	".svg":        esbuild.LoaderDataURL,
+	".png":        esbuild.LoaderDataURL,
+	".jpg":        esbuild.LoaderDataURL,
+	".jpeg":       esbuild.LoaderDataURL,
+	".webp":       esbuild.LoaderDataURL,
+	".avif":       esbuild.LoaderDataURL,
+	".gif":        esbuild.LoaderDataURL,
+	".ttf":        esbuild.LoaderDataURL,
+	".otf":        esbuild.LoaderDataURL,
+	".eot":        esbuild.LoaderDataURL,
+	".woff":       esbuild.LoaderDataURL,
+	".woff2":      esbuild.LoaderDataURL,
+}
+
+// cssEngines is the browsers that support the ES version, CSS can't be lowered by the ES version
+// target, let's use the browsers of the same period instead.
+var cssEngines = map[string]string{
+	"es2015": "chrome51_edge15_firefox54_ios10_safari10",
+	"es2016": "chrome52_edge15_firefox52_ios10.1_safari10.1",
+	"es2017": "chrome58_edge16_firefox53_ios11_safari11",
+	"es2018": "chrome64_edge79_firefox58_ios12_safari12",
+	"es2019": "chrome73_edge79_firefox64_ios12.1_safari12.1",
+	"es2020": "chrome80_edge80_firefox80_ios14.1_safari14.1",
+	"es2021": "chrome85_edge85_firefox79_ios14.1_safari14.1",
+	"es2022": "chrome94_edge94_firefox93_ios16.4_safari16.4",
+	"es2023": "chrome110_edge110_firefox115_ios16.4_safari16.4",
+	"es2024": "chrome119_edge119_firefox121_ios17.4_safari17.4",
+}
+
+// getCSSTarget returns the esbuild target of CSS builds.
+func (ctx *BuildContext) getCSSTarget() (esbuild.Target, []esbuild.Engine) {
+	if engines, ok := cssEngines[ctx.target]; ok {
+		return getEsbuildTarget(engines)
+	}
+	return getEsbuildTarget(ctx.target)
+}
+
+// getCSSPath returns the path of the CSS file that is generated by the build.
+func (ctx *BuildContext) getCSSPath() string {
+	p := ctx.Path()
+	if strings.HasSuffix(p, ".css") {
+		return p
+	}
+	return strings.TrimSuffix(p, ".mjs") + ".css"
+}
+
+// getCSSSavepath returns the storage path of the CSS file that is generated by the build.
+func (ctx *BuildContext) getCSSSavepath() string {
+	return normalizeSavePath(ctx.npmrc.zoneId, path.Join("modules", ctx.getCSSPath()))
+}
+
+// bundleCSS bundles the CSS file with its `@import`s, the nesting rules and the newer syntax are
+// lowered for the build target.
+func (ctx *BuildContext) bundleCSS(filename string) ([]byte, error) {
+	target, engines := ctx.getCSSTarget()
+	ret := esbuild.Build(esbuild.BuildOptions{
+		AbsWorkingDir:    ctx.wd,
+		PreserveSymlinks: true,
+		EntryPoints:      []string{filename},
+		Bundle:           true,
+		Target:           target,
+		Engines:          engines,
+		MinifyWhitespace: config.Minify,
+		MinifySyntax:     config.Minify,
+		Loader:           cssLoaders,
+		Outdir:           "/esbuild",
+		Write:            false,
+		LogLevel:         esbuild.LogLevelSilent,
+		Platform:         esbuild.PlatformBrowser,
+	})
+	if len(ret.Errors) > 0 {
+		return nil, errors.New("esbuild: " + ret.Errors[0].Text)
+	}
+	for _, file := range ret.OutputFiles {
+		if strings.HasSuffix(file.Path, ".css") {
+			return file.Contents, nil
+		}
+	}
+	return []byte{}, nil
+}
+
+// compileCSSModule compiles the CSS module (`*.module.css`) to the class map and the scoped CSS, the
+// local names are prefixed with the file name and a hash of the module path to avoid conflicts with
+// other packages. It's compiled separately since the main build minifies the local names.
+func (ctx *BuildContext) compileCSSModule(filename string) (js []byte, css []byte, err error) {
+	pkgDir := path.Join(ctx.wd, "node_modules", ctx.esm.PkgName)
+	h := sha1.New()
+	h.Write([]byte(ctx.esm.Name() + strings.TrimPrefix(filename, pkgDir)))
+	name := fmt.Sprintf("%s-%s.module.css", strings.TrimSuffix(path.Base(filename), ".module.css"), hex.EncodeToString(h.Sum(nil))[:6])
+	target, engines := ctx.getCSSTarget()
+	ret := esbuild.Build(esbuild.BuildOptions{
+		Stdin: &esbuild.StdinOptions{
+			Contents: fmt.Sprintf(`export { default } from "%s";`, name),
+			Loader:   esbuild.LoaderJS,
+		},
+		AbsWorkingDir:    ctx.wd,
+		PreserveSymlinks: true,
+		Bundle:           true,
+		Format:           esbuild.FormatESModule,
+		Target:           target,
+		Engines:          engines,
+		MinifyWhitespace: config.Minify,
+		MinifySyntax:     config.Minify,
+		Loader:           cssLoaders,
+		Outdir:           "/esbuild",
+		Write:            false,
+		LogLevel:         esbuild.LogLevelSilent,
+		Platform:         esbuild.PlatformBrowser,
+		Plugins: []esbuild.Plugin{{
+			Name: "css-module",
+			Setup: func(build esbuild.PluginBuild) {
+				build.OnResolve(esbuild.OnResolveOptions{Filter: "^" + regexp.QuoteMeta(name) + "$"}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+					return esbuild.OnResolveResult{Path: name, Namespace: "css-module"}, nil
+				})
+				build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: "css-module"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+					data, err := os.ReadFile(filename)
+					if err != nil {
+						return esbuild.OnLoadResult{}, err
+					}
+					contents := string(data)
+					return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderLocalCSS, ResolveDir: path.Dir(filename)}, nil
+				})
+			},
+		}},
+	})
+	if len(ret.Errors) > 0 {
+		err = errors.New("esbuild: " + ret.Errors[0].Text)
+		return
+	}
+	for _, file := range ret.OutputFiles {
+		if strings.HasSuffix(file.Path, ".js") {
+			js = file.Contents
+		} else if strings.HasSuffix(file.Path, ".css") {
+			css = file.Contents
+		}
+	}
+	return
+}
+
+// cssSheetModule returns the JS module that exports the CSS as a constructable `CSSStyleSheet`,
+// for the `import sheet from "./foo.css" with { type: "css" }` statement.
+func cssSheetModule(css []byte) string {
+	text, _ := json.Marshal(string(css))
+	return fmt.Sprintf("const sheet = new CSSStyleSheet();\nsheet.replaceSync(%s);\nexport default sheet;\n", text)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestCSSBuild(t *testing.T) {
+	wd := path.Join(os.TempDir(), "css_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(wd)
+	writeTestFiles(t, wd, map[string]string{
+		"node_modules/dep/base.css":     `.base { inset: 0 }`,
+		"node_modules/foo/style.css":    `@import "dep/base.css"; .foo { & .bar { color: red } }`,
+		"node_modules/foo/x.module.css": `.title { color: blue } .big-title { composes: title; font-size: 2em }`,
+		"node_modules/foo/package.json": `{"name":"foo","version":"1.0.0"}`,
+		"node_modules/dep/package.json": `{"name":"dep","version":"1.0.0"}`,
+	})
+	ctx := &BuildContext{
+		npmrc:  DefaultNpmRC(),
+		wd:     wd,
+		esm:    EsmPath{PkgName: "foo", PkgVersion: "1.0.0", SubModuleName: "style.css"},
+		target: "safari13",
+	}
+	if p := ctx.getCSSPath(); p != "/foo@1.0.0/safari13/style.css" {
+		t.Fatalf("invalid css path '%s'", p)
+	}
+
+	css, err := ctx.bundleCSS(path.Join(wd, "node_modules/foo/style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(css), ".base") {
+		t.Fatal("`@import` of the package shoud be bundled")
+	}
+	if strings.Contains(string(css), "inset") || strings.Contains(string(css), "&") {
+		t.Fatalf("css shoud be lowered for safari13: %s", css)
+	}
+
+	for target, engines := range cssEngines {
+		if _, ok := parseEngineTargetList(engines); !ok {
+			t.Fatalf("invalid css engines '%s' of '%s'", engines, target)
+		}
+	}
+	ctx.target = "es2020"
+	css, err = ctx.bundleCSS(path.Join(wd, "node_modules/foo/style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(css), "&") {
+		t.Fatalf("css shoud be lowered for es2020: %s", css)
+	}
+
+	js, css, err := ctx.compileCSSModule(path.Join(wd, "node_modules/foo/x.module.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := strings.Split(strings.Split(string(css), ".")[1], "_title")[0]
+	if !strings.HasPrefix(prefix, "x_") || len(prefix) != 8 {
+		t.Fatalf("invalid scoped css: %s", css)
+	}
+	if !strings.Contains(string(js), prefix+"_title "+prefix+"_big-title") {
+		t.Fatalf("invalid class map: %s", js)
+	}
+
+	sheet := cssSheetModule([]byte(".foo{color:red}\n"))
+	if !strings.Contains(sheet, `sheet.replaceSync(".foo{color:red}\n");`) || !strings.Contains(sheet, "export default sheet;") {
+		t.Fatalf("invalid css sheet module: %s", sheet)
+	}
+}
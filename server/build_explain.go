@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BuildResolution is the resolution trace of a module, served at `/_explain/<specifier>`.
+type BuildResolution struct {
+	Specifier string `json:"specifier"`
+	Target    string `json:"target"`
+	Path      string `json:"path"`
+	// the decisions that are made by `resolveEntry` and `resolveDTS`, in order
+	Trace []string             `json:"trace"`
+	Entry BuildResolutionEntry `json:"entry"`
+	Dts   string               `json:"dts,omitempty"`
+}
+
+// BuildResolutionEntry is the resolved build entry of a module.
+type BuildResolutionEntry struct {
+	Main   string `json:"main"`
+	Module bool   `json:"module"`
+	Types  string `json:"types"`
+}
+
+// explainResolution resolves the build entry and the types of the module with tracing enabled,
+// the module is not built.
+func (ctx *BuildContext) explainResolution() (*BuildResolution, error) {
+	trace := []string{}
+	ctx.trace = &trace
+	defer func() {
+		ctx.trace = nil
+	}()
+
+	err := ctx.install()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := ctx.resolveEntry(ctx.esm)
+	if entry.isEmpty() {
+		ctx.tracef("could not resolve build entry")
+	}
+	dts, err := ctx.resolveDTS(entry)
+	if err != nil {
+		return nil, err
+	}
+	if dts != "" {
+		ctx.tracef("resolved the types: '%s'", dts)
+	}
+
+	return &BuildResolution{
+		Specifier: ctx.esm.Specifier(),
+		Target:    ctx.target,
+		Path:      ctx.Path(),
+		Trace:     trace,
+		Entry: BuildResolutionEntry{
+			Main:   entry.main,
+			Module: entry.module,
+			Types:  entry.types,
+		},
+		Dts: dts,
+	}, nil
+}
+
+// tracef records a resolution decision if the tracing is enabled.
+func (ctx *BuildContext) tracef(format string, args ...any) {
+	if ctx.trace != nil {
+		*ctx.trace = append(*ctx.trace, fmt.Sprintf(format, args...))
+	}
+}
+
+// traceExportEntry records the entry that is resolved from the `exports` field.
+func (ctx *BuildContext) traceExportEntry(entry BuildEntry) {
+	if ctx.trace == nil {
+		return
+	}
+	if entry.main != "" {
+		if ctx.existsPkgFile(entry.main) {
+			ctx.tracef("the `exports` field resolves the main '%s' (module: %v)", entry.main, entry.module)
+		} else {
+			ctx.tracef("the main '%s' of the `exports` field doesn't exist", entry.main)
+		}
+	}
+	if entry.types != "" {
+		if ctx.existsPkgFile(entry.types) {
+			ctx.tracef("the `exports` field resolves the types '%s'", entry.types)
+		} else {
+			ctx.tracef("the types '%s' of the `exports` field doesn't exist", entry.types)
+		}
+	}
+}
+
+// traceJSON returns the compact JSON representation of the value for tracing.
+func traceJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
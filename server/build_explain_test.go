@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestExplainResolution(t *testing.T) {
+	wd := path.Join(os.TempDir(), "explain_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(wd)
+	pkgJson := `{"name":"foo","version":"1.0.0","main":"./index.cjs","exports":{".":{"types":"./index.d.ts","browser":"./browser.mjs","import":"./esm/index.mjs","require":"./index.cjs"}}}`
+	writeTestFiles(t, wd, map[string]string{
+		"node_modules/foo/package.json":  pkgJson,
+		"node_modules/foo/index.cjs":     `module.exports = {}`,
+		"node_modules/foo/index.d.ts":    `export {}`,
+		"node_modules/foo/browser.mjs":   `export {}`,
+		"node_modules/foo/esm/index.mjs": `export {}`,
+	})
+	var raw PackageJSONRaw
+	if err := json.Unmarshal([]byte(pkgJson), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	explain := func(target string) *BuildResolution {
+		ctx := &BuildContext{
+			npmrc:   DefaultNpmRC(),
+			wd:      wd,
+			pkgJson: raw.ToNpmPackage(),
+			esm:     EsmPath{PkgName: "foo", PkgVersion: "1.0.0"},
+			target:  target,
+		}
+		ret, err := ctx.explainResolution()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ctx.trace != nil {
+			t.Fatal("the tracing shoud be disabled after explaining")
+		}
+		return ret
+	}
+
+	ret := explain("es2022")
+	if ret.Entry.Main != "./browser.mjs" || !ret.Entry.Module {
+		t.Fatalf("invalid entry %v, shoud be './browser.mjs'", ret.Entry)
+	}
+	if ret.Entry.Types != "./index.d.ts" || ret.Dts != "/foo@1.0.0/index.d.ts" {
+		t.Fatalf("invalid types '%s' and dts '%s'", ret.Entry.Types, ret.Dts)
+	}
+	if ret.Path != "/foo@1.0.0/es2022/foo.mjs" {
+		t.Fatalf("invalid path '%s'", ret.Path)
+	}
+	trace := strings.Join(ret.Trace, "\n")
+	for _, s := range []string{
+		`exports["."] = {"types":"./index.d.ts","browser":"./browser.mjs","import":"./esm/index.mjs","require":"./index.cjs"}`,
+		`apply the "browser" condition`,
+		`the ` + "`exports`" + ` field resolves the main './browser.mjs'`,
+	} {
+		if !strings.Contains(trace, s) {
+			t.Fatalf("the trace shoud contain %q:\n%s", s, trace)
+		}
+	}
+
+	ret = explain("node")
+	if ret.Entry.Main != "./esm/index.mjs" {
+		t.Fatalf("invalid entry %v, shoud be './esm/index.mjs'", ret.Entry)
+	}
+	trace = strings.Join(ret.Trace, "\n")
+	if !strings.Contains(trace, `skip the "browser" condition`) || !strings.Contains(trace, `use the "import" condition`) {
+		t.Fatalf("invalid trace:\n%s", trace)
+	}
+
+	// no tracing by default
+	ctx := &BuildContext{npmrc: DefaultNpmRC(), wd: wd, pkgJson: raw.ToNpmPackage(), esm: EsmPath{PkgName: "foo", PkgVersion: "1.0.0"}, target: "es2022"}
+	ctx.resolveEntry(ctx.esm)
+	if ctx.trace != nil {
+		t.Fatal("the tracing shoud be disabled by default")
+	}
+}
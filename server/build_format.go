@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+	"github.com/ije/gox/utils"
+)
+
+// The output formats other than ES module:
+// - "iife": the module is fully bundled and the exports are assigned to the global variable of `?global-name`.
+// - "system": the module is wrapped with `System.register` for SystemJS loaders, the dependencies are SystemJS modules as well.
+var outputFormats = map[string]bool{
+	"iife":   true,
+	"system": true,
+}
+
+var regexpGlobalName = regexp.MustCompile(`^[a-zA-Z_$][\w$]*(\.[a-zA-Z_$][\w$]*)*$`)
+
+// isValidGlobalName checks if the name is a valid global name for IIFE modules, e.g. `Foo` or `MyLib.Foo`.
+func isValidGlobalName(name string) bool {
+	return len(name) <= 64 && regexpGlobalName.MatchString(name)
+}
+
+// toGlobalName returns the default global name of the package, e.g. "react-dom" -> "reactDom".
+func toGlobalName(pkgName string) string {
+	name := pkgName
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	var sb strings.Builder
+	upper := false
+	for _, c := range name {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$' {
+			if upper && sb.Len() > 0 && c >= 'a' && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			sb.WriteRune(c)
+			upper = false
+		} else {
+			upper = true
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	if s := sb.String(); s[0] >= '0' && s[0] <= '9' {
+		return "_" + s
+	}
+	return sb.String()
+}
+
+// convertFormat converts the ES module that is built by `buildModule` to the output format of the build args.
+// The node builtin modules and polyfills are bundled, the other esm.sh modules are bundled for IIFE format,
+// or remain as the dependencies of SystemJS modules.
+func (ctx *BuildContext) convertFormat(code []byte) (out []byte, imports []string, err error) {
+	format := ctx.args.format
+	// the static imports are the dependencies of the SystemJS module
+	var deps []string
+	if format == "system" {
+		imports = []string{}
+		deps = []string{}
+	}
+	target, engines := getEsbuildTarget(ctx.target)
+	plugin := esbuild.Plugin{
+		Name: "esm-format",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: ".*"}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				path := args.Path
+				if (strings.HasPrefix(path, "/node/") || strings.HasPrefix(path, "/polyfill/")) && strings.HasSuffix(path, ".mjs") {
+					return esbuild.OnResolveResult{Path: path, Namespace: "esm-internal"}, nil
+				}
+				if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "/error.js") {
+					if format == "system" {
+						if !stringInSlice(imports, path) {
+							imports = append(imports, path)
+						}
+						// dynamic imports are loaded by the SystemJS loader lazily
+						if args.Kind == esbuild.ResolveJSDynamicImport {
+							return esbuild.OnResolveResult{Path: path, Namespace: "esm-system-import"}, nil
+						}
+						if !stringInSlice(deps, path) {
+							deps = append(deps, path)
+						}
+						return esbuild.OnResolveResult{Path: path, External: true}, nil
+					}
+					return esbuild.OnResolveResult{Path: path, Namespace: "esm-build"}, nil
+				}
+				return esbuild.OnResolveResult{}, fmt.Errorf("could not import '%s' in %s format", path, format)
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: "esm-internal"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				var code []byte
+				var ok bool
+				if name, isNode := strings.CutPrefix(args.Path, "/node/"); isNode {
+					code, ok = unenvNodeRuntimeBulid[name]
+					if !ok && nodeBuiltinModules[strings.TrimSuffix(name, ".mjs")] {
+						code, ok = []byte("export default {}"), true
+					}
+				} else {
+					code, ok = getPolyfillModule(strings.TrimSuffix(strings.TrimPrefix(args.Path, "/polyfill/"), ".mjs"))
+				}
+				if !ok {
+					return esbuild.OnLoadResult{}, fmt.Errorf("module '%s' not found", args.Path)
+				}
+				contents := string(code)
+				return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderJS}, nil
+			})
+			// the dynamically imported module is a thenable that resolves to the module loaded by `_context.import`,
+			// the promise of the `import()` expression adopts it
+			build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: "esm-system-import"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				contents := fmt.Sprintf("export function then(resolve, reject) { return _context.import(%s).then(resolve, reject) }", utils.MustEncodeJSON(args.Path))
+				return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderJS}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: "esm-build"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				code, err := ctx.loadBuild(args.Path)
+				if err != nil {
+					return esbuild.OnLoadResult{}, fmt.Errorf("could not bundle '%s': %v", args.Path, err)
+				}
+				contents := string(code)
+				return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderJS}, nil
+			})
+		},
+	}
+	options := esbuild.BuildOptions{
+		Stdin: &esbuild.StdinOptions{
+			Contents: string(code),
+			// use ".js" extension to avoid the node-style interop of `.mjs` files
+			Sourcefile: strings.TrimSuffix(ctx.Path(), ".mjs") + ".js",
+			Loader:     esbuild.LoaderJS,
+		},
+		Bundle:            true,
+		Target:            target,
+		Engines:           engines,
+		Platform:          esbuild.PlatformBrowser,
+		MinifyWhitespace:  config.Minify,
+		MinifyIdentifiers: config.Minify,
+		MinifySyntax:      config.Minify,
+		KeepNames:         ctx.args.keepNames,
+		Plugins:           []esbuild.Plugin{plugin},
+		Outdir:            "/esbuild",
+		Write:             false,
+	}
+	if format == "iife" {
+		options.Format = esbuild.FormatIIFE
+		options.GlobalName = ctx.args.globalName
+	} else {
+		// convert to CommonJS and then wrap it with `System.register`
+		options.Format = esbuild.FormatCommonJS
+		options.Define = map[string]string{"import.meta": "__importMeta$"}
+	}
+	ret := esbuild.Build(options)
+	if len(ret.Errors) > 0 {
+		return nil, nil, errors.New("esbuild: " + ret.Errors[0].Text)
+	}
+	var js []byte
+	for _, file := range ret.OutputFiles {
+		if strings.HasSuffix(file.Path, ".js") {
+			js = file.Contents
+		}
+	}
+	if format == "iife" {
+		return js, nil, nil
+	}
+	depsJson, _ := json.Marshal(deps)
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("System.register(")
+	buf.Write(depsJson)
+	buf.WriteString(`,function(_export,_context){"use strict";var __deps$=[],__importMeta$=_context.meta;return{setters:`)
+	buf.WriteString(`[`)
+	for i := range deps {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "function(m){__deps$[%d]=m}", i)
+	}
+	buf.WriteString(`],execute:function(){var module={exports:{}},exports=module.exports,require=function(n){var i=`)
+	buf.Write(depsJson)
+	buf.WriteString(`.indexOf(n);if(i<0)throw new Error("Cannot find module '"+n+"'");return Object.assign({__esModule:true},__deps$[i])};`)
+	buf.WriteByte('\n')
+	buf.Write(js)
+	buf.WriteString("\n_export(module.exports)}}});\n")
+	return buf.Bytes(), imports, nil
+}
+
+// loadBuild loads the ES module of the build path, the module will be built if it doesn't exist.
+func (ctx *BuildContext) loadBuild(pathname string) ([]byte, error) {
+	b, err := newBuildContextFromPath(ctx.npmrc, ctx.logger, ctx.db, ctx.storage, pathname)
+	if err != nil {
+		return nil, err
+	}
+	if b.target == "types" {
+		return nil, errors.New("invalid build path")
+	}
+	_, ok, err := b.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if ctx.queue != nil {
+			// the build queue limits the concurrency and merges the same builds
+			err = ctx.queue.Wait(b).err
+		} else {
+			_, err = b.Build()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, _, err := ctx.storage.Get(b.getSavepath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
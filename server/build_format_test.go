@@ -0,0 +1,189 @@
+package server
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/esm-dev/esm.sh/server/storage"
+	"github.com/ije/gox/crypto/rand"
+	"github.com/ije/gox/log"
+	"github.com/ije/gox/utils"
+)
+
+func TestConvertFormat(t *testing.T) {
+	ctx := &BuildContext{
+		npmrc:  DefaultNpmRC(),
+		esm:    EsmPath{PkgName: "foo", PkgVersion: "1.0.0"},
+		target: "es2020",
+		args:   BuildArgs{format: "iife", globalName: "Foo.Bar"},
+	}
+	out, imports, err := ctx.convertFormat([]byte(`import process from "/node/process.mjs";
+import "/polyfill/array-at.mjs";
+export const env = process.env;
+export default [1, 2, 3].at(-1);
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imports) != 0 {
+		t.Fatalf("invalid imports %v, shoud be empty", imports)
+	}
+	js := string(out)
+	if strings.Contains(js, "/node/process.mjs") || strings.Contains(js, "/polyfill/array-at.mjs") {
+		t.Fatal("node modules and polyfills shoud be bundled")
+	}
+	if !strings.Contains(js, "Foo.Bar") {
+		t.Fatal("exports shoud be assigned to `Foo.Bar`")
+	}
+
+	_, _, err = ctx.convertFormat([]byte(`export * from "https://example.com/foo.js";`))
+	if err == nil || !strings.Contains(err.Error(), "could not import 'https://example.com/foo.js' in iife format") {
+		t.Fatalf("invalid error %v", err)
+	}
+
+	ctx.args = BuildArgs{format: "system"}
+	out, imports, err = ctx.convertFormat([]byte(`import React, { useState } from "/react@19.0.0/es2022/react.mjs";
+export { useState };
+export default React;
+export const url = import.meta.url;
+export const lazy = () => import("/lazy@1.0.0/es2022/lazy.mjs");
+export const text = 'import("/foo")';
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(imports, []string{"/react@19.0.0/es2022/react.mjs", "/lazy@1.0.0/es2022/lazy.mjs"}) {
+		t.Fatalf("invalid imports %v", imports)
+	}
+	js = string(out)
+	// the dynamic imports are not the dependencies of the SystemJS module
+	if !strings.HasPrefix(js, `System.register(["/react@19.0.0/es2022/react.mjs"],function(_export,_context){`) {
+		t.Fatalf("invalid system module: %s", js)
+	}
+	if !strings.Contains(js, `_context.import("/lazy@1.0.0/es2022/lazy.mjs")`) {
+		t.Fatal("dynamic imports shoud be loaded by `_context.import`")
+	}
+	if !strings.Contains(js, `'import("/foo")'`) {
+		t.Fatal("the string literals shoud not be rewritten")
+	}
+	if !strings.Contains(js, `throw new Error("Cannot find module '"+n+"'")`) {
+		t.Fatal("the `require` shim shoud throw for the missing dependencies")
+	}
+	if strings.Contains(js, "import.meta") {
+		t.Fatal("`import.meta` shoud be replaced")
+	}
+}
+
+func TestLoadBuild(t *testing.T) {
+	env := newTestBuildEnv(t, "format", map[string]string{
+		"npm/bar@1.0.0/node_modules/bar/package.json": `{"name":"bar","version":"1.0.0","type":"module","main":"index.js"}`,
+		"npm/bar@1.0.0/node_modules/bar/index.js":     `export default "bar@1.0.0"`,
+	})
+	workDir := config.WorkDir
+	defer func() { config.WorkDir = workDir }()
+	config.WorkDir = env.wd
+
+	// the only slot of the queue is taken by the running build
+	q := NewBuildQueue(1)
+	q.chann = 0
+	ctx := &BuildContext{npmrc: DefaultNpmRC(), logger: env.logger, db: env.db, storage: env.storage, queue: q}
+	code, err := ctx.loadBuild("/bar@1.0.0/es2022/bar.mjs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "bar@1.0.0") {
+		t.Fatalf("invalid build:\n%s", code)
+	}
+	// the slot is released while waiting, and taken back after the nested build is done
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.chann != 0 || q.debt != 0 || q.queue.Len() != 0 {
+		t.Fatalf("invalid queue state: chann=%d debt=%d tasks=%d", q.chann, q.debt, q.queue.Len())
+	}
+}
+
+func TestGlobalName(t *testing.T) {
+	for pkgName, expected := range map[string]string{
+		"react":          "react",
+		"react-dom":      "reactDom",
+		"@scope/foo.bar": "fooBar",
+		"3d-view":        "_3dView",
+	} {
+		if name := toGlobalName(pkgName); name != expected {
+			t.Fatalf("invalid global name '%s' of '%s', shoud be '%s'", name, pkgName, expected)
+		}
+	}
+	for name, valid := range map[string]bool{
+		"Foo":     true,
+		"Foo.Bar": true,
+		"$_foo1":  true,
+		"1foo":    false,
+		"Foo.":    false,
+		"foo-bar": false,
+		"a;b":     false,
+	} {
+		if isValidGlobalName(name) != valid {
+			t.Fatalf("isValidGlobalName('%s') shoud be %v", name, valid)
+		}
+	}
+}
+
+// testBuildEnv is the work directory, database, storage and logger of the build tests.
+type testBuildEnv struct {
+	wd      string
+	db      Database
+	storage storage.Storage
+	logger  *log.Logger
+}
+
+// newTestBuildEnv creates the build env in a temporary directory with the files, it's removed
+// when the test is done.
+func newTestBuildEnv(t *testing.T, name string, files map[string]string) *testBuildEnv {
+	wd := path.Join(os.TempDir(), name+"_test_"+rand.Hex.String(8))
+	t.Cleanup(func() { os.RemoveAll(wd) })
+	writeTestFiles(t, wd, files)
+	db, err := OpenBoltDB(path.Join(wd, "esm.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	buildStorage, err := storage.NewFSStorage(&storage.StorageOptions{Endpoint: path.Join(wd, "storage")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the logger without a writer prints to the console
+	logger, _ := log.New("")
+	return &testBuildEnv{wd: wd, db: db, storage: buildStorage, logger: logger}
+}
+
+// newBuildContext creates the build context of the package that is installed in the `wd`.
+func (env *testBuildEnv) newBuildContext(t *testing.T, wd string, esm EsmPath) *BuildContext {
+	var raw PackageJSONRaw
+	if err := utils.ParseJSONFile(path.Join(wd, "node_modules", esm.PkgName, "package.json"), &raw); err != nil {
+		t.Fatal(err)
+	}
+	return &BuildContext{
+		npmrc:   DefaultNpmRC(),
+		logger:  env.logger,
+		db:      env.db,
+		storage: env.storage,
+		esm:     esm,
+		target:  "es2022",
+		wd:      wd,
+		pkgJson: raw.ToNpmPackage(),
+	}
+}
+
+// writeTestFiles writes the files to the directory, the keys are the relative paths.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		filename := path.Join(dir, name)
+		os.MkdirAll(path.Dir(filename), 0755)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
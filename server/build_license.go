@@ -0,0 +1,225 @@
+package server
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/esm-dev/esm.sh/server/storage"
+	"github.com/ije/gox/log"
+	"github.com/ije/gox/set"
+)
+
+// BuildLicenses is the license list of the builds in a build directory, served at
+// `/<pkg>@<version>/<target>/LICENSES.json`.
+type BuildLicenses struct {
+	// package -> license, e.g. "react-dom@19.0.0" -> "MIT"
+	Licenses map[string]string `json:"licenses"`
+	// build path -> the packages that are included in the build
+	Builds map[string][]string `json:"builds"`
+}
+
+// getLegalCommentsSavepath returns the storage path of the legal comments that are extracted from the build.
+func (ctx *BuildContext) getLegalCommentsSavepath() string {
+	return ctx.getSavepath() + ".LEGAL.txt"
+}
+
+// getBuildPackages returns the package and the bundled dependencies in the format of "<name>@<version>",
+// and their licenses in the format of "<name>@<version> <license>", see `BuildMeta.Packages`.
+func (ctx *BuildContext) getBuildPackages(bundled map[string]*BuildAnalysisPackage) (packages []string, licenses []string) {
+	main := ctx.pkgJson.Name + "@" + ctx.pkgJson.Version
+	pkgLicenses := map[string]string{main: ctx.pkgJson.License}
+	for name, pkg := range bundled {
+		if name != ctx.pkgJson.Name && pkg.Version != "" {
+			pkgLicenses[name+"@"+pkg.Version] = pkg.License
+		}
+	}
+	// the packages that are bundled into the chunks
+	for _, s := range ctx.chunkLicenses {
+		pkg, license := parseBuildLicense(s)
+		pkgLicenses[pkg] = license
+	}
+	for _, pkg := range ctx.chunkPackages {
+		if _, ok := pkgLicenses[pkg]; !ok {
+			pkgLicenses[pkg] = ""
+		}
+	}
+	packages = make([]string, 0, len(pkgLicenses))
+	packages = append(packages, main)
+	for pkg := range pkgLicenses {
+		if pkg != main {
+			packages = append(packages, pkg)
+		}
+	}
+	sort.Strings(packages[1:])
+	licenses = make([]string, len(packages))
+	for i, pkg := range packages {
+		licenses[i] = formatBuildLicense(pkg, pkgLicenses[pkg])
+	}
+	return
+}
+
+// getInstalledPackages returns the installed dependencies that are not bundled into the build,
+// see `BuildMeta.Installed`.
+func (ctx *BuildContext) getInstalledPackages(bundled []string) []string {
+	seen := set.New(bundled...)
+	var installed []string
+	for _, p := range ctx.installedDeps {
+		pkg := p.Name + "@" + p.Version
+		if !seen.Has(pkg) {
+			seen.Add(pkg)
+			installed = append(installed, pkg)
+		}
+	}
+	sort.Strings(installed)
+	return installed
+}
+
+func formatBuildLicense(pkg string, license string) string {
+	if license == "" {
+		return pkg
+	}
+	return pkg + " " + license
+}
+
+// parseBuildLicense parses the license record of the build meta,
+// e.g. "react-dom@19.0.0 MIT" -> ("react-dom@19.0.0", "MIT").
+func parseBuildLicense(s string) (pkg string, license string) {
+	pkg, license, _ = strings.Cut(s, " ")
+	return
+}
+
+// listBuildLicenses lists the licenses of the builds in the build directory, e.g. "/react-dom@19.0.0/es2022".
+func listBuildLicenses(npmrc *NpmRC, logger *log.Logger, db Database, buildStorage storage.Storage, buildDir string) (*BuildLicenses, error) {
+	prefix := normalizeSavePath(npmrc.zoneId, path.Join("modules", buildDir)) + "/"
+	return walkBuildLicenses(npmrc, logger, db, buildStorage, prefix, buildDir+"/")
+}
+
+// walkBuildLicenses collects the licenses of the builds whose storage keys start with the prefix, the build
+// path is restored by replacing the prefix with the path prefix. Note the builds with hashed build args
+// can't be restored from the storage keys.
+func walkBuildLicenses(npmrc *NpmRC, logger *log.Logger, db Database, buildStorage storage.Storage, prefix string, pathPrefix string) (*BuildLicenses, error) {
+	// the fs storage lists the keys by the directory
+	keys, err := buildStorage.List(prefix[:strings.LastIndexByte(prefix, '/')+1])
+	if err != nil {
+		return nil, err
+	}
+	ret := &BuildLicenses{
+		Licenses: map[string]string{},
+		Builds:   map[string][]string{},
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, ".mjs") {
+			continue
+		}
+		buildPath := pathPrefix + strings.TrimPrefix(key, prefix)
+		b, err := newBuildContextFromPath(npmrc, logger, db, buildStorage, buildPath)
+		if err != nil {
+			continue
+		}
+		// the chunks and the tree-shaking results don't have the build meta
+		meta, ok, err := b.Exists()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || len(meta.Licenses) == 0 {
+			continue
+		}
+		packages := make([]string, len(meta.Licenses))
+		for i, s := range meta.Licenses {
+			pkg, license := parseBuildLicense(s)
+			ret.Licenses[pkg] = license
+			packages[i] = pkg
+		}
+		ret.Builds[buildPath] = packages
+	}
+	return ret, nil
+}
+
+// LicenseInventory is the license inventory of the builds of a package, served at `/_licenses?package=<name>`.
+type LicenseInventory struct {
+	// package -> license, e.g. "react-dom@19.0.0" -> "MIT"
+	Packages map[string]string `json:"packages"`
+	// license -> packages
+	Licenses map[string][]string `json:"licenses"`
+	// the packages that are not allowed by the current license policy
+	Denied []string `json:"denied"`
+}
+
+// licenseInventoryLock serializes the updates of the persisted license inventories.
+var licenseInventoryLock sync.Mutex
+
+// getLicenseInventoryKey returns the db key of the license inventory of the package.
+func getLicenseInventoryKey(zoneId string, pkgName string) string {
+	return zoneId + ":licenses:" + pkgName
+}
+
+// saveLicenseInventory merges the licenses of a build into the persisted license inventory of the package,
+// the inventory is stored as the license records, one per line.
+func saveLicenseInventory(db Database, zoneId string, pkgName string, licenses []string) error {
+	if len(licenses) == 0 {
+		return nil
+	}
+	licenseInventoryLock.Lock()
+	defer licenseInventoryLock.Unlock()
+
+	key := getLicenseInventoryKey(zoneId, pkgName)
+	data, err := db.Get(key)
+	if err != nil {
+		return err
+	}
+	records := []string{}
+	if len(data) > 0 {
+		records = strings.Split(string(data), "\n")
+	}
+	seen := set.New(records...)
+	n := len(records)
+	for _, s := range licenses {
+		if !seen.Has(s) {
+			seen.Add(s)
+			records = append(records, s)
+		}
+	}
+	if len(records) == n {
+		return nil
+	}
+	sort.Strings(records)
+	return db.Put(key, []byte(strings.Join(records, "\n")))
+}
+
+// getLicenseInventory returns the license inventory of the builds of the package, it reads the inventory
+// that is persisted when the builds are saved instead of scanning the storage.
+func getLicenseInventory(npmrc *NpmRC, db Database, pkgName string) (*LicenseInventory, error) {
+	data, err := db.Get(getLicenseInventoryKey(npmrc.zoneId, pkgName))
+	if err != nil {
+		return nil, err
+	}
+	inventory := &LicenseInventory{
+		Packages: map[string]string{},
+		Licenses: map[string][]string{},
+		Denied:   []string{},
+	}
+	if len(data) == 0 {
+		return inventory, nil
+	}
+	for _, s := range strings.Split(string(data), "\n") {
+		pkg, license := parseBuildLicense(s)
+		inventory.Packages[pkg] = license
+	}
+	for pkg, license := range inventory.Packages {
+		key := license
+		if key == "" {
+			key = "UNKNOWN"
+		}
+		inventory.Licenses[key] = append(inventory.Licenses[key], pkg)
+		if checkLicensePolicy(pkg, license) != nil {
+			inventory.Denied = append(inventory.Denied, pkg)
+		}
+	}
+	for _, packages := range inventory.Licenses {
+		sort.Strings(packages)
+	}
+	sort.Strings(inventory.Denied)
+	return inventory, nil
+}
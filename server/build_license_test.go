@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLicenseString(t *testing.T) {
+	for raw, expected := range map[string]string{
+		`{"license":"MIT"}`: "MIT",
+		`{"license":{"type":"ISC","url":"https://x.com"}}`:    "ISC",
+		`{"licenses":[{"type":"MIT"},{"type":"Apache-2.0"}]}`: "(MIT OR Apache-2.0)",
+		`{"licenses":[{"type":"BSD-3-Clause"}]}`:              "BSD-3-Clause",
+		`{}`:                                                  "",
+	} {
+		var p PackageJSONRaw
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			t.Fatal(err)
+		}
+		if license := p.LicenseString(); license != expected {
+			t.Fatalf("invalid license '%s' of %s, shoud be '%s'", license, raw, expected)
+		}
+	}
+}
+
+func TestBuildLicenses(t *testing.T) {
+	env := newTestBuildEnv(t, "license", map[string]string{
+		"node_modules/foo/package.json": `{"name":"foo","version":"1.0.0","type":"module","main":"index.js","types":"index.d.ts","license":"MIT","dependencies":{"bar":"^2.0.0"}}`,
+		"node_modules/foo/index.d.ts":   `export {}`,
+		"node_modules/foo/index.js":     "/*! foo v1.0.0 | MIT License */\nimport { bar } from \"bar\"; export const foo = () => bar()",
+		"node_modules/bar/package.json": `{"name":"bar","version":"2.0.0","type":"module","main":"index.js","licenses":[{"type":"MIT"},{"type":"Apache-2.0"}]}`,
+		"node_modules/bar/index.js":     "/*! bar v2.0.0 | (MIT OR Apache-2.0) */\nexport const bar = () => \"bar\"",
+	})
+
+	ctx := env.newBuildContext(t, env.wd, EsmPath{PkgName: "foo", PkgVersion: "1.0.0"})
+	ctx.bundleMode = BundleDeps
+	meta, err := ctx.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Licenses) != 2 || meta.Licenses[0] != "foo@1.0.0 MIT" || meta.Licenses[1] != "bar@2.0.0 (MIT OR Apache-2.0)" {
+		t.Fatalf("invalid licenses %v", meta.Licenses)
+	}
+
+	// the legal comments are moved to the `.LEGAL.txt` file
+	f, _, err := env.storage.Get(ctx.getSavepath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := io.ReadAll(f)
+	f.Close()
+	if strings.Contains(string(code), "MIT License") {
+		t.Fatalf("the legal comments shoud be removed from the build:\n%s", code)
+	}
+	f, _, err = env.storage.Get(ctx.getLegalCommentsSavepath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	legal, _ := io.ReadAll(f)
+	f.Close()
+	if !strings.Contains(string(legal), "foo v1.0.0 | MIT License") || !strings.Contains(string(legal), "bar v2.0.0") {
+		t.Fatalf("invalid legal comments:\n%s", legal)
+	}
+
+	// the build meta keeps the licenses
+	decoded, ok, err := ctx.Exists()
+	if err != nil || !ok {
+		t.Fatalf("build meta not found: %v", err)
+	}
+	if strings.Join(decoded.Licenses, ",") != strings.Join(meta.Licenses, ",") {
+		t.Fatalf("invalid decoded licenses %v", decoded.Licenses)
+	}
+	if strings.Join(decoded.Packages, ",") != "foo@1.0.0,bar@2.0.0" {
+		t.Fatalf("invalid decoded packages %v", decoded.Packages)
+	}
+
+	// the build metas saved before the packages are recorded
+	legacy, err := decodeBuildMeta([]byte("ESM\r\nl:foo@1.0.0 MIT\nl:bar@2.0.0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(legacy.Packages, ",") != "foo@1.0.0,bar@2.0.0" {
+		t.Fatalf("invalid legacy packages %v", legacy.Packages)
+	}
+
+	ret, err := listBuildLicenses(ctx.npmrc, env.logger, env.db, env.storage, "/foo@1.0.0"+ctx.getBuildArgsPrefix(false)+"/es2022")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Licenses["foo@1.0.0"] != "MIT" || ret.Licenses["bar@2.0.0"] != "(MIT OR Apache-2.0)" {
+		t.Fatalf("invalid licenses %v", ret.Licenses)
+	}
+	if pkgs := ret.Builds[ctx.Path()]; len(pkgs) != 2 || pkgs[0] != "foo@1.0.0" {
+		t.Fatalf("invalid builds %v", ret.Builds)
+	}
+
+	// check the license policy
+	policy := config.LicensePolicy
+	defer func() { config.LicensePolicy = policy }()
+	config.LicensePolicy = LicensePolicy{Deny: []string{"MIT"}}
+	if err := checkBuildLicenses(meta.Licenses); !isLicensePolicyError(err) || !strings.Contains(err.Error(), "'foo@1.0.0'") {
+		t.Fatalf("the build shoud be denied by the license policy: %v", err)
+	}
+	inventory, err := getLicenseInventory(ctx.npmrc, env.db, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory.Packages) != 2 || len(inventory.Licenses["MIT"]) != 1 || len(inventory.Denied) != 1 || inventory.Denied[0] != "foo@1.0.0" {
+		t.Fatalf("invalid license inventory %v", inventory)
+	}
+	if inventory, _ = getLicenseInventory(ctx.npmrc, env.db, "bar"); len(inventory.Packages) != 0 {
+		t.Fatalf("invalid license inventory of 'bar' %v", inventory)
+	}
+	ctx.dev = true
+	ctx.path = ""
+	if _, err := ctx.Build(); !isLicensePolicyError(err) {
+		t.Fatalf("the build shoud fail with the license policy error: %v", err)
+	}
+}
@@ -16,6 +16,12 @@ type BuildMeta struct {
 	CSSEntry      string
 	Dts           string
 	Imports       []string
+	// the package and the bundled dependencies, e.g. "react-dom@19.0.0"
+	Packages []string
+	// the licenses of the package and the bundled dependencies, e.g. "react-dom@19.0.0 MIT"
+	Licenses []string
+	// the installed dependencies that are not bundled, their advisories are reported but not blocked
+	Installed []string
 }
 
 func encodeBuildMeta(meta *BuildMeta) []byte {
@@ -50,6 +56,21 @@ func encodeBuildMeta(meta *BuildMeta) []byte {
 			buf.WriteByte('\n')
 		}
 	}
+	for _, pkg := range meta.Packages {
+		buf.Write([]byte{'p', ':'})
+		buf.WriteString(pkg)
+		buf.WriteByte('\n')
+	}
+	for _, license := range meta.Licenses {
+		buf.Write([]byte{'l', ':'})
+		buf.WriteString(license)
+		buf.WriteByte('\n')
+	}
+	for _, pkg := range meta.Installed {
+		buf.Write([]byte{'n', ':'})
+		buf.WriteString(pkg)
+		buf.WriteByte('\n')
+	}
 	return buf.Bytes()
 }
 
@@ -96,9 +117,22 @@ func decodeBuildMeta(data []byte) (*BuildMeta, error) {
 				}
 			}
 			meta.Imports = append(meta.Imports, importSepcifier)
+		case ll > 2 && line[0] == 'p' && line[1] == ':':
+			meta.Packages = append(meta.Packages, string(line[2:]))
+		case ll > 2 && line[0] == 'l' && line[1] == ':':
+			meta.Licenses = append(meta.Licenses, string(line[2:]))
+		case ll > 2 && line[0] == 'n' && line[1] == ':':
+			meta.Installed = append(meta.Installed, string(line[2:]))
 		default:
 			return nil, errors.New("invalid build meta")
 		}
 	}
+	// the build metas saved before the packages are recorded
+	if len(meta.Packages) == 0 && len(meta.Licenses) > 0 {
+		meta.Packages = make([]string, len(meta.Licenses))
+		for i, s := range meta.Licenses {
+			meta.Packages[i], _ = parseBuildLicense(s)
+		}
+	}
 	return meta, nil
 }
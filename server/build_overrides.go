@@ -0,0 +1,231 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// The dependency overrides are stored as a flat map of `selector -> version`, the selector is
+// a chain of the package names separated by `>`, and each package name may have a version range:
+//
+//	"bar": "2.0.0"                   // overrides `bar` in the whole dependency graph
+//	"foo>bar": "2.0.0"               // overrides `bar` only when it's a dependency of `foo`
+//	"foo@^1.0.0>bar@^1.0.0": "1.2.0" // overrides `bar@^1.0.0` of `foo@^1.0.0`
+//
+// see https://docs.npmjs.com/cli/v10/configuring-npm/package-json#overrides
+// and https://classic.yarnpkg.com/lang/en/docs/selective-version-resolutions/
+
+// parseOverrideSelector splits the selector segment into the package name and the version range.
+func parseOverrideSelector(segment string) (pkgName string, versionRange string) {
+	segment = strings.TrimSpace(segment)
+	if i := strings.IndexByte(segment[min(1, len(segment)):], '@'); i >= 0 {
+		i++
+		return segment[:i], strings.TrimSpace(segment[i+1:])
+	}
+	return segment, ""
+}
+
+// validateOverride checks the selector and the version of the override rule, the rules are encoded
+// as `selector:version` lines of the build args, so the selector can't contain `:` or `,`, and
+// neither can contain the control characters.
+func validateOverride(selector string, version string) bool {
+	if selector == "" || version == "" || strings.ContainsAny(selector, ":,") || strings.ContainsRune(version, ',') {
+		return false
+	}
+	if strings.ContainsFunc(selector, unicode.IsControl) || strings.ContainsFunc(version, unicode.IsControl) {
+		return false
+	}
+	for _, segment := range strings.Split(selector, ">") {
+		pkgName, _ := parseOverrideSelector(segment)
+		if !validatePackageName(pkgName) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNpmOverrides flattens the nested npm `overrides` object, the `.` key overrides the
+// parent package itself, the `$name` reference is resolved with the given dependencies.
+func parseNpmOverrides(overrides map[string]any, parent string, dependencies map[string]string, ret map[string]string) {
+	for key, value := range overrides {
+		selector := strings.TrimSpace(key)
+		if key == "." {
+			selector = parent
+		} else if parent != "" {
+			selector = parent + ">" + selector
+		}
+		switch v := value.(type) {
+		case string:
+			v = strings.TrimSpace(v)
+			if strings.HasPrefix(v, "$") {
+				v = dependencies[v[1:]]
+			}
+			if validateOverride(selector, v) {
+				ret[selector] = v
+			}
+		case map[string]any:
+			if key != "." {
+				parseNpmOverrides(v, selector, dependencies, ret)
+			}
+		}
+	}
+}
+
+// parseYarnResolutions converts the yarn `resolutions` to the override rules, e.g.
+// `**/foo/bar` -> `foo>bar`, `@scope/foo/bar` -> `@scope/foo>bar`.
+func parseYarnResolutions(resolutions map[string]any, ret map[string]string) {
+	for key, value := range resolutions {
+		version, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var segments []string
+		parts := strings.Split(strings.TrimSpace(key), "/")
+		for i := 0; i < len(parts); i++ {
+			part := parts[i]
+			if part == "**" || part == "" {
+				continue
+			}
+			if strings.HasPrefix(part, "@") && i+1 < len(parts) {
+				part += "/" + parts[i+1]
+				i++
+			}
+			segments = append(segments, part)
+		}
+		selector := strings.Join(segments, ">")
+		version = strings.TrimSpace(version)
+		if validateOverride(selector, version) {
+			ret[selector] = version
+		}
+	}
+}
+
+// getPackageOverrides returns the override rules that are declared in the `esm.sh` field
+// of the package.json, e.g.
+//
+//	"esm.sh": {
+//	  "overrides": { "foo": { "bar": "2.0.0" } },
+//	  "resolutions": { "**/baz": "1.0.0" }
+//	}
+func getPackageOverrides(pkgJson *PackageJSON) map[string]string {
+	if pkgJson == nil || pkgJson.Esmsh == nil {
+		return nil
+	}
+	rules := map[string]string{}
+	if m := toMap(pkgJson.Esmsh["resolutions"]); m != nil {
+		parseYarnResolutions(m, rules)
+	}
+	// npm `overrides` take precedence over the yarn `resolutions`
+	if m := toMap(pkgJson.Esmsh["overrides"]); m != nil {
+		dependencies := map[string]string{}
+		for name, version := range pkgJson.PeerDependencies {
+			dependencies[name] = version
+		}
+		for name, version := range pkgJson.Dependencies {
+			dependencies[name] = version
+		}
+		parseNpmOverrides(m, "", dependencies, rules)
+	}
+	return rules
+}
+
+// matchOverrideSelector checks if the dependency matches the selector segment, the version
+// of the dependency is resolved when the segment has a version range.
+func matchOverrideSelector(npmrc *NpmRC, segment string, pkgName string, pkgVersion string) bool {
+	name, versionRange := parseOverrideSelector(segment)
+	if name != pkgName {
+		return false
+	}
+	if versionRange == "" || versionRange == "*" {
+		return true
+	}
+	c, err := semver.NewConstraint(versionRange)
+	if err != nil {
+		return false
+	}
+	if !isExactVersion(pkgVersion) {
+		if npmrc == nil || strings.ContainsRune(pkgVersion, ':') {
+			return false
+		}
+		p, err := npmrc.getPackageInfo(pkgName, pkgVersion)
+		if err != nil {
+			return false
+		}
+		pkgVersion = p.Version
+	}
+	v, err := semver.NewVersion(pkgVersion)
+	return err == nil && c.Check(v)
+}
+
+// resolveOverride returns the overridden version of the dependency, the rules with version
+// range are checked before the plain ones.
+func resolveOverride(npmrc *NpmRC, overrides map[string]string, pkgName string, pkgVersion string) (version string, ok bool) {
+	var selectors []string
+	for selector := range overrides {
+		if !strings.ContainsRune(selector, '>') && strings.HasPrefix(selector, pkgName) {
+			selectors = append(selectors, selector)
+		}
+	}
+	// the longer selector is more specific
+	sort.Slice(selectors, func(i, j int) bool {
+		if len(selectors[i]) == len(selectors[j]) {
+			return selectors[i] < selectors[j]
+		}
+		return len(selectors[i]) > len(selectors[j])
+	})
+	for _, selector := range selectors {
+		if matchOverrideSelector(npmrc, selector, pkgName, pkgVersion) {
+			return overrides[selector], true
+		}
+	}
+	return "", false
+}
+
+// narrowOverrides returns the override rules for the dependencies of the given package,
+// the rules starting with the package are narrowed to its dependencies.
+func narrowOverrides(npmrc *NpmRC, overrides map[string]string, pkgName string, pkgVersion string) map[string]string {
+	if len(overrides) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(overrides))
+	narrowed := map[string]string{}
+	for selector, version := range overrides {
+		ret[selector] = version
+		if first, rest, ok := strings.Cut(selector, ">"); ok && matchOverrideSelector(npmrc, first, pkgName, pkgVersion) {
+			narrowed[rest] = version
+		}
+	}
+	// the narrowed rules are more specific than the global ones
+	for selector := range ret {
+		if !strings.ContainsRune(selector, '>') {
+			name, _ := parseOverrideSelector(selector)
+			for s := range narrowed {
+				if n, _ := parseOverrideSelector(s); n == name && !strings.ContainsRune(s, '>') {
+					delete(ret, selector)
+					break
+				}
+			}
+		}
+	}
+	for selector, version := range narrowed {
+		ret[selector] = version
+	}
+	return ret
+}
+
+// mergeOverrides merges the override rules, the later ones take precedence.
+func mergeOverrides(rules ...map[string]string) map[string]string {
+	var ret map[string]string
+	for _, m := range rules {
+		for selector, version := range m {
+			if ret == nil {
+				ret = map[string]string{}
+			}
+			ret[selector] = version
+		}
+	}
+	return ret
+}
@@ -14,19 +14,23 @@ var taskPool = sync.Pool{
 
 // BuildQueue schedules build tasks of esm.sh
 type BuildQueue struct {
-	lock  sync.Mutex
-	tasks map[string]*BuildTask
-	queue *list.List
-	chann uint16
+	lock        sync.Mutex
+	tasks       map[string]*BuildTask
+	queue       *list.List
+	chann       uint16
+	concurrency uint16
+	// the slots that are taken over the concurrency by the nested builds, see `Wait`
+	debt uint16
 }
 
 type BuildTask struct {
-	ctx       *BuildContext
-	el        *list.Element
-	waitChans []chan BuildOutput
-	createdAt time.Time
-	startedAt time.Time
-	pending   bool
+	ctx         *BuildContext
+	el          *list.Element
+	waitChans   []chan BuildOutput
+	createdAt   time.Time
+	startedAt   time.Time
+	pending     bool
+	lowPriority bool
 }
 
 type BuildOutput struct {
@@ -36,14 +40,25 @@ type BuildOutput struct {
 
 func NewBuildQueue(concurrency int) *BuildQueue {
 	return &BuildQueue{
-		queue: list.New(),
-		tasks: map[string]*BuildTask{},
-		chann: uint16(concurrency),
+		queue:       list.New(),
+		tasks:       map[string]*BuildTask{},
+		chann:       uint16(concurrency),
+		concurrency: uint16(concurrency),
 	}
 }
 
 // Add adds a new build task to the queue.
 func (q *BuildQueue) Add(ctx *BuildContext) chan BuildOutput {
+	return q.add(ctx, false)
+}
+
+// AddLowPriority adds a new build task that runs only when there is no pending task, e.g. the
+// warm-up builds. The task is promoted if the same build is requested by `Add`.
+func (q *BuildQueue) AddLowPriority(ctx *BuildContext) chan BuildOutput {
+	return q.add(ctx, true)
+}
+
+func (q *BuildQueue) add(ctx *BuildContext, lowPriority bool) chan BuildOutput {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
@@ -52,6 +67,12 @@ func (q *BuildQueue) Add(ctx *BuildContext) chan BuildOutput {
 	task, ok := q.tasks[ctx.Path()]
 	if ok {
 		task.waitChans = append(task.waitChans, ch)
+		if task.lowPriority && !lowPriority {
+			task.lowPriority = false
+			if task.pending {
+				go q.schedule()
+			}
+		}
 		return ch
 	}
 
@@ -60,6 +81,7 @@ func (q *BuildQueue) Add(ctx *BuildContext) chan BuildOutput {
 	task.createdAt = time.Now()
 	task.waitChans = []chan BuildOutput{ch}
 	task.pending = true
+	task.lowPriority = lowPriority
 	ctx.status = "pending"
 
 	task.el = q.queue.PushBack(task)
@@ -70,20 +92,61 @@ func (q *BuildQueue) Add(ctx *BuildContext) chan BuildOutput {
 	return ch
 }
 
+// Wait adds the build task that is required by a running build, e.g. the dependencies of IIFE builds, and
+// waits for the output. The slot of the running build is released while waiting to avoid the deadlock of
+// the nested builds, and it's taken back (over the concurrency if the queue is full) after the output is ready.
+func (q *BuildQueue) Wait(ctx *BuildContext) BuildOutput {
+	ch := q.Add(ctx)
+	q.lock.Lock()
+	q.releaseSlot()
+	q.lock.Unlock()
+	go q.schedule()
+
+	output := <-ch
+
+	q.lock.Lock()
+	if q.chann > 0 {
+		q.chann -= 1
+	} else {
+		q.debt += 1
+	}
+	q.lock.Unlock()
+	return output
+}
+
+// releaseSlot releases a slot of the queue, the caller must hold the lock.
+func (q *BuildQueue) releaseSlot() {
+	if q.debt > 0 {
+		q.debt -= 1
+	} else {
+		q.chann += 1
+	}
+}
+
 func (q *BuildQueue) schedule() {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
 	var task *BuildTask
+	var lowPriorityTask *BuildTask
 	if q.chann > 0 {
 		for el := q.queue.Front(); el != nil; el = el.Next() {
 			t, ok := el.Value.(*BuildTask)
 			if ok && t.pending {
-				task = t
-				break
+				if !t.lowPriority {
+					task = t
+					break
+				}
+				if lowPriorityTask == nil {
+					lowPriorityTask = t
+				}
 			}
 		}
 	}
+	// keep a slot for the incoming requests unless the queue is idle
+	if task == nil && lowPriorityTask != nil && (q.chann > 1 || q.chann == q.concurrency) {
+		task = lowPriorityTask
+	}
 
 	if task != nil {
 		q.chann -= 1
@@ -94,6 +157,7 @@ func (q *BuildQueue) schedule() {
 }
 
 func (q *BuildQueue) run(task *BuildTask) {
+	task.ctx.queue = q
 	meta, err := task.ctx.Build()
 	if err != nil {
 		// another shot if failed to resolve build entry
@@ -119,7 +183,7 @@ func (q *BuildQueue) run(task *BuildTask) {
 		// the `Build` function may have changed the path
 		delete(q.tasks, task.ctx.rawPath)
 	}
-	q.chann += 1
+	q.releaseSlot()
 	q.lock.Unlock()
 
 	waitChans := task.waitChans
@@ -131,6 +195,7 @@ func (q *BuildQueue) run(task *BuildTask) {
 	task.createdAt = time.Time{}
 	task.startedAt = time.Time{}
 	task.pending = false
+	task.lowPriority = false
 	taskPool.Put(task)
 
 	// schedule next task if have any
@@ -37,23 +37,31 @@ func (entry *BuildEntry) update(main string, module bool) {
 
 func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 	pkgJson := ctx.pkgJson
+	ctx.tracef("resolve the entry of '%s' for target '%s'", esm.Specifier(), ctx.target)
 
 	if subPath := esm.SubPath; subPath != "" {
 		if endsWith(subPath, ".d.ts", ".d.mts", ".d.cts") {
+			ctx.tracef("the sub-path '%s' is a declaration file", subPath)
 			entry.types = normalizeEntryPath(subPath)
 			return
 		}
 
 		switch ext := path.Ext(subPath); ext {
 		case ".mts", ".ts", ".tsx", ".cts":
+			ctx.tracef("the sub-path '%s' is a typescript module", subPath)
 			entry.update(subPath, true)
 			// entry.types = strings.TrimSuffix(subPath, ext) + ".d" + strings.TrimSuffix(ext,"x")
+			// use the original `.ts` source as types for deno.land/x modules
+			if _, ok := splitDenoXPackageName(esm.PkgName); ok && !strings.HasSuffix(subPath, ".tsx") {
+				entry.types = normalizeEntryPath(subPath)
+			}
 			// lookup jsr built dts
 			if strings.HasPrefix(esm.PkgName, "@jsr/") {
 				for _, v := range pkgJson.Exports.values {
 					if obj, ok := v.(JSONObject); ok {
 						if v, ok := obj.Get("default"); ok {
-							if s, ok := v.(string); ok && s == "./"+stripModuleExt(subPath)+".js" {
+							// the native JSR packages use the original `.ts` sources as the types
+							if s, ok := v.(string); ok && (s == "./"+stripModuleExt(subPath)+".js" || s == "./"+subPath) {
 								if v, ok := obj.Get("types"); ok {
 									if s, ok := v.(string); ok {
 										entry.types = normalizeEntryPath(s)
@@ -67,6 +75,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			}
 			return
 		case ".json", ".jsx", ".svelte", ".vue":
+			ctx.tracef("use the sub-path '%s' as the entry", subPath)
 			entry.update(subPath, true)
 			return
 		default:
@@ -81,6 +90,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			var exportEntry BuildEntry
 			conditions, ok := pkgJson.Exports.Get("./" + subModuleName)
 			if ok {
+				ctx.tracef("exports[\"./%s\"] = %s", subModuleName, traceJSON(conditions))
 				if s, ok := conditions.(string); ok {
 					/**
 					exports: {
@@ -104,6 +114,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 				for _, name := range pkgJson.Exports.keys {
 					conditions := pkgJson.Exports.values[name]
 					if stripEntryModuleExt(name) == "./"+subModuleName {
+						ctx.tracef("exports[\"%s\"] = %s", name, traceJSON(conditions))
 						if s, ok := conditions.(string); ok {
 							/**
 							exports: {
@@ -125,6 +136,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 						}
 						break
 					} else if diff, ok := matchAsteriskExport(name, subModuleName); ok {
+						ctx.tracef("exports[\"%s\"] = %s, matches '*' with '%s'", name, traceJSON(conditions), diff)
 						if s, ok := conditions.(string); ok {
 							/**
 							exports: {
@@ -174,6 +186,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 					}
 				}
 			}
+			ctx.traceExportEntry(exportEntry)
 			if exportEntry.main != "" && ctx.existsPkgFile(exportEntry.main) {
 				entry.update(exportEntry.main, exportEntry.module)
 			}
@@ -188,8 +201,10 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			p := rawInfo.ToNpmPackage()
 			if entry.main == "" {
 				if p.Module != "" && ctx.existsPkgFile(subModuleName, p.Module) {
+					ctx.tracef("use the `module` field of '%s/package.json': '%s'", subModuleName, p.Module)
 					entry.update("./"+path.Join(subModuleName, p.Module), true)
 				} else if p.Main != "" && ctx.existsPkgFile(subModuleName, p.Main) {
+					ctx.tracef("use the `main` field of '%s/package.json': '%s'", subModuleName, p.Main)
 					entry.update("./"+path.Join(subModuleName, p.Main), p.Type == "module")
 				}
 			}
@@ -202,6 +217,12 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			}
 		}
 
+		// the CSS file of the package, e.g. "dist/style.css"
+		if entry.main == "" && strings.HasSuffix(subModuleName, ".css") && ctx.existsPkgFile(subModuleName) {
+			ctx.tracef("the sub-module is a CSS file")
+			entry.update("./"+subModuleName, false)
+		}
+
 		// lookup entry from the sub-module directory if it's not defined in `package.json`
 		if entry.main == "" {
 			for _, ext := range []string{"mjs", "js", "cjs", "mts", "ts", "tsx", "cts"} {
@@ -214,6 +235,9 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 					break
 				}
 			}
+			if entry.main != "" {
+				ctx.tracef("found the sub-module file '%s'", entry.main)
+			}
 		}
 
 		if entry.main == "" && len(ctx.pkgJson.Imports) > 0 {
@@ -229,6 +253,9 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 							break
 						}
 					}
+					if entry.main != "" {
+						ctx.tracef("found the sub-module file '%s' by the `imports` field", entry.main)
+					}
 				}
 			}
 		}
@@ -269,9 +296,15 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			}
 		}
 	} else {
+		ctx.tracef("package.json: module=%q main=%q type=%q types=%q typings=%q", pkgJson.Module, pkgJson.Main, pkgJson.Type, pkgJson.Types, pkgJson.Typings)
 		if pkgJson.Module != "" && ctx.existsPkgFile(pkgJson.Module) {
+			ctx.tracef("use the `module` field")
 			entry.update(pkgJson.Module, true)
 		} else if pkgJson.Main != "" {
+			if pkgJson.Module != "" {
+				ctx.tracef("the `module` field '%s' doesn't exist", pkgJson.Module)
+			}
+			ctx.tracef("use the `main` field")
 			entry.update(pkgJson.Main, pkgJson.Type == "module")
 		}
 		if pkgJson.Types != "" {
@@ -281,6 +314,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 		}
 		if len(pkgJson.Browser) > 0 && ctx.isBrowserTarget() {
 			if path, ok := pkgJson.Browser["."]; ok && ctx.existsPkgFile(path) {
+				ctx.tracef("browser[\".\"] remaps the entry to '%s'", path)
 				entry.update(path, pkgJson.Type == "module")
 			}
 		}
@@ -289,6 +323,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			exportEntry := BuildEntry{}
 			v, ok := exports.Get(".")
 			if ok {
+				ctx.tracef("exports[\".\"] = %s", traceJSON(v))
 				if s, ok := v.(string); ok {
 					/**
 					exports: {
@@ -314,8 +349,10 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 					"import": "./esm/index.js"
 				}
 				*/
+				ctx.tracef("exports = %s", traceJSON(exports))
 				exportEntry = ctx.resolveConditionExportEntry(exports, pkgJson.Type)
 			}
+			ctx.traceExportEntry(exportEntry)
 			if exportEntry.main != "" && ctx.existsPkgFile(exportEntry.main) {
 				entry.update(exportEntry.main, exportEntry.module)
 			}
@@ -333,6 +370,9 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			} else if ctx.existsPkgFile("index.cjs") {
 				entry.update("./index.cjs", false)
 			}
+			if entry.main != "" {
+				ctx.tracef("found the index file '%s'", entry.main)
+			}
 		}
 
 		// lookup entry main from `src` directory
@@ -340,6 +380,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 			for _, ext := range []string{"mts", "ts", "mjs", "js", "tsx", "cts", "cjs"} {
 				filename := "./src/index." + ext
 				if ctx.existsPkgFile(filename) {
+					ctx.tracef("found the index file '%s' in the `src` directory", filename)
 					entry.update(filename, ext != "cjs" && ext != "cts")
 					break
 				}
@@ -380,6 +421,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 	if len(pkgJson.Browser) > 0 && ctx.isBrowserTarget() {
 		if entry.main != "" {
 			if path, ok := pkgJson.Browser[entry.main]; ok && ctx.existsPkgFile(path) {
+				ctx.tracef("browser[%q] remaps the entry to '%s'", entry.main, path)
 				entry.update(path, pkgJson.Type == "module")
 			}
 		}
@@ -447,6 +489,7 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 									entry.types = prefix + types[2:]
 								}
 							}
+							ctx.tracef("typesVersions[%q] maps the types '%s' to '%s'", versions[versions.Len()-1], types, entry.types)
 						}
 					}
 				}
@@ -454,7 +497,11 @@ func (ctx *BuildContext) resolveEntry(esm EsmPath) (entry BuildEntry) {
 		}
 	}
 
+	main, types := entry.main, entry.types
 	ctx.finalizeBuildEntry(&entry)
+	if entry.main != main || entry.types != types {
+		ctx.tracef("normalized the entry: main=%q types=%q", entry.main, entry.types)
+	}
 	return
 }
 
@@ -553,9 +600,12 @@ func (ctx *BuildContext) resolveConditionExportEntry(conditions JSONObject, pref
 		return
 	}
 
+	ctx.tracef("resolving conditions %v (prefered type: %q)", conditions.keys, preferedModuleType)
+
 	applyCondition := func(conditionName string) bool {
 		condition, ok := conditions.Get(conditionName)
 		if ok {
+			ctx.tracef("apply the %q condition", conditionName)
 			if s, ok := condition.(string); ok {
 				entry.update(s, preferedModuleType == "module")
 				return true
@@ -631,9 +681,11 @@ LOOP:
 			continue LOOP
 		default:
 			// skip unknown condition
+			ctx.tracef("skip the %q condition", conditionName)
 			continue LOOP
 		}
 		if entry.main == "" || (!entry.module && module && !conditionFound) {
+			ctx.tracef("use the %q condition", conditionName)
 			if s, ok := condition.(string); ok {
 				entry.update(s, module)
 			} else if obj, ok := condition.(JSONObject); ok {
@@ -688,8 +740,9 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 			PkgName:    pkgJson.Name,
 			PkgVersion: pkgJson.Version,
 			GhPrefix:   ctx.esm.GhPrefix,
+			GitHost:    ctx.esm.GitHost,
 			PrPrefix:   ctx.esm.PrPrefix,
-		}, ctx.getBuildArgsPrefix(false), ctx.externalAll)
+		}, ctx.getImportArgsPrefix(), ctx.externalAll)
 		return
 	}
 
@@ -710,6 +763,7 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 		subPath := strings.TrimPrefix(specifier, ctx.pkgJson.Name+"/")
 		subModule := EsmPath{
 			GhPrefix:      ctx.esm.GhPrefix,
+			GitHost:       ctx.esm.GitHost,
 			PrPrefix:      ctx.esm.PrPrefix,
 			PkgName:       ctx.esm.PkgName,
 			PkgVersion:    ctx.esm.PkgVersion,
@@ -725,7 +779,7 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 				}
 			}
 		} else {
-			resolvedPath = ctx.getImportPath(subModule, ctx.getBuildArgsPrefix(false), ctx.externalAll)
+			resolvedPath = ctx.getImportPath(subModule, ctx.getImportArgsPrefix(), ctx.externalAll)
 			if ctx.bundleMode == BundleFalse {
 				n, e := utils.SplitByLastByte(resolvedPath, '.')
 				resolvedPath = n + ".nobundle." + e
@@ -760,6 +814,12 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 		} else {
 			pkgVersion = "latest"
 		}
+		// apply the dependency overrides unless the version is specified by the `?deps` query
+		if _, ok := ctx.args.deps[pkgName]; !ok && pkgName != ctx.esm.PkgName {
+			if v, ok := ctx.resolveOverride(pkgName, pkgVersion); ok {
+				pkgVersion = v
+			}
+		}
 	}
 
 	dep := EsmPath{
@@ -780,6 +840,7 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 	}
 	if p.Name != "" {
 		dep.GhPrefix = p.Github
+		dep.GitHost = p.GitHost
 		dep.PrPrefix = p.PkgPrNew
 		dep.PkgName = p.Name
 		dep.PkgVersion = p.Version
@@ -788,7 +849,8 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 	// fetch the latest tag as the version of the repository
 	if dep.GhPrefix && dep.PkgVersion == "" {
 		var refs []GitRef
-		refs, err = listRepoRefs(fmt.Sprintf("https://github.com/%s", dep.PkgName))
+		gitHost, _ := getGitHost(dep.GitHost)
+		refs, err = listRepoRefs(gitHost.RemoteUrl(dep.GitHost, dep.PkgName), gitHost.GitEnv())
 		if err != nil {
 			return
 		}
@@ -828,8 +890,14 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 	args := BuildArgs{
 		alias:      ctx.args.alias,
 		deps:       ctx.args.deps,
+		overrides:  narrowOverrides(ctx.npmrc, ctx.getOverrides(), dep.PkgName, dep.PkgVersion),
 		external:   ctx.args.external,
 		conditions: ctx.args.conditions,
+		polyfill:   ctx.args.polyfill,
+	}
+	// the dependencies of SystemJS modules must be SystemJS modules as well
+	if ctx.args.format == "system" {
+		args.format = "system"
 	}
 	err = resolveBuildArgs(ctx.npmrc, ctx.wd, &args, dep)
 	if err != nil {
@@ -912,12 +980,17 @@ func (ctx *BuildContext) resolveExternalModule(specifier string, kind api.Resolv
 
 func (ctx *BuildContext) resolveDTS(entry BuildEntry) (string, error) {
 	if entry.types != "" {
-		return fmt.Sprintf(
+		dts := fmt.Sprintf(
 			"/%s/%s%s",
 			ctx.esm.Name(),
 			ctx.getBuildArgsPrefix(true),
 			strings.TrimPrefix(entry.types, "./"),
-		), nil
+		)
+		// serve the original `.ts` source as types, e.g. the native JSR packages
+		if !endsWith(dts, ".d.ts", ".d.mts", ".d.cts") && endsWith(dts, ".ts", ".mts", ".cts", ".tsx") {
+			dts += "?dts"
+		}
+		return dts, nil
 	}
 
 	if ctx.esm.SubPath != "" && (ctx.pkgJson.Types != "" || ctx.pkgJson.Typings != "") {
@@ -940,6 +1013,7 @@ func (ctx *BuildContext) resolveDTS(entry BuildEntry) (string, error) {
 		for _, version := range versions {
 			p, err := ctx.npmrc.getPackageInfo(typesPkgName, version)
 			if err == nil {
+				ctx.tracef("lookup types in the '%s@%s' package", typesPkgName, p.Version)
 				dtsModule := EsmPath{
 					PkgName:       typesPkgName,
 					PkgVersion:    p.Version,
@@ -953,6 +1027,7 @@ func (ctx *BuildContext) resolveDTS(entry BuildEntry) (string, error) {
 					args:        ctx.args,
 					externalAll: ctx.externalAll,
 					target:      "types",
+					trace:       ctx.trace,
 				}
 				err := b.install()
 				if err != nil {
@@ -1021,6 +1096,111 @@ func (ctx *BuildContext) getBuildArgsPrefix(isDts bool) string {
 	return ""
 }
 
+// getImportArgsPrefix returns the build args prefix of the modules that are imported by the build,
+// the imports of IIFE modules are ES modules that are bundled into the IIFE.
+func (ctx *BuildContext) getImportArgsPrefix() string {
+	if ctx.args.format == "iife" {
+		args := ctx.args
+		args.format = ""
+		args.globalName = ""
+		if a := encodeBuildArgs(args, false); a != "" {
+			return "X-" + a + "/"
+		}
+		return ""
+	}
+	return ctx.getBuildArgsPrefix(false)
+}
+
+// getOverrides returns the dependency overrides of the build, the `esm.sh` field of the
+// package.json is merged and the `?overrides` query takes precedence. The overrides are merged
+// once since the resolver calls this for every dependency.
+func (ctx *BuildContext) getOverrides() map[string]string {
+	ctx.overridesOnce.Do(func() {
+		ctx.overrides = mergeOverrides(getPackageOverrides(ctx.pkgJson), ctx.args.overrides)
+	})
+	return ctx.overrides
+}
+
+// resolveOverride returns the overridden version of the dependency of current package.
+func (ctx *BuildContext) resolveOverride(pkgName string, pkgVersion string) (string, bool) {
+	overrides := ctx.getOverrides()
+	if len(overrides) == 0 {
+		return "", false
+	}
+	version, ok := resolveOverride(ctx.npmrc, overrides, pkgName, pkgVersion)
+	if !ok && ctx.bundleMode == BundleDeps {
+		// dependencies are flattened in `bundle` mode, the nested selectors match any importer
+		for selector, v := range overrides {
+			if i := strings.LastIndexByte(selector, '>'); i > 0 && matchOverrideSelector(ctx.npmrc, selector[i+1:], pkgName, pkgVersion) {
+				return v, true
+			}
+		}
+	}
+	return version, ok
+}
+
+// isOverridden checks if the dependency is overridden, the overridden dependencies are not
+// bundled since the install directory of the package is shared by all builds.
+func (ctx *BuildContext) isOverridden(pkgName string) bool {
+	if _, ok := ctx.args.deps[pkgName]; ok || pkgName == ctx.esm.PkgName {
+		return false
+	}
+	spec := "latest"
+	if v, ok := ctx.pkgJson.Dependencies[pkgName]; ok {
+		spec = v
+	} else if v, ok := ctx.pkgJson.PeerDependencies[pkgName]; ok {
+		spec = v
+	}
+	_, ok := ctx.resolveOverride(pkgName, spec)
+	return ok
+}
+
+// isNativeOptionalDep checks if the dependency is a platform-specific optional dependency of
+// current package or the importer package, e.g. `@esbuild/linux-x64` of `esbuild`.
+func (ctx *BuildContext) isNativeOptionalDep(importer string, pkgName string) bool {
+	version, ok := ctx.pkgJson.OptionalDependencies[pkgName]
+	if !ok {
+		// check the importer package that is bundled
+		i := strings.LastIndex(importer, "/node_modules/")
+		if i < 0 {
+			return false
+		}
+		nodeModulesDir := importer[:i+len("/node_modules/")]
+		importerPkgName := toPackageName(importer[len(nodeModulesDir):])
+		if importerPkgName == ctx.esm.PkgName {
+			return false
+		}
+		version, ok = ctx.getOptionalDeps(path.Join(nodeModulesDir, importerPkgName))[pkgName]
+		if !ok {
+			return false
+		}
+	}
+	p, err := resolveDependencyVersion(version)
+	if err != nil || p.Github || p.PkgPrNew {
+		return false
+	}
+	if p.Name != "" {
+		pkgName, version = p.Name, p.Version
+	}
+	info, err := ctx.npmrc.getPackageInfo(pkgName, version)
+	return err == nil && info.IsPlatformSpecific()
+}
+
+// getOptionalDeps returns the optional dependencies of the package in the directory, the result
+// is memoized to avoid parsing the package.json for every import of the bundled package.
+func (ctx *BuildContext) getOptionalDeps(pkgDir string) map[string]string {
+	if v, ok := ctx.optionalDeps.Load(pkgDir); ok {
+		return v.(map[string]string)
+	}
+	var optionalDeps map[string]string
+	var raw PackageJSONRaw
+	if utils.ParseJSONFile(path.Join(pkgDir, "package.json"), &raw) == nil {
+		optionalDeps = raw.ToNpmPackage().OptionalDependencies
+	}
+	ctx.optionalDeps.Store(pkgDir, optionalDeps)
+	return optionalDeps
+}
+
 func (ctx *BuildContext) getNodeEnv() string {
 	if ctx.dev {
 		return "development"
@@ -1033,7 +1213,7 @@ func (ctx *BuildContext) isDenoTarget() bool {
 }
 
 func (ctx *BuildContext) isBrowserTarget() bool {
-	return strings.HasPrefix(ctx.target, "es")
+	return strings.HasPrefix(ctx.target, "es") || isEngineTarget(ctx.target)
 }
 
 func (ctx *BuildContext) existsPkgFile(fp ...string) bool {
@@ -1061,6 +1241,31 @@ lookup:
 		return
 	}
 
+	if version == "" && pkgName != ctx.esm.PkgName {
+		spec := "latest"
+		if v, ok := ctx.pkgJson.Dependencies[pkgName]; ok {
+			spec = v
+		} else if v, ok := ctx.pkgJson.PeerDependencies[pkgName]; ok {
+			spec = v
+		}
+		if v, ok := ctx.resolveOverride(pkgName, spec); ok {
+			name := pkgName
+			if strings.HasPrefix(v, "npm:") {
+				name, v, _, _ = splitEsmPath(v[4:])
+			}
+			packageJson, err = ctx.npmrc.getPackageInfo(name, v)
+			if err == nil {
+				esm = EsmPath{
+					PkgName:       name,
+					PkgVersion:    packageJson.Version,
+					SubPath:       subpath,
+					SubModuleName: stripEntryModuleExt(subpath),
+				}
+			}
+			return
+		}
+	}
+
 	var raw PackageJSONRaw
 	pkgJsonPath := path.Join(ctx.wd, "node_modules", pkgName, "package.json")
 	if utils.ParseJSONFile(pkgJsonPath, &raw) == nil {
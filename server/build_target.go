@@ -1,10 +1,17 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	esbuild "github.com/evanw/esbuild/pkg/api"
+	"github.com/ije/esbuild-internal/compat"
 )
 
 var v1_33_2 = semver.MustParse("1.33.2")
@@ -26,6 +33,119 @@ var targets = map[string]esbuild.Target{
 	"node":     esbuild.ESNext,
 }
 
+// targetEngines are the browser engines that can be used as the build target, e.g. `chrome100_safari15.4`.
+var targetEngines = map[string]compat.Engine{
+	"chrome":  compat.Chrome,
+	"edge":    compat.Edge,
+	"firefox": compat.Firefox,
+	"ios":     compat.IOS,
+	"opera":   compat.Opera,
+	"safari":  compat.Safari,
+}
+
+// a snapshot of the browser releases that is used to resolve browserslist queries like `last 2 versions`.
+// To refresh the snapshot, update the versions with the output of
+//
+//	npx browserslist@latest "last 1 chrome version, last 1 edge version, last 1 firefox version, last 1 opera version"
+//	npx browserslist@latest "last 30 safari versions"
+//
+// and the `firefoxESR` with the current ESR version at https://whattrainisitnow.com/calendar/.
+var (
+	latestBrowserVersions = map[string]int{
+		"chrome":  131,
+		"edge":    131,
+		"firefox": 133,
+		"opera":   115,
+	}
+	safariReleases = []string{
+		"18.2", "18.1", "18.0", "17.6", "17.5", "17.4", "17.3", "17.2", "17.1", "17.0",
+		"16.6", "16.5", "16.4", "16.3", "16.2", "16.1", "16.0", "15.6", "15.5", "15.4",
+		"15.3", "15.2", "15.1", "15.0", "14.1", "14.0", "13.1", "13.0", "12.1", "12.0",
+	}
+	firefoxESR = 128
+)
+
+// browserslist names of the browsers that are mapped to the target engines
+var browserslistNames = map[string]string{
+	"chrome":         "chrome",
+	"and_chr":        "chrome",
+	"chromeandroid":  "chrome",
+	"edge":           "edge",
+	"firefox":        "firefox",
+	"ff":             "firefox",
+	"and_ff":         "firefox",
+	"firefoxandroid": "firefox",
+	"safari":         "safari",
+	"ios":            "ios",
+	"ios_saf":        "ios",
+	"opera":          "opera",
+}
+
+var (
+	regexpIOSVersion       = regexp.MustCompile(`(?:iPhone|iPad|iPod).+? OS (\d+)_(\d+)`)
+	regexpEngineTarget     = regexp.MustCompile(`^([a-z]+)(\d+(?:\.\d+){0,2})$`)
+	regexpBrowserslistLast = regexp.MustCompile(`^last (\d+) (?:([a-z_]+) )?versions?$`)
+	regexpBrowserslistVer  = regexp.MustCompile(`^([a-z_]+) *(>=|>)? *(\d+(?:\.\d+){0,2})(?:-\d+(?:\.\d+){0,2})?$`)
+)
+
+// engine target version -> the lowest version with the same features
+var engineVersionBuckets sync.Map
+
+// normalizeBuildTarget normalizes the `?target` query to a build target, the query is an ES target
+// (`es2022`), a runtime (`deno`, `denonext`, `node`), a list of engine versions (`safari15,chrome100`)
+// or a browserslist query (`last 2 versions, firefox esr`).
+// Engine targets are canonicalized to the lowest versions that have the same features for esbuild,
+// so `chrome121` and `chrome122` share the same build.
+func normalizeBuildTarget(query string) (string, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return "", errors.New("empty target")
+	}
+	if _, ok := targets[query]; ok {
+		return query, nil
+	}
+	versions, ok := parseEngineTargetList(query)
+	if !ok {
+		var err error
+		versions, err = parseBrowserslist(query)
+		if err != nil {
+			return "", err
+		}
+	}
+	return formatEngineTarget(versions), nil
+}
+
+// isBuildTarget checks if the given string is a build target that is used in the build path.
+func isBuildTarget(target string) bool {
+	if _, ok := targets[target]; ok {
+		return true
+	}
+	versions, ok := parseEngineTargetList(target)
+	return ok && formatEngineTarget(versions) == target
+}
+
+// isEngineTarget checks if the given target is a list of browser engine versions.
+func isEngineTarget(target string) bool {
+	_, ok := targets[target]
+	return !ok && target != "types" && isBuildTarget(target)
+}
+
+// getEsbuildTarget returns the esbuild target and engines of the build target.
+func getEsbuildTarget(target string) (esbuild.Target, []esbuild.Engine) {
+	if t, ok := targets[target]; ok {
+		return t, nil
+	}
+	versions, ok := parseEngineTargetList(target)
+	if !ok {
+		return esbuild.ESNext, nil
+	}
+	engines := make([]esbuild.Engine, 0, len(versions))
+	for _, name := range sortedEngineNames(versions) {
+		engines = append(engines, esbuild.Engine{Name: browsers[name], Version: formatVersion(versions[name])})
+	}
+	return esbuild.ESNext, engines
+}
+
 func getBuildTargetByUA(ua string) string {
 	if strings.HasPrefix(ua, "ES/") {
 		t := "es" + ua[3:]
@@ -43,5 +163,248 @@ func getBuildTargetByUA(ua string) string {
 	if ua == "undici" || strings.HasPrefix(ua, "Node.js/") || strings.HasPrefix(ua, "Node/") || strings.HasPrefix(ua, "Bun/") {
 		return "node"
 	}
+	if strings.HasPrefix(ua, "Mozilla/") {
+		name, version := getBrowserInfo(ua)
+		// all browsers on iOS use the WebKit engine
+		if m := regexpIOSVersion.FindStringSubmatch(ua); m != nil && name != "iOS" {
+			name, version = "iOS", m[1]+"."+m[2]
+		}
+		name = strings.ToLower(name)
+		if name == "opera" && strings.Contains(ua, "OPR/") {
+			version = ua[strings.Index(ua, "OPR/")+4:]
+			version, _, _ = strings.Cut(version, " ")
+		}
+		if _, ok := targetEngines[name]; ok {
+			if parts, ok := parseVersion(version); ok {
+				return getESTargetByEngine(name, parts)
+			}
+		}
+	}
 	return "es2022"
 }
+
+// uaTargets are the ES targets that the browsers are snapped to, from the newest to the oldest.
+var uaTargets = []string{"es2024", "es2023", "es2022", "es2021", "es2020", "es2019", "es2018", "es2017", "es2016", "es2015"}
+
+// getESTargetByEngine returns the newest ES target whose output runs in the given engine version. The
+// browsers are snapped to the ES targets instead of the engine targets to not split the build cache
+// by every browser release, the engine targets are only used with the `?target` query.
+func getESTargetByEngine(name string, parts []int) string {
+	// edge and opera are chromium based but the compat data of them is incomplete, opera is 14 versions
+	// ahead of chromium
+	switch name {
+	case "edge":
+		name = "chrome"
+	case "opera":
+		name, parts = "chrome", []int{parts[0] + 14}
+	}
+	unsupported := compat.UnsupportedJSFeatures(map[compat.Engine]compat.Semver{targetEngines[name]: {Parts: parts}})
+	// the `node:` prefix is only for node, and the unicode property escapes are marked as unsupported by
+	// the compat data if the browser doesn't have the latest unicode version
+	unsupported &^= compat.NodeColonPrefixImport | compat.NodeColonPrefixRequire | compat.RegexpUnicodePropertyEscapes
+	for _, target := range uaTargets {
+		year, _ := strconv.Atoi(target[2:])
+		lowered := compat.UnsupportedJSFeatures(map[compat.Engine]compat.Semver{compat.ES: {Parts: []int{year}}})
+		if unsupported&^lowered == 0 {
+			return target
+		}
+	}
+	return "es2015"
+}
+
+// parseEngineTargetList parses the engine target list like `safari15,chrome100` or `chrome100_safari15`.
+func parseEngineTargetList(s string) (map[string][]int, bool) {
+	versions := map[string][]int{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '_' }) {
+		m := regexpEngineTarget.FindStringSubmatch(strings.TrimSpace(item))
+		if m == nil {
+			return nil, false
+		}
+		if _, ok := targetEngines[m[1]]; !ok {
+			return nil, false
+		}
+		parts, ok := parseVersion(m[2])
+		if !ok {
+			return nil, false
+		}
+		addEngineVersion(versions, m[1], parts)
+	}
+	return versions, len(versions) > 0
+}
+
+// parseBrowserslist resolves a subset of the browserslist queries with the built-in browser releases:
+// `defaults` (as `last 2 versions, firefox esr`), `last N versions`, `last N <browser> versions`,
+// `<browser> >= V`, `<browser> V` and `firefox esr`. Usage based queries like `> 0.5%` are not supported,
+// `not` queries are ignored since only the lowest version of each engine is used.
+func parseBrowserslist(query string) (map[string][]int, error) {
+	versions := map[string][]int{}
+	for _, q := range strings.Split(strings.ReplaceAll(query, " or ", ","), ",") {
+		q = strings.Join(strings.Fields(q), " ")
+		switch {
+		case q == "":
+		case strings.HasPrefix(q, "not "):
+		case q == "defaults":
+			for name := range targetEngines {
+				addEngineVersion(versions, name, lastBrowserVersion(name, 2))
+			}
+			addEngineVersion(versions, "firefox", []int{firefoxESR})
+		case q == "firefox esr" || q == "ff esr":
+			addEngineVersion(versions, "firefox", []int{firefoxESR})
+		case regexpBrowserslistLast.MatchString(q):
+			m := regexpBrowserslistLast.FindStringSubmatch(q)
+			n, _ := strconv.Atoi(m[1])
+			if n < 1 {
+				return nil, fmt.Errorf("invalid browserslist query '%s'", q)
+			}
+			if m[2] == "" {
+				for name := range targetEngines {
+					addEngineVersion(versions, name, lastBrowserVersion(name, n))
+				}
+			} else {
+				name, ok := browserslistNames[m[2]]
+				if !ok {
+					return nil, fmt.Errorf("unsupported browser '%s'", m[2])
+				}
+				addEngineVersion(versions, name, lastBrowserVersion(name, n))
+			}
+		case regexpBrowserslistVer.MatchString(q):
+			m := regexpBrowserslistVer.FindStringSubmatch(q)
+			name, ok := browserslistNames[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("unsupported browser '%s'", m[1])
+			}
+			parts, ok := parseVersion(m[3])
+			if !ok {
+				return nil, fmt.Errorf("invalid browserslist query '%s'", q)
+			}
+			addEngineVersion(versions, name, parts)
+		default:
+			return nil, fmt.Errorf("unsupported browserslist query '%s'", q)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("invalid target '%s'", query)
+	}
+	return versions, nil
+}
+
+// lastBrowserVersion returns the oldest version of the last `n` versions of the browser.
+func lastBrowserVersion(name string, n int) []int {
+	if name == "safari" || name == "ios" {
+		parts, _ := parseVersion(safariReleases[min(n, len(safariReleases))-1])
+		return parts
+	}
+	return []int{max(latestBrowserVersions[name]-n+1, 1)}
+}
+
+// addEngineVersion adds the version of the engine, the lowest version is kept.
+func addEngineVersion(versions map[string][]int, name string, parts []int) {
+	if v, ok := versions[name]; !ok || slices.Compare(parts, v) < 0 {
+		versions[name] = parts
+	}
+}
+
+// formatEngineTarget formats the engine versions to the canonical target, the engines are sorted by
+// name and the versions are lowered to the lowest version that has the same features.
+func formatEngineTarget(versions map[string][]int) string {
+	var sb strings.Builder
+	for i, name := range sortedEngineNames(versions) {
+		if i > 0 {
+			sb.WriteByte('_')
+		}
+		sb.WriteString(name)
+		sb.WriteString(formatVersion(lowestEngineVersion(name, versions[name])))
+	}
+	return sb.String()
+}
+
+// lowestEngineVersion returns the lowest version of the engine that has the same unsupported JS/CSS
+// features and CSS prefixes as the given version. The minor version is only used by safari/ios.
+func lowestEngineVersion(name string, parts []int) []int {
+	if name == "safari" || name == "ios" {
+		parts = slices.Clone(parts[:min(len(parts), 2)])
+	} else {
+		parts = []int{parts[0]}
+	}
+	key := name + formatVersion(parts)
+	if v, ok := engineVersionBuckets.Load(key); ok {
+		return v.([]int)
+	}
+	engine := targetEngines[name]
+	features := getEngineFeatures(engine, parts)
+	lowest := parts
+	if name != "safari" && name != "ios" {
+		for major := parts[0] - 1; major > 0; major-- {
+			if getEngineFeatures(engine, []int{major}) != features {
+				break
+			}
+			lowest = []int{major}
+		}
+	} else {
+		minor := 0
+		if len(parts) > 1 {
+			minor = parts[1]
+		}
+	LOOP:
+		for major := parts[0]; major > 0; major-- {
+			for ; minor >= 0; minor-- {
+				v := []int{major, minor}
+				if minor == 0 {
+					v = []int{major}
+				}
+				if getEngineFeatures(engine, v) != features {
+					break LOOP
+				}
+				lowest = v
+			}
+			minor = 9
+		}
+	}
+	engineVersionBuckets.Store(key, lowest)
+	return lowest
+}
+
+// getEngineFeatures returns the key of the unsupported JS/CSS features and CSS prefixes of the engine version.
+func getEngineFeatures(engine compat.Engine, parts []int) string {
+	constraints := map[compat.Engine]compat.Semver{engine: {Parts: parts}}
+	return fmt.Sprintf("%d/%d/%v", compat.UnsupportedJSFeatures(constraints), compat.UnsupportedCSSFeatures(constraints), compat.CSSPrefixData(constraints))
+}
+
+func sortedEngineNames(versions map[string][]int) []string {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// parseVersion parses the version like `15`, `15.4` or `15.4.1`, trailing zeros are trimmed.
+func parseVersion(s string) ([]int, bool) {
+	// the version of chromium based browsers has four parts, e.g. "124.0.6367.91"
+	if a := strings.SplitN(s, ".", 4); len(a) == 4 {
+		s = strings.Join(a[:3], ".")
+	}
+	m := regexpBrowserVersion.FindStringSubmatch(s)
+	if m == nil || m[1] == "0" {
+		return nil, false
+	}
+	parts := []int{}
+	for _, p := range m[1:] {
+		if p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil || (len(parts) < 2 && n > 999) {
+				return nil, false
+			}
+			parts = append(parts, n)
+		}
+	}
+	for len(parts) > 1 && parts[len(parts)-1] == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	return parts, true
+}
+
+func formatVersion(parts []int) string {
+	return compat.Semver{Parts: parts}.String()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+func TestNormalizeBuildTarget(t *testing.T) {
+	for _, query := range []string{"es2022", "esnext", "denonext", "node"} {
+		target, err := normalizeBuildTarget(query)
+		if err != nil || target != query {
+			t.Fatalf("invalid target '%s' of '%s'", target, query)
+		}
+	}
+
+	target, err := normalizeBuildTarget("safari15,chrome100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(target, "chrome") || !strings.Contains(target, "_safari") {
+		t.Fatalf("invalid target '%s', engines shoud be sorted", target)
+	}
+	if !isBuildTarget(target) {
+		t.Fatalf("'%s' shoud be a build target", target)
+	}
+	for _, query := range []string{"chrome100_safari15", "Safari15, Chrome100", "chrome100,safari15,chrome120", target} {
+		t2, err := normalizeBuildTarget(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if t2 != target {
+			t.Fatalf("invalid target '%s' of '%s', shoud be '%s'", t2, query, target)
+		}
+	}
+
+	// versions with the same features share the same build
+	t1, _ := normalizeBuildTarget("chrome121")
+	t2, _ := normalizeBuildTarget("chrome122")
+	if t1 != t2 {
+		t.Fatalf("chrome121(%s) and chrome122(%s) shoud be same target", t1, t2)
+	}
+	if isBuildTarget("chrome122") && t2 != "chrome122" {
+		t.Fatal("non-canonical target shoud not be a build target")
+	}
+
+	target, err = normalizeBuildTarget("Chrome >= 90, Safari >= 14, not dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, engines := getEsbuildTarget(target)
+	if len(engines) != 2 || engines[0].Name != esbuild.EngineChrome || engines[1].Name != esbuild.EngineSafari {
+		t.Fatalf("invalid engines of '%s'", target)
+	}
+	target, err = normalizeBuildTarget("last 2 versions, firefox esr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, engines = getEsbuildTarget(target); len(engines) != len(targetEngines) {
+		t.Fatalf("invalid engines of '%s'", target)
+	}
+
+	for _, query := range []string{"", "> 0.5%", "ie 11", "chrome0", "chrome1000", "es2077"} {
+		if _, err := normalizeBuildTarget(query); err == nil {
+			t.Fatalf("'%s' shoud be an invalid target", query)
+		}
+	}
+}
+
+func TestGetBuildTargetByUA(t *testing.T) {
+	for ua, expected := range map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36":                                 "es2023",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51":               "es2023",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.163 Safari/537.36":                             "es2019",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0":                                                                "es2023",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15":                         "es2023",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.0 Safari/605.1.15":                           "es2015",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1": "es2023",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1":         "es2023",
+		"Deno/2.0.0": "denonext",
+		"ES/2020":    "es2020",
+		"curl/8.7.1": "es2022",
+	} {
+		target := getBuildTargetByUA(ua)
+		if target != expected {
+			t.Fatalf("invalid target '%s' of '%s', shoud be '%s'", target, ua, expected)
+		}
+	}
+}
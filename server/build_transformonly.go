@@ -34,9 +34,10 @@ type TransformOutput struct {
 
 func transform(options *ResolvedTransformOptions) (out *TransformOutput, err error) {
 	target := esbuild.ESNext
+	var engines []esbuild.Engine
 	if options.Target != "" {
-		if t, ok := targets[options.Target]; ok {
-			target = t
+		if isBuildTarget(options.Target) {
+			target, engines = getEsbuildTarget(options.Target)
 		} else {
 			err = errors.New("invalid target")
 			return
@@ -102,6 +103,7 @@ func transform(options *ResolvedTransformOptions) (out *TransformOutput, err err
 		Platform:          esbuild.PlatformBrowser,
 		Format:            esbuild.FormatESModule,
 		Target:            target,
+		Engines:           engines,
 		JSX:               esbuild.JSXAutomatic,
 		JSXImportSource:   strings.TrimSuffix(jsxImportSource, "/"),
 		MinifyWhitespace:  options.Minify,
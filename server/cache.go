@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -9,22 +10,63 @@ import (
 )
 
 var (
-	cacheMutex syncx.KeyedMutex
-	cacheStore sync.Map
-	cacheLRU   *lru.Cache[string, any]
+	cacheMutex      syncx.KeyedMutex
+	cacheStore      sync.Map
+	cacheRefreshing sync.Map
+	cacheLRU        *lru.Cache[string, any]
 )
 
+// staleError is returned by the fetch function of `withStaleCache` along with the stale data that
+// is used as the fallback, the data is served but cached as expired since the fetch time.
+type staleError struct {
+	fetchedAt time.Time
+	err       error
+}
+
+func (e *staleError) Error() string {
+	return fmt.Sprintf("stale data fetched at %s (%v)", e.fetchedAt.Format(time.RFC3339), e.err)
+}
+
+// isStaleError returns true if the error is a `staleError`.
+func isStaleError(err error) bool {
+	_, ok := err.(*staleError)
+	return ok
+}
+
 type cacheItem struct {
-	exp  int64
-	data any
+	exp   int64
+	stale int64
+	data  any
 }
 
 func withCache[T any](key string, cacheTtl time.Duration, fetch func() (T, string, error)) (data T, err error) {
+	return withStaleCache(key, cacheTtl, 0, fetch)
+}
+
+// withStaleCache is like withCache, but the expired data is served within the `maxStale` window
+// while it's refreshed in background. The expired data is also used as a fallback if the fetch fails.
+func withStaleCache[T any](key string, cacheTtl time.Duration, maxStale time.Duration, fetch func() (T, string, error)) (data T, err error) {
 	// check cache store first
 	if cacheTtl > time.Millisecond {
 		if v, ok := cacheStore.Load(key); ok {
 			item := v.(*cacheItem)
-			if item.exp >= time.Now().UnixMilli() {
+			now := time.Now().UnixMilli()
+			if item.exp >= now {
+				return item.data.(T), nil
+			}
+			if item.stale >= now {
+				// only one refresh process is allowed at the same time for the same key
+				if _, refreshing := cacheRefreshing.LoadOrStore(key, true); !refreshing {
+					go func() {
+						defer cacheRefreshing.Delete(key)
+						unlock := cacheMutex.Lock("lru:" + key)
+						defer unlock()
+						data, aliasKey, err := fetch()
+						if err == nil {
+							storeCache(key, aliasKey, time.Now(), cacheTtl, maxStale, data)
+						}
+					}()
+				}
 				return item.data.(T), nil
 			}
 		}
@@ -34,31 +76,51 @@ func withCache[T any](key string, cacheTtl time.Duration, fetch func() (T, strin
 	defer unlock()
 
 	// check cache store again after get lock
+	var staleItem *cacheItem
 	if cacheTtl > time.Millisecond {
 		if v, ok := cacheStore.Load(key); ok {
 			item := v.(*cacheItem)
-			if item.exp >= time.Now().UnixMilli() {
+			now := time.Now().UnixMilli()
+			if item.exp >= now {
 				return item.data.(T), nil
 			}
+			if item.stale >= now {
+				staleItem = item
+			}
 		}
 	}
 
 	var aliasKey string
 	data, aliasKey, err = fetch()
 	if err != nil {
+		// fallback to the stale data
+		if staleItem != nil {
+			return staleItem.data.(T), nil
+		}
+		if se, ok := err.(*staleError); ok {
+			if cacheTtl > time.Millisecond {
+				storeCache(key, aliasKey, se.fetchedAt, cacheTtl, maxStale, data)
+			}
+			return data, nil
+		}
 		return
 	}
 
 	if cacheTtl > time.Millisecond {
-		exp := time.Now().Add(cacheTtl)
-		cacheStore.Store(key, &cacheItem{exp.UnixMilli(), data})
-		if aliasKey != "" && aliasKey != key {
-			cacheStore.Store(aliasKey, &cacheItem{exp.UnixMilli(), data})
-		}
+		storeCache(key, aliasKey, time.Now(), cacheTtl, maxStale, data)
 	}
 	return
 }
 
+func storeCache(key string, aliasKey string, fetchedAt time.Time, cacheTtl time.Duration, maxStale time.Duration, data any) {
+	exp := fetchedAt.Add(cacheTtl)
+	item := &cacheItem{exp.UnixMilli(), exp.Add(maxStale).UnixMilli(), data}
+	cacheStore.Store(key, item)
+	if aliasKey != "" && aliasKey != key {
+		cacheStore.Store(aliasKey, item)
+	}
+}
+
 func withLRUCache[T any](key string, fetch func() (T, error)) (data T, err error) {
 	// check cache store first
 	if v, ok := cacheLRU.Get(key); ok {
@@ -86,7 +148,7 @@ func gc(now time.Time) {
 	expKeys := []string{}
 	cacheStore.Range(func(key, value any) bool {
 		item := value.(*cacheItem)
-		if item.exp > 0 && item.exp < now.UnixMilli() {
+		if item.exp > 0 && item.exp < now.UnixMilli() && item.stale < now.UnixMilli() {
 			expKeys = append(expKeys, key.(string))
 		}
 		return true
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -45,6 +47,48 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestStaleCache(t *testing.T) {
+	var calls atomic.Int32
+	fetch := func() (int, string, error) {
+		n := int(calls.Add(1))
+		if n > 2 {
+			return 0, "", errors.New("registry is down")
+		}
+		return n, "", nil
+	}
+
+	v, _ := withStaleCache("stale", 10*time.Millisecond, 100*time.Millisecond, fetch)
+	if v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+
+	// serve the stale data while refreshing in background
+	time.Sleep(20 * time.Millisecond)
+	v, _ = withStaleCache("stale", 10*time.Millisecond, 100*time.Millisecond, fetch)
+	if v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+	time.Sleep(5 * time.Millisecond)
+	v, _ = withStaleCache("stale", 10*time.Millisecond, 100*time.Millisecond, fetch)
+	if v != 2 {
+		t.Fatalf("expected 2, got %d", v)
+	}
+
+	// the refresh fails, the stale data is still served
+	time.Sleep(20 * time.Millisecond)
+	v, err := withStaleCache("stale", 10*time.Millisecond, 100*time.Millisecond, fetch)
+	if err != nil || v != 2 {
+		t.Fatalf("expected 2, got %d", v)
+	}
+
+	// exceeds the maximum staleness
+	time.Sleep(150 * time.Millisecond)
+	_, err = withStaleCache("stale", 10*time.Millisecond, 100*time.Millisecond, fetch)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func TestLRUCache(t *testing.T) {
 	cacheLRU, _ = lru.New[string, any](1000)
 
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"os"
+
 	"github.com/esm-dev/esm.sh/server"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "vendor" {
+		server.Vendor(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "advisories" {
+		server.UpdateAdvisories(os.Args[2:])
+		return
+	}
 	server.Serve()
 }
@@ -23,33 +23,47 @@ var (
 
 // Config represents the configuration of esm.sh server.
 type Config struct {
-	Port                uint16                 `json:"port"`
-	TlsPort             uint16                 `json:"tlsPort"`
-	LegacyServer        string                 `json:"legacyServer"` // normally you don't need to set this
-	CustomLandingPage   LandingPageOptions     `json:"customLandingPage"`
-	WorkDir             string                 `json:"workDir"`
-	CorsAllowOrigins    []string               `json:"corsAllowOrigins"`
-	AllowList           AllowList              `json:"allowList"`
-	BanList             BanList                `json:"banList"`
-	BuildConcurrency    uint16                 `json:"buildConcurrency"`
-	BuildWaitTime       uint16                 `json:"buildWaitTime"`
-	Storage             storage.StorageOptions `json:"storage"`
-	CacheRawFile        bool                   `json:"cacheRawFile"`
-	LogDir              string                 `json:"logDir"`
-	LogLevel            string                 `json:"logLevel"`
-	AccessLog           bool                   `json:"accessLog"`
-	NpmRegistry         string                 `json:"npmRegistry"`
-	NpmToken            string                 `json:"npmToken"`
-	NpmUser             string                 `json:"npmUser"`
-	NpmPassword         string                 `json:"npmPassword"`
-	NpmScopedRegistries map[string]NpmRegistry `json:"npmScopedRegistries"`
-	NpmQueryCacheTTL    uint32                 `json:"npmQueryCacheTTL"`
-	MinifyRaw           json.RawMessage        `json:"minify"`
-	SourceMapRaw        json.RawMessage        `json:"sourceMap"`
-	CompressRaw         json.RawMessage        `json:"compress"`
-	Minify              bool                   `json:"-"`
-	SourceMap           bool                   `json:"-"`
-	Compress            bool                   `json:"-"`
+	Port                  uint16                 `json:"port"`
+	TlsPort               uint16                 `json:"tlsPort"`
+	LegacyServer          string                 `json:"legacyServer"` // normally you don't need to set this
+	CustomLandingPage     LandingPageOptions     `json:"customLandingPage"`
+	WorkDir               string                 `json:"workDir"`
+	CorsAllowOrigins      []string               `json:"corsAllowOrigins"`
+	AllowList             AllowList              `json:"allowList"`
+	BanList               BanList                `json:"banList"`
+	LicensePolicy         LicensePolicy          `json:"licensePolicy"`
+	Advisories            AdvisoryOptions        `json:"advisories"`
+	BuildConcurrency      uint16                 `json:"buildConcurrency"`
+	BuildWaitTime         uint16                 `json:"buildWaitTime"`
+	Storage               storage.StorageOptions `json:"storage"`
+	CacheRawFile          bool                   `json:"cacheRawFile"`
+	LogDir                string                 `json:"logDir"`
+	LogLevel              string                 `json:"logLevel"`
+	AccessLog             bool                   `json:"accessLog"`
+	Npmrc                 string                 `json:"npmrc"`
+	NpmRegistry           string                 `json:"npmRegistry"`
+	NpmToken              string                 `json:"npmToken"`
+	NpmUser               string                 `json:"npmUser"`
+	NpmPassword           string                 `json:"npmPassword"`
+	NpmScopedRegistries   map[string]NpmRegistry `json:"npmScopedRegistries"`
+	NpmFallbackRegistries []NpmRegistry          `json:"npmFallbackRegistries"`
+	NpmQueryCacheTTL      uint32                 `json:"npmQueryCacheTTL"`
+	NpmQueryMaxStale      uint32                 `json:"npmQueryMaxStale"`
+	NpmTarballCache       bool                   `json:"npmTarballCache"`
+	NpmStoreRetention     uint32                 `json:"npmStoreRetention"`
+	JsrNative             bool                   `json:"jsrNative"`
+	JsrRegistry           string                 `json:"jsrRegistry"`
+	DenoXRegistry         string                 `json:"denoXRegistry"`
+	VendorDir             string                 `json:"vendorDir"`
+	WarmupFile            string                 `json:"warmupFile"`
+	GitHosts              map[string]GitHost     `json:"gitHosts"`
+	Zones                 []*Zone                `json:"zones"`
+	MinifyRaw             json.RawMessage        `json:"minify"`
+	SourceMapRaw          json.RawMessage        `json:"sourceMap"`
+	CompressRaw           json.RawMessage        `json:"compress"`
+	Minify                bool                   `json:"-"`
+	SourceMap             bool                   `json:"-"`
+	Compress              bool                   `json:"-"`
 }
 
 type LandingPageOptions struct {
@@ -57,6 +71,11 @@ type LandingPageOptions struct {
 	Assets []string `json:"assets"`
 }
 
+type AdvisoryOptions struct {
+	Dir           string `json:"dir"`
+	BlockCritical bool   `json:"blockCritical"`
+}
+
 type BanList struct {
 	Packages []string   `json:"packages"`
 	Scopes   []BanScope `json:"scopes"`
@@ -160,6 +179,10 @@ func normalizeConfig(config *Config) {
 			config.CustomLandingPage.Origin = u.Scheme + "://" + u.Host
 		}
 	}
+	if config.LicensePolicy.IsEmpty() {
+		config.LicensePolicy.Allow = splitLicenseList(os.Getenv("LICENSE_POLICY_ALLOW"))
+		config.LicensePolicy.Deny = splitLicenseList(os.Getenv("LICENSE_POLICY_DENY"))
+	}
 	if config.BuildConcurrency == 0 {
 		config.BuildConcurrency = uint16(runtime.NumCPU())
 	}
@@ -189,6 +212,11 @@ func normalizeConfig(config *Config) {
 	if config.Storage.SecretAccessKey == "" {
 		config.Storage.SecretAccessKey = os.Getenv("STORAGE_SECRET_ACCESS_KEY")
 	}
+	if config.Storage.Encryption == nil {
+		if v := os.Getenv("STORAGE_ENCRYPTION_KEY_FILE"); v != "" {
+			config.Storage.Encryption = &storage.EncryptionOptions{KeyFile: v}
+		}
+	}
 	if config.LogDir == "" {
 		config.LogDir = path.Join(config.WorkDir, "log")
 	}
@@ -201,6 +229,40 @@ func normalizeConfig(config *Config) {
 	if !config.AccessLog {
 		config.AccessLog = os.Getenv("ACCESS_LOG") == "true"
 	}
+	if config.Npmrc == "" {
+		config.Npmrc = os.Getenv("NPMRC")
+	}
+	if config.Npmrc != "" {
+		rc, err := NewNpmRcFromFile(config.Npmrc)
+		if err != nil {
+			fmt.Println(term.Red("[error] failed to load npmrc: " + err.Error()))
+		} else {
+			if rc.Registry == "" {
+				rc.Registry = npmRegistry
+			}
+			if config.NpmRegistry == "" {
+				config.NpmRegistry = rc.Registry
+			}
+			// apply the auth settings of npmrc if the registry is the same
+			if strings.TrimRight(config.NpmRegistry, "/")+"/" == rc.Registry {
+				if config.NpmToken == "" {
+					config.NpmToken = rc.Token
+				}
+				if config.NpmUser == "" && config.NpmPassword == "" {
+					config.NpmUser = rc.User
+					config.NpmPassword = rc.Password
+				}
+			}
+			for scope, reg := range rc.ScopedRegistries {
+				if _, ok := config.NpmScopedRegistries[scope]; !ok {
+					if config.NpmScopedRegistries == nil {
+						config.NpmScopedRegistries = map[string]NpmRegistry{}
+					}
+					config.NpmScopedRegistries[scope] = reg
+				}
+			}
+		}
+	}
 	if config.NpmRegistry != "" {
 		if isHttpSepcifier(config.NpmRegistry) {
 			config.NpmRegistry = strings.TrimRight(config.NpmRegistry, "/") + "/"
@@ -222,11 +284,20 @@ func normalizeConfig(config *Config) {
 	if config.NpmPassword == "" {
 		config.NpmPassword = os.Getenv("NPM_PASSWORD")
 	}
+	if len(config.NpmFallbackRegistries) == 0 {
+		if v := os.Getenv("NPM_FALLBACK_REGISTRIES"); v != "" {
+			for _, registry := range strings.Split(v, ",") {
+				config.NpmFallbackRegistries = append(config.NpmFallbackRegistries, NpmRegistry{Registry: strings.TrimSpace(registry)})
+			}
+		}
+	}
+	config.NpmFallbackRegistries = normalizeFallbackRegistries(config.NpmFallbackRegistries)
 	if len(config.NpmScopedRegistries) > 0 {
 		regs := make(map[string]NpmRegistry)
 		for scope, rc := range config.NpmScopedRegistries {
 			if strings.HasPrefix(scope, "@") && isHttpSepcifier(rc.Registry) {
 				rc.Registry = strings.TrimRight(rc.Registry, "/") + "/"
+				rc.Fallbacks = normalizeFallbackRegistries(rc.Fallbacks)
 				regs[scope] = rc
 			} else {
 				fmt.Printf("[error] invalid npm registry for scope %s: %s\n", scope, rc.Registry)
@@ -234,6 +305,23 @@ func normalizeConfig(config *Config) {
 		}
 		config.NpmScopedRegistries = regs
 	}
+	if len(config.Zones) > 0 {
+		zones := make([]*Zone, 0, len(config.Zones))
+		for i, z := range config.Zones {
+			if err := z.normalize(); err != nil {
+				fmt.Println(term.Red(fmt.Sprintf("[error] invalid zone #%d: %v", i, err)))
+			} else {
+				zones = append(zones, z)
+			}
+		}
+		config.Zones = zones
+	}
+	// encrypt the builds of the zones by default
+	if config.Storage.Encryption != nil && len(config.Storage.Encryption.Prefixes) == 0 {
+		for _, z := range config.Zones {
+			config.Storage.Encryption.Prefixes = append(config.Storage.Encryption.Prefixes, z.Id+"/")
+		}
+	}
 	if config.NpmQueryCacheTTL == 0 {
 		v := os.Getenv("NPM_QUERY_CACHE_TTL")
 		if v != "" {
@@ -246,11 +334,84 @@ func normalizeConfig(config *Config) {
 		}
 		config.NpmQueryCacheTTL = 600
 	}
+	if config.NpmQueryMaxStale == 0 {
+		v := os.Getenv("NPM_QUERY_MAX_STALE")
+		if v != "" {
+			i, e := strconv.Atoi(v)
+			if e == nil && i > 0 {
+				config.NpmQueryMaxStale = uint32(i)
+			}
+		}
+		if config.NpmQueryMaxStale == 0 {
+			config.NpmQueryMaxStale = 86400
+		}
+	}
+	if !config.NpmTarballCache {
+		config.NpmTarballCache = os.Getenv("NPM_TARBALL_CACHE") == "true"
+	}
+	if !config.JsrNative {
+		config.JsrNative = os.Getenv("JSR_NATIVE") == "true"
+	}
+	if config.JsrRegistry == "" {
+		config.JsrRegistry = os.Getenv("JSR_REGISTRY")
+	}
+	if config.JsrRegistry == "" {
+		config.JsrRegistry = "https://jsr.io/"
+	} else {
+		config.JsrRegistry = strings.TrimRight(config.JsrRegistry, "/") + "/"
+	}
+	if config.DenoXRegistry == "" {
+		config.DenoXRegistry = os.Getenv("DENO_X_REGISTRY")
+	}
+	if config.DenoXRegistry == "" {
+		config.DenoXRegistry = "https://cdn.deno.land/"
+	} else {
+		config.DenoXRegistry = strings.TrimRight(config.DenoXRegistry, "/") + "/"
+	}
+	if config.VendorDir == "" {
+		config.VendorDir = os.Getenv("VENDOR_DIR")
+	}
+	if config.WarmupFile == "" {
+		config.WarmupFile = os.Getenv("WARMUP_FILE")
+	}
+	if config.Advisories.Dir == "" {
+		config.Advisories.Dir = os.Getenv("ADVISORY_DIR")
+	}
+	if !config.Advisories.BlockCritical {
+		config.Advisories.BlockCritical = os.Getenv("BLOCK_CRITICAL_ADVISORIES") == "true"
+	}
+	if config.VendorDir != "" && !filepath.IsAbs(config.VendorDir) {
+		if dir, err := filepath.Abs(config.VendorDir); err == nil {
+			config.VendorDir = dir
+		}
+	}
+	if config.NpmStoreRetention == 0 {
+		v := os.Getenv("NPM_STORE_RETENTION")
+		if v != "" {
+			i, e := strconv.Atoi(v)
+			if e == nil && i > 0 {
+				config.NpmStoreRetention = uint32(i)
+			}
+		}
+		if config.NpmStoreRetention == 0 {
+			config.NpmStoreRetention = 7
+		}
+	}
 	config.Compress = !(bytes.Equal(config.CompressRaw, []byte("false")) || os.Getenv("COMPRESS") == "false")
 	config.SourceMap = !(bytes.Equal(config.SourceMapRaw, []byte("false")) || (os.Getenv("SOURCEMAP") == "false" || os.Getenv("SOURCE_MAP") == "false"))
 	config.Minify = !(bytes.Equal(config.MinifyRaw, []byte("false")) || os.Getenv("MINIFY") == "false")
 }
 
+// splitLicenseList splits the comma-separated license list, e.g. "MIT,ISC,Apache-2.0".
+func splitLicenseList(s string) (list []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
 // extractPackageName Will take a packageName as input extract key parts and return them
 //
 // fullNameWithoutVersion  e.g. @github/faker
@@ -326,6 +487,24 @@ func isPackageExcluded(name string, excludes []string) bool {
 	return false
 }
 
+// normalizeFallbackRegistries validates the fallback registries, the nested fallbacks are ignored.
+func normalizeFallbackRegistries(regs []NpmRegistry) []NpmRegistry {
+	if len(regs) == 0 {
+		return nil
+	}
+	ret := make([]NpmRegistry, 0, len(regs))
+	for _, reg := range regs {
+		if !isHttpSepcifier(reg.Registry) {
+			fmt.Printf("[error] invalid fallback npm registry: %s\n", reg.Registry)
+			continue
+		}
+		reg.Registry = strings.TrimRight(reg.Registry, "/") + "/"
+		reg.Fallbacks = nil
+		ret = append(ret, reg)
+	}
+	return ret
+}
+
 func init() {
 	config = DefaultConfig()
 }
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// The deno.land/x modules are mapped to the `@deno.land/<module>` packages, e.g.
+// `/denoland/x/oak@v12.6.1/mod.ts` -> `/@deno.land/oak@v12.6.1/mod.ts`.
+// see https://deno.com/add_module
+
+// DenoXVersions defines the `meta/versions.json` of a deno.land/x module
+type DenoXVersions struct {
+	Latest   string   `json:"latest"`
+	Versions []string `json:"versions"`
+}
+
+// DenoXVersionMeta defines the `versions/<version>/meta/meta.json` of a deno.land/x module
+type DenoXVersionMeta struct {
+	DirectoryListing []struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+		Type string `json:"type"`
+	} `json:"directory_listing"`
+}
+
+// splitDenoXPackageName returns the module name of the `@deno.land/<module>` package.
+func splitDenoXPackageName(pkgName string) (module string, ok bool) {
+	module, ok = strings.CutPrefix(pkgName, "@deno.land/")
+	return module, ok && module != ""
+}
+
+// toDenoXSpecifier converts the deno.land/x module url to the package specifier, e.g.
+// `https://deno.land/x/oak@v12.6.1/mod.ts` -> `@deno.land/oak@v12.6.1/mod.ts`,
+// `https://deno.land/std@0.224.0/path/mod.ts` -> `@deno.land/std@0.224.0/path/mod.ts`.
+func toDenoXSpecifier(url string) (specifier string, ok bool) {
+	if rest, ok := strings.CutPrefix(url, "https://deno.land/x/"); ok {
+		return "@deno.land/" + rest, true
+	}
+	if rest, ok := strings.CutPrefix(url, "https://deno.land/std@"); ok {
+		return "@deno.land/std@" + rest, true
+	}
+	return "", false
+}
+
+// getDenoXPackageInfo resolves the version of the deno.land/x module, and returns the package.json
+// that uses the `mod.ts` as the entry.
+func getDenoXPackageInfo(pkgName string, module string, version string) (*PackageJSON, error) {
+	cacheTtl := time.Duration(config.NpmQueryCacheTTL) * time.Second
+	maxStale := time.Duration(config.NpmQueryMaxStale) * time.Second
+	return withStaleCache("denox:"+module+"@"+version, cacheTtl, maxStale, func() (*PackageJSON, string, error) {
+		var versions DenoXVersions
+		var stale error
+		err := fetchRegistryJSON(config.DenoXRegistry+module+"/meta/versions.json", &versions)
+		if isStaleError(err) {
+			stale, err = err, nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("module '%s' not found", module)
+		}
+		resolved, err := resolveDenoXVersion(&versions, version)
+		if err != nil {
+			return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
+		}
+		meta, err := getDenoXVersionMeta(module, resolved)
+		if err != nil {
+			return nil, "", fmt.Errorf("version %s of '%s' not found", resolved, pkgName)
+		}
+		return meta.toPackageJSON(pkgName, resolved), "denox:" + module + "@" + resolved, stale
+	})
+}
+
+// getDenoXVersionMeta returns the `versions/<version>/meta/meta.json` of the deno.land/x module.
+func getDenoXVersionMeta(module string, version string) (*DenoXVersionMeta, error) {
+	return getImmutableRegistryJSON[DenoXVersionMeta](
+		"denox:"+module+"@"+version+"_meta",
+		config.DenoXRegistry+fmt.Sprintf("%s/versions/%s/meta/meta.json", module, version),
+	)
+}
+
+// resolveDenoXVersion resolves the version of the deno.land/x module, the versions are usually
+// tagged with a `v` prefix, e.g. "v12.6.1".
+func resolveDenoXVersion(versions *DenoXVersions, version string) (string, error) {
+	if version == "" || version == "latest" {
+		if versions.Latest == "" {
+			return "", errors.New("no latest version")
+		}
+		return versions.Latest, nil
+	}
+	for _, v := range versions.Versions {
+		if v == version {
+			return v, nil
+		}
+	}
+	c, err := semver.NewConstraint(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return "", err
+	}
+	vs := map[*semver.Version]string{}
+	var collection semver.Collection
+	for _, v := range versions.Versions {
+		if !strings.ContainsRune(version, '-') && strings.ContainsRune(v, '-') {
+			continue
+		}
+		ver, err := semver.NewVersion(strings.TrimPrefix(v, "v"))
+		if err == nil && c.Check(ver) {
+			vs[ver] = v
+			collection = append(collection, ver)
+		}
+	}
+	if len(collection) == 0 {
+		return "", errors.New("no matched version")
+	}
+	sort.Sort(collection)
+	return vs[collection[len(collection)-1]], nil
+}
+
+// isDenoXModuleFile checks if the file should be installed, only the modules and json files are installed.
+func isDenoXModuleFile(filename string) bool {
+	return endsWith(filename, moduleExts...) || strings.HasSuffix(filename, ".json")
+}
+
+func (meta *DenoXVersionMeta) toPackageJSON(pkgName string, version string) *PackageJSON {
+	p := &PackageJSON{
+		Name:    pkgName,
+		Version: version,
+		Type:    "module",
+	}
+	files := map[string]bool{}
+	for _, entry := range meta.DirectoryListing {
+		if entry.Type == "file" {
+			files[entry.Path] = true
+		}
+	}
+	for _, name := range []string{"mod.ts", "mod.js", "index.ts", "index.js", "main.ts", "main.js"} {
+		if files["/"+name] {
+			p.Module = "./" + name
+			if strings.HasSuffix(name, ".ts") {
+				p.Types = "./" + name
+			}
+			break
+		}
+	}
+	return p
+}
+
+// denoXInstall downloads the module files of the deno.land/x module.
+func denoXInstall(installDir string, pkgName string, module string, version string) (err error) {
+	meta, err := getDenoXVersionMeta(module, version)
+	if err != nil {
+		return fmt.Errorf("version %s of '%s' not found", version, pkgName)
+	}
+	pkgDir := path.Join(installDir, "node_modules", pkgName)
+
+	files := map[string]string{}
+	for _, entry := range meta.DirectoryListing {
+		if entry.Type == "file" && isDenoXModuleFile(entry.Path) {
+			files[entry.Path] = ""
+		}
+	}
+	err = fetchRegistryFiles(config.DenoXRegistry+fmt.Sprintf("%s/versions/%s/raw", module, version), pkgDir, files)
+	if err != nil {
+		os.RemoveAll(installDir)
+		return
+	}
+
+	p := meta.toPackageJSON(pkgName, version)
+	packageJson := map[string]any{
+		"name":    pkgName,
+		"version": version,
+		"type":    "module",
+	}
+	if p.Module != "" {
+		packageJson["module"] = p.Module
+	}
+	if p.Types != "" {
+		packageJson["types"] = p.Types
+	}
+	data, err := json.Marshal(packageJson)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path.Join(pkgDir, "package.json"), data, 0644)
+}
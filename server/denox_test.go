@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestDenoXModule(t *testing.T) {
+	versions := &DenoXVersions{
+		Latest:   "v1.1.0",
+		Versions: []string{"v1.1.0", "v1.0.0", "v0.9.0", "v2.0.0-rc.1"},
+	}
+	for version, expected := range map[string]string{
+		"":       "v1.1.0",
+		"v1.0.0": "v1.0.0",
+		"^1.0.0": "v1.1.0",
+		"0.9":    "v0.9.0",
+	} {
+		v, err := resolveDenoXVersion(versions, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Fatalf("invalid version(%s) of '%s', shoud be '%s'", v, version, expected)
+		}
+	}
+
+	if s, ok := toDenoXSpecifier("https://deno.land/x/oak@v12.6.1/mod.ts"); !ok || s != "@deno.land/oak@v12.6.1/mod.ts" {
+		t.Fatalf("invalid specifier %s", s)
+	}
+	if s, ok := toDenoXSpecifier("https://deno.land/std@0.224.0/path/mod.ts"); !ok || s != "@deno.land/std@0.224.0/path/mod.ts" {
+		t.Fatalf("invalid specifier %s", s)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/foo/meta/versions.json":
+			w.Write([]byte(`{"latest":"v1.0.0","versions":["v1.0.0"]}`))
+		case "/foo/versions/v1.0.0/meta/meta.json":
+			w.Write([]byte(`{"directory_listing":[{"path":"/mod.ts","type":"file"},{"path":"/lib","type":"dir"},{"path":"/lib/util.ts","type":"file"},{"path":"/README.md","type":"file"}]}`))
+		case "/foo/versions/v1.0.0/raw/mod.ts":
+			w.Write([]byte(`export * from "./lib/util.ts";`))
+		case "/foo/versions/v1.0.0/raw/lib/util.ts":
+			w.Write([]byte(`export const foo = "bar";`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	workDir := config.WorkDir
+	denoXRegistry := config.DenoXRegistry
+	defer func() {
+		config.WorkDir = workDir
+		config.DenoXRegistry = denoXRegistry
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "denox_test_"+rand.Hex.String(8))
+	config.DenoXRegistry = server.URL + "/"
+	defer os.RemoveAll(config.WorkDir)
+
+	p, err := getDenoXPackageInfo("@deno.land/foo", "foo", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != "v1.0.0" || p.Module != "./mod.ts" || p.Types != "./mod.ts" {
+		t.Fatalf("invalid package info %v", p)
+	}
+
+	installDir := path.Join(config.WorkDir, "npm", "@deno.land/foo@v1.0.0")
+	err = denoXInstall(installDir, "@deno.land/foo", "foo", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgDir := path.Join(installDir, "node_modules", "@deno.land/foo")
+	if !existsFile(path.Join(pkgDir, "mod.ts")) || !existsFile(path.Join(pkgDir, "lib/util.ts")) || !existsFile(path.Join(pkgDir, "package.json")) {
+		t.Fatal("module files shoud be installed")
+	}
+	if existsFile(path.Join(pkgDir, "README.md")) {
+		t.Fatal("non-module files shoud not be installed")
+	}
+}
@@ -1,9 +1,17 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 )
@@ -53,3 +61,111 @@ func (c *FetchClient) Fetch(url *url.URL, header http.Header) (resp *http.Respon
 	}
 	return c.Do(req)
 }
+
+// fetchRegistryJSON fetches the JSON metadata from the registry, the stale metadata is returned
+// with a `staleError`.
+func fetchRegistryJSON(regUrl string, v any) error {
+	data, notFound, err := fetchNpmMetadata(&NpmRegistry{}, regUrl, false)
+	if err != nil && !isStaleError(err) {
+		return err
+	}
+	if notFound {
+		return errors.New("not found")
+	}
+	if e := json.Unmarshal(data, v); e != nil {
+		return e
+	}
+	return err
+}
+
+// getImmutableRegistryJSON returns the JSON metadata that never changes once it's published, e.g. the
+// metadata of a package version, the stale one is fine.
+func getImmutableRegistryJSON[T any](cacheKey string, regUrl string) (*T, error) {
+	return withCache(cacheKey, 24*time.Hour, func() (*T, string, error) {
+		var v T
+		err := fetchRegistryJSON(regUrl, &v)
+		if err != nil && !isStaleError(err) {
+			return nil, "", err
+		}
+		return &v, "", nil
+	})
+}
+
+// fetchRegistryFiles downloads the files of a package with 8 workers, the `files` maps the filename
+// to the sha256 checksum (can be empty) and the file url is `baseUrl + filename`.
+func fetchRegistryFiles(baseUrl string, pkgDir string, files map[string]string) (err error) {
+	filenames := make(chan string, len(files))
+	for filename := range files {
+		filenames <- filename
+	}
+	close(filenames)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filename := range filenames {
+				e := fetchRegistryFile(baseUrl+filename, pkgDir, filename, files[filename])
+				if e != nil {
+					errOnce.Do(func() { err = e })
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+// fetchRegistryFile downloads the file of a package to the package directory, the sha256 checksum
+// (hex encoded) is verified if it's not empty. Files larger than `maxAssetFileSize` are rejected.
+func fetchRegistryFile(fileUrl string, pkgDir string, filename string, sha256sum string) error {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return err
+	}
+	savePath := path.Join(pkgDir, filename)
+	if !strings.HasPrefix(savePath, pkgDir+"/") {
+		return fmt.Errorf("invalid file path '%s'", filename)
+	}
+	if isOffline() {
+		return fmt.Errorf("offline: %s is not vendored", u.Redacted())
+	}
+	fetchClient, recycle := NewFetchClient(30, "esmd/"+VERSION, false)
+	defer recycle()
+	res, err := fetchClient.Fetch(u, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("fetch %s: %s", filename, res.Status)
+	}
+	if res.ContentLength > maxAssetFileSize {
+		return fmt.Errorf("fetch %s: file is too large", filename)
+	}
+	err = ensureDir(path.Dir(savePath))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(savePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(res.Body, maxAssetFileSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxAssetFileSize {
+		os.Remove(savePath)
+		return fmt.Errorf("fetch %s: file is too large", filename)
+	}
+	if sha256sum != "" && sha256sum != hex.EncodeToString(h.Sum(nil)) {
+		return fmt.Errorf("checksum mismatch of %s", filename)
+	}
+	return nil
+}
@@ -3,11 +3,15 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/ije/gox/utils"
@@ -18,14 +22,20 @@ type GitRef struct {
 	Sha string
 }
 
-// list repo refs using `git ls-remote repo`
-func listRepoRefs(repo string) (refs []GitRef, err error) {
+// list repo refs using `git ls-remote repo`, the `env` is used to pass the credentials, see `GitHost.GitEnv`.
+func listRepoRefs(repo string, env []string) (refs []GitRef, err error) {
+	if isOffline() {
+		return readVendoredRepoRefs(repo)
+	}
 	return withCache("git ls-remote "+repo, time.Duration(config.NpmQueryCacheTTL)*time.Second, func() ([]GitRef, string, error) {
 		stdout, recycle := NewBuffer()
 		defer recycle()
 		errout, recycle := NewBuffer()
 		defer recycle()
 		cmd := exec.Command("git", "ls-remote", repo)
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
 		cmd.Stdout = stdout
 		cmd.Stderr = errout
 		err = cmd.Run()
@@ -57,25 +67,130 @@ func listRepoRefs(repo string) (refs []GitRef, err error) {
 	})
 }
 
+// GitHost defines a git host that serves repositories like GitHub, e.g. a self-hosted GitLab.
+type GitHost struct {
+	// Type is one of "github", "gitlab", "gitea" and "bitbucket", default is "gitea".
+	Type string `json:"type"`
+	// ArchiveUrl is the url template of the repository tarball, supported placeholders are
+	// `{host}`, `{repo}` (e.g. "owner/name"), `{repoId}` (url-escaped `{repo}`), `{owner}`, `{name}` and `{ref}`.
+	ArchiveUrl string `json:"archiveUrl"`
+	// Token is used to access private repositories, optional.
+	Token string `json:"token"`
+}
+
+var githubHost = &GitHost{Type: "github", ArchiveUrl: "https://codeload.github.com/{repo}/tar.gz/{ref}"}
+
+// getGitHost returns the git host by the hostname, an empty hostname means github.com.
+func getGitHost(hostname string) (*GitHost, bool) {
+	if hostname == "" || hostname == "github.com" {
+		return githubHost, true
+	}
+	host, ok := config.GitHosts[hostname]
+	return &host, ok
+}
+
+// RemoteUrl returns the url of the repository that is used by `git ls-remote`.
+func (h *GitHost) RemoteUrl(hostname string, repo string) string {
+	if hostname == "" {
+		hostname = "github.com"
+	}
+	u := &url.URL{Scheme: "https", Host: hostname, Path: "/" + repo}
+	return u.String()
+}
+
+// GitEnv returns the environment variables that pass the token to git with the `http.extraHeader`
+// config, to keep the token out of the remote url and the command arguments.
+func (h *GitHost) GitEnv() []string {
+	if h.Token == "" {
+		return nil
+	}
+	var user string
+	switch h.Type {
+	case "gitlab":
+		user = "oauth2"
+	case "bitbucket":
+		user = "x-token-auth"
+	default:
+		user = "git"
+	}
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+h.Token)),
+	}
+}
+
+// ArchiveURL returns the tarball url of the repository at the given ref.
+func (h *GitHost) ArchiveURL(hostname string, repo string, ref string) string {
+	tpl := h.ArchiveUrl
+	if tpl == "" {
+		switch h.Type {
+		case "github":
+			tpl = githubHost.ArchiveUrl
+		case "gitlab":
+			tpl = "https://{host}/api/v4/projects/{repoId}/repository/archive.tar.gz?sha={ref}"
+		case "bitbucket":
+			tpl = "https://{host}/{repo}/get/{ref}.tar.gz"
+		default:
+			tpl = "https://{host}/{repo}/archive/{ref}.tar.gz"
+		}
+	}
+	owner, name := utils.SplitByLastByte(repo, '/')
+	return strings.NewReplacer(
+		"{host}", hostname,
+		"{repo}", repo,
+		"{repoId}", url.PathEscape(repo),
+		"{owner}", owner,
+		"{name}", name,
+		"{ref}", url.PathEscape(ref),
+	).Replace(tpl)
+}
+
 func ghInstall(wd, name, tag string) (err error) {
-	u, err := url.Parse(fmt.Sprintf("https://codeload.github.com/%s/tar.gz/%s", name, tag))
+	return gitInstall(wd, "", name, tag)
+}
+
+// gitInstall downloads the tarball of the repository from the git host and extracts it to the `wd`.
+func gitInstall(wd, hostname, name, tag string) (err error) {
+	if isOffline() {
+		f, err := openVendoredRepoTarball(hostname, name, tag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return extractPackageTarball(wd, name, f)
+	}
+	host, ok := getGitHost(hostname)
+	if !ok {
+		return fmt.Errorf("git: unknown host \"%s\"", hostname)
+	}
+	u, err := url.Parse(host.ArchiveURL(hostname, name, tag))
 	if err != nil {
 		return
 	}
+	var header http.Header
+	if host.Token != "" {
+		header = http.Header{}
+		header.Set("Authorization", "Bearer "+host.Token)
+	}
 	fetchClient, recycle := NewFetchClient(30, "esmd/"+VERSION, false)
 	defer recycle()
-	res, err := fetchClient.Fetch(u, nil)
+	res, err := fetchClient.Fetch(u, header)
 	if err != nil {
 		return
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode == 404 || res.StatusCode == 401 {
-		return fmt.Errorf("github: repo \"%s\" or tag \"%s\" not found", name, tag)
+		if host == githubHost {
+			return fmt.Errorf("github: repo \"%s\" or tag \"%s\" not found", name, tag)
+		}
+		return fmt.Errorf("%s: repo \"%s\" or tag \"%s\" not found", hostname, name, tag)
 	}
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("fetch %s failed: %s", u, res.Status)
+		return fmt.Errorf("fetch %s failed: %s", u.Redacted(), res.Status)
 	}
 
 	err = extractPackageTarball(wd, name, io.LimitReader(res.Body, maxPackageTarballSize))
@@ -50,6 +50,30 @@ func (obj *JSONObject) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON implements type json.Marshaler interface, the keys are kept in order
+func (obj JSONObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	for i, key := range obj.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(obj.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
 func (obj *JSONObject) parse(dec *json.Decoder) (err error) {
 	var t json.Token
 	for dec.More() {
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// JSR native API, see https://jsr.io/docs/api#package-metadata
+
+// JsrPackageMeta defines the `meta.json` of a JSR package
+type JsrPackageMeta struct {
+	Scope    string                     `json:"scope"`
+	Name     string                     `json:"name"`
+	Latest   string                     `json:"latest"`
+	Versions map[string]JsrVersionState `json:"versions"`
+}
+
+type JsrVersionState struct {
+	Yanked bool `json:"yanked"`
+}
+
+// JsrVersionMeta defines the `<version>_meta.json` of a JSR package
+type JsrVersionMeta struct {
+	Manifest     map[string]JsrManifestFile `json:"manifest"`
+	Exports      map[string]string          `json:"exports"`
+	ModuleGraph2 map[string]JsrModuleInfo   `json:"moduleGraph2"`
+}
+
+type JsrManifestFile struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+type JsrModuleInfo struct {
+	Dependencies []struct {
+		Specifier string `json:"specifier"`
+	} `json:"dependencies"`
+}
+
+// splitJsrPackageName splits the npm-compat package name `@jsr/scope__name` into the scope and name,
+// it returns false if the native JSR API is not enabled or the `@jsr` scope uses a custom registry.
+func (npmrc *NpmRC) splitJsrPackageName(pkgName string) (scope string, name string, ok bool) {
+	if !config.JsrNative || isOffline() || !strings.HasPrefix(pkgName, "@jsr/") || npmrc.getRegistryByPackageName(pkgName).Registry != jsrRegistry {
+		return
+	}
+	scope, name, ok = strings.Cut(pkgName[5:], "__")
+	return scope, name, ok && scope != "" && name != ""
+}
+
+// getJsrPackageInfo resolves the version of the JSR package with the native `meta.json`, and returns
+// the package.json that is generated from the `<version>_meta.json`.
+func getJsrPackageInfo(pkgName string, scope string, name string, version string) (*PackageJSON, error) {
+	cacheTtl := time.Duration(config.NpmQueryCacheTTL) * time.Second
+	maxStale := time.Duration(config.NpmQueryMaxStale) * time.Second
+	return withStaleCache("jsr:@"+scope+"/"+name+"@"+version, cacheTtl, maxStale, func() (*PackageJSON, string, error) {
+		if !isExactVersion(version) {
+			var meta JsrPackageMeta
+			var stale error
+			err := fetchRegistryJSON(config.JsrRegistry+fmt.Sprintf("@%s/%s/meta.json", scope, name), &meta)
+			if isStaleError(err) {
+				stale, err = err, nil
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("could not get metadata of package '%s' (%v)", pkgName, err)
+			}
+			resolved, err := resolveJsrVersion(&meta, version)
+			if err != nil {
+				return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
+			}
+			p, err := getJsrPackageInfo(pkgName, scope, name, resolved)
+			if err == nil && stale != nil {
+				err = stale
+			}
+			return p, "", err
+		}
+		vm, err := getJsrVersionMeta(scope, name, version)
+		if err != nil {
+			return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
+		}
+		return vm.toPackageJSON(pkgName, version), "jsr:@" + scope + "/" + name + "@" + version, nil
+	})
+}
+
+// getJsrVersionMeta returns the `<version>_meta.json` of the JSR package.
+func getJsrVersionMeta(scope string, name string, version string) (*JsrVersionMeta, error) {
+	return getImmutableRegistryJSON[JsrVersionMeta](
+		"jsr:@"+scope+"/"+name+"@"+version+"_meta",
+		config.JsrRegistry+fmt.Sprintf("@%s/%s/%s_meta.json", scope, name, version),
+	)
+}
+
+// resolveJsrVersion resolves the version range with the versions of the `meta.json`, yanked
+// versions are ignored unless the version is exact.
+func resolveJsrVersion(meta *JsrPackageMeta, version string) (string, error) {
+	if version == "latest" {
+		if meta.Latest == "" {
+			return "", errors.New("no latest version")
+		}
+		return meta.Latest, nil
+	}
+	c, err := semver.NewConstraint(version)
+	if err != nil {
+		return "", err
+	}
+	var vs []*semver.Version
+	for v, state := range meta.Versions {
+		if state.Yanked || (!strings.ContainsRune(version, '-') && strings.ContainsRune(v, '-')) {
+			continue
+		}
+		ver, err := semver.NewVersion(v)
+		if err == nil && c.Check(ver) {
+			vs = append(vs, ver)
+		}
+	}
+	if len(vs) == 0 {
+		return "", errors.New("no matched version")
+	}
+	sort.Sort(semver.Collection(vs))
+	return vs[len(vs)-1].String(), nil
+}
+
+// packageJSON generates the package.json with the JSR export map, the original `.ts` sources
+// are used as both the module and the types.
+func (vm *JsrVersionMeta) packageJSON(pkgName string, version string) map[string]any {
+	exports := map[string]any{}
+	for key, filename := range vm.Exports {
+		filename = "./" + strings.TrimPrefix(filename, "./")
+		exports[key] = map[string]string{
+			"types":   filename,
+			"default": filename,
+		}
+	}
+	return map[string]any{
+		"name":         pkgName,
+		"version":      version,
+		"type":         "module",
+		"exports":      exports,
+		"dependencies": vm.dependencies(),
+	}
+}
+
+func (vm *JsrVersionMeta) toPackageJSON(pkgName string, version string) *PackageJSON {
+	data, _ := json.Marshal(vm.packageJSON(pkgName, version))
+	var raw PackageJSONRaw
+	json.Unmarshal(data, &raw)
+	return raw.ToNpmPackage()
+}
+
+// dependencies returns the `jsr:` and `npm:` dependencies of the module graph.
+func (vm *JsrVersionMeta) dependencies() map[string]string {
+	deps := map[string]string{}
+	for _, module := range vm.ModuleGraph2 {
+		for _, dep := range module.Dependencies {
+			specifier := dep.Specifier
+			if strings.HasPrefix(specifier, "jsr:") {
+				pkgName, version, _, _ := splitEsmPath(strings.TrimPrefix(specifier[4:], "/"))
+				scope, name, ok := strings.Cut(pkgName, "/")
+				if ok && strings.HasPrefix(scope, "@") {
+					if version == "" {
+						version = "*"
+					}
+					deps["@jsr/"+scope[1:]+"__"+name] = version
+				}
+			} else if strings.HasPrefix(specifier, "npm:") {
+				pkgName, version, _, _ := splitEsmPath(strings.TrimPrefix(specifier[4:], "/"))
+				if version == "" {
+					version = "*"
+				}
+				deps[pkgName] = version
+			}
+		}
+	}
+	return deps
+}
+
+// jsrInstall downloads the files of the JSR package, the checksums are verified with the manifest.
+func jsrInstall(installDir string, pkgName string, scope string, name string, version string) (err error) {
+	vm, err := getJsrVersionMeta(scope, name, version)
+	if err != nil {
+		return fmt.Errorf("version %s of '%s' not found", version, pkgName)
+	}
+	pkgDir := path.Join(installDir, "node_modules", pkgName)
+
+	files := make(map[string]string, len(vm.Manifest))
+	for filename, file := range vm.Manifest {
+		files[filename] = strings.TrimPrefix(file.Checksum, "sha256-")
+	}
+	err = fetchRegistryFiles(config.JsrRegistry+fmt.Sprintf("@%s/%s/%s", scope, name, version), pkgDir, files)
+	if err != nil {
+		os.RemoveAll(installDir)
+		return
+	}
+
+	data, err := json.Marshal(vm.packageJSON(pkgName, version))
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path.Join(pkgDir, "package.json"), data, 0644)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestResolveJsrVersion(t *testing.T) {
+	meta := &JsrPackageMeta{
+		Latest: "1.1.0",
+		Versions: map[string]JsrVersionState{
+			"1.0.0":      {},
+			"1.1.0":      {},
+			"1.2.0":      {Yanked: true},
+			"2.0.0-rc.1": {},
+			"0.9.0":      {},
+		},
+	}
+	for version, expected := range map[string]string{
+		"latest": "1.1.0",
+		"^1.0.0": "1.1.0",
+		"~1.0.0": "1.0.0",
+		"<1.0.0": "0.9.0",
+	} {
+		v, err := resolveJsrVersion(meta, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Fatalf("invalid version(%s) of '%s', shoud be '%s'", v, version, expected)
+		}
+	}
+	if _, err := resolveJsrVersion(meta, "^3.0.0"); err == nil {
+		t.Fatal("shoud be not found")
+	}
+}
+
+func TestJsrInstall(t *testing.T) {
+	source := []byte("export const foo = 'bar';\n")
+	sum := sha256.Sum256(source)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/@foo/bar/1.0.0_meta.json":
+			w.Write([]byte(`{
+				"manifest": {
+					"/mod.ts": { "size": 26, "checksum": "sha256-` + hex.EncodeToString(sum[:]) + `" },
+					"/bad.ts": { "size": 1, "checksum": "sha256-00" }
+				},
+				"exports": { ".": "./mod.ts" },
+				"moduleGraph2": {
+					"/mod.ts": { "dependencies": [{ "specifier": "jsr:@std/path@^1.0.0" }, { "specifier": "npm:react@^19.0.0" }] }
+				}
+			}`))
+		case "/@foo/bar/1.0.0/mod.ts", "/@foo/bar/1.0.0/bad.ts":
+			w.Write(source)
+		case "/@foo/bar/1.0.0/large.wasm":
+			w.Header().Set("Content-Length", strconv.Itoa(maxAssetFileSize+1))
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	workDir := config.WorkDir
+	jsrRegistry := config.JsrRegistry
+	defer func() {
+		config.WorkDir = workDir
+		config.JsrRegistry = jsrRegistry
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "jsr_test_"+rand.Hex.String(8))
+	config.JsrRegistry = server.URL + "/"
+	defer os.RemoveAll(config.WorkDir)
+
+	vm, err := getJsrVersionMeta("foo", "bar", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := vm.toPackageJSON("@jsr/foo__bar", "1.0.0")
+	if p.Dependencies["@jsr/std__path"] != "^1.0.0" || p.Dependencies["react"] != "^19.0.0" {
+		t.Fatalf("invalid dependencies %v", p.Dependencies)
+	}
+	if v, ok := p.Exports.Get("."); !ok {
+		t.Fatal("missing exports")
+	} else if obj, ok := v.(JSONObject); !ok {
+		t.Fatal("invalid exports")
+	} else if types, _ := obj.Get("types"); types != "./mod.ts" {
+		t.Fatalf("invalid types %v", types)
+	}
+
+	installDir := path.Join(config.WorkDir, "npm", "@jsr/foo__bar@1.0.0")
+	err = jsrInstall(installDir, "@jsr/foo__bar", "foo", "bar", "1.0.0")
+	if err == nil || err.Error() != "checksum mismatch of /bad.ts" {
+		t.Fatalf("shoud be checksum mismatch, got %v", err)
+	}
+	if existsDir(installDir) {
+		t.Fatal("install dir shoud be removed")
+	}
+
+	delete(vm.Manifest, "/bad.ts")
+	err = jsrInstall(installDir, "@jsr/foo__bar", "foo", "bar", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existsFile(path.Join(installDir, "node_modules", "@jsr/foo__bar", "mod.ts")) || !existsFile(path.Join(installDir, "node_modules", "@jsr/foo__bar", "package.json")) {
+		t.Fatal("package shoud be installed")
+	}
+
+	// files larger than the `maxAssetFileSize` are rejected
+	err = fetchRegistryFile(server.URL+"/@foo/bar/1.0.0/large.wasm", installDir, "/large.wasm", "")
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("shoud be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LicensePolicy defines the licenses (SPDX identifiers) that are allowed or denied to be installed and bundled.
+// The packages without license are checked as "UNKNOWN".
+type LicensePolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// IsEmpty returns true if the policy has no rules.
+func (policy *LicensePolicy) IsEmpty() bool {
+	return len(policy.Allow) == 0 && len(policy.Deny) == 0
+}
+
+// IsLicenseAllowed checks the license with the policy, the license can be a SPDX expression,
+// e.g. "MIT OR Apache-2.0" is allowed if any of the licenses is allowed, "MIT AND CC-BY-4.0"
+// is allowed only if both of the licenses are allowed.
+func (policy *LicensePolicy) IsLicenseAllowed(license string) bool {
+	if policy.IsEmpty() {
+		return true
+	}
+	license = strings.TrimSpace(license)
+	if license == "" {
+		license = "UNKNOWN"
+	}
+	expr, err := parseSPDXExpression(license)
+	if err != nil {
+		// not a SPDX expression, e.g. "SEE LICENSE IN LICENSE.md"
+		return policy.isIdentifierAllowed(license)
+	}
+	return expr.eval(policy.isIdentifierAllowed)
+}
+
+func (policy *LicensePolicy) isIdentifierAllowed(id string) bool {
+	// "GPL-2.0+" and "GPL-2.0 WITH Classpath-exception-2.0" are checked as "GPL-2.0" as well
+	ids := []string{id}
+	if base, _, ok := strings.Cut(id, " WITH "); ok {
+		ids = append(ids, base)
+		id = base
+	}
+	if strings.HasSuffix(id, "+") {
+		ids = append(ids, strings.TrimSuffix(id, "+"))
+	}
+	for _, s := range ids {
+		if containsFold(policy.Deny, s) {
+			return false
+		}
+	}
+	if len(policy.Allow) == 0 {
+		return true
+	}
+	for _, s := range ids {
+		if containsFold(policy.Allow, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLicensePolicy returns an error if the license of the package is not allowed by the license policy.
+func checkLicensePolicy(pkg string, license string) error {
+	if !config.LicensePolicy.IsLicenseAllowed(license) {
+		if license == "" {
+			license = "UNKNOWN"
+		}
+		return fmt.Errorf("the license '%s' of package '%s' is not allowed by the license policy", license, pkg)
+	}
+	return nil
+}
+
+// checkBuildLicenses checks the licenses of the build meta, see `BuildMeta.Licenses`.
+func checkBuildLicenses(licenses []string) error {
+	for _, s := range licenses {
+		pkg, license := parseBuildLicense(s)
+		if err := checkLicensePolicy(pkg, license); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLicensePolicyError returns true if the error is returned by the license policy checking.
+func isLicensePolicyError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), " is not allowed by the license policy")
+}
+
+// spdxExpression is the parsed SPDX license expression.
+type spdxExpression struct {
+	// "AND", "OR", or "" for the license identifier
+	op    string
+	id    string
+	left  *spdxExpression
+	right *spdxExpression
+}
+
+func (expr *spdxExpression) eval(isAllowed func(id string) bool) bool {
+	switch expr.op {
+	case "AND":
+		return expr.left.eval(isAllowed) && expr.right.eval(isAllowed)
+	case "OR":
+		return expr.left.eval(isAllowed) || expr.right.eval(isAllowed)
+	default:
+		return isAllowed(expr.id)
+	}
+}
+
+// parseSPDXExpression parses the SPDX license expression, the `AND` operator takes precedence over `OR`.
+// see https://spdx.github.io/spdx-spec/v2.3/SPDX-license-expressions/
+func parseSPDXExpression(s string) (*spdxExpression, error) {
+	p := &spdxParser{tokens: strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s))}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token '%s'", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+type spdxParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *spdxParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *spdxParser) parseOr() (*spdxExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &spdxExpression{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *spdxParser) parseAnd() (*spdxExpression, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "AND") {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &spdxExpression{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *spdxParser) parseTerm() (*spdxExpression, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return expr, nil
+	case token == ")" || isSPDXOperator(token):
+		return nil, fmt.Errorf("unexpected token '%s'", token)
+	}
+	p.pos++
+	id := token
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.pos++
+		exception := p.peek()
+		if exception == "" || exception == "(" || exception == ")" || isSPDXOperator(exception) {
+			return nil, fmt.Errorf("missing license exception")
+		}
+		p.pos++
+		id += " WITH " + exception
+	}
+	return &spdxExpression{id: id}, nil
+}
+
+func isSPDXOperator(token string) bool {
+	return strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") || strings.EqualFold(token, "WITH")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestLicensePolicy(t *testing.T) {
+	policy := &LicensePolicy{
+		Allow: []string{"MIT", "ISC", "Apache-2.0", "GPL-2.0"},
+		Deny:  []string{"AGPL-3.0"},
+	}
+	for license, allowed := range map[string]bool{
+		"MIT":                                  true,
+		"mit":                                  true,
+		"BSD-3-Clause":                         false,
+		"(MIT OR Apache-2.0)":                  true,
+		"BSD-3-Clause OR ISC":                  true,
+		"MIT AND BSD-3-Clause":                 false,
+		"MIT AND (ISC OR BSD-3-Clause)":        true,
+		"BSD-3-Clause AND MIT OR ISC":          true,
+		"AGPL-3.0 OR MIT":                      true,
+		"AGPL-3.0 AND MIT":                     false,
+		"GPL-2.0+":                             true,
+		"GPL-2.0 WITH Classpath-exception-2.0": true,
+		"SEE LICENSE IN LICENSE.md":            false,
+		"":                                     false,
+		"(MIT":                                 false,
+	} {
+		if policy.IsLicenseAllowed(license) != allowed {
+			t.Fatalf("the license '%s' shoud be allowed: %v", license, allowed)
+		}
+	}
+
+	policy = &LicensePolicy{Deny: []string{"GPL-3.0", "UNKNOWN"}}
+	for license, allowed := range map[string]bool{
+		"MIT":                  true,
+		"GPL-3.0+":             false,
+		"GPL-3.0 OR MIT":       true,
+		"":                     false,
+		"UNLICENSED":           true,
+		"(GPL-3.0 AND MIT)":    false,
+		"(MIT) OR (GPL-3.0)":   true,
+		"Apache-2.0 WITH LLVM": true,
+	} {
+		if policy.IsLicenseAllowed(license) != allowed {
+			t.Fatalf("the license '%s' shoud be allowed: %v", license, allowed)
+		}
+	}
+
+	if !(&LicensePolicy{}).IsLicenseAllowed("") {
+		t.Fatal("empty policy shoud allow any license")
+	}
+}
+
+func TestParseSPDXExpression(t *testing.T) {
+	for _, s := range []string{"MIT OR", "AND MIT", "(MIT", "MIT)", "MIT WITH", "MIT ISC"} {
+		if _, err := parseSPDXExpression(s); err == nil {
+			t.Fatalf("'%s' shoud be an invalid expression", s)
+		}
+	}
+	expr, err := parseSPDXExpression("MIT OR ISC AND (Apache-2.0 WITH LLVM-exception)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.op != "OR" || expr.left.id != "MIT" || expr.right.op != "AND" || expr.right.right.id != "Apache-2.0 WITH LLVM-exception" {
+		t.Fatalf("invalid expression %v", expr)
+	}
+}
+
+func TestInstallDependenciesLicensePolicy(t *testing.T) {
+	server := newTestNpmRegistry(t)
+	defer server.Close()
+	server.addPackage(t, "foo", "1.0.0", "MIT", map[string]string{"bar": "^1.0.0"})
+	server.addPackage(t, "bar", "1.0.0", "GPL-3.0", nil)
+
+	workDir := config.WorkDir
+	defer func() { config.WorkDir = workDir }()
+	config.WorkDir = path.Join(os.TempDir(), "license_policy_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(config.WorkDir)
+
+	policy := config.LicensePolicy
+	defer func() { config.LicensePolicy = policy }()
+	config.LicensePolicy = LicensePolicy{Allow: []string{"MIT"}}
+
+	npmrc := &NpmRC{NpmRegistry: NpmRegistry{Registry: server.URL + "/"}}
+	p, err := npmrc.installPackage(Package{Name: "foo", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd := path.Join(config.WorkDir, "wd")
+	ensureDir(path.Join(wd, "node_modules"))
+
+	// the denied licenses of the installed dependencies don't fail the installation, the build
+	// fails only if they are bundled
+	installed := npmrc.installDependencies(wd, p, false, nil)
+	if len(installed) != 1 || installed[0].Name != "bar" || installed[0].License != "GPL-3.0" {
+		t.Fatalf("invalid installed packages %v", installed)
+	}
+	if !existsFile(path.Join(wd, "node_modules", "bar", "index.js")) {
+		t.Fatal("the dependency shoud be installed")
+	}
+}
@@ -24,6 +24,8 @@ type LoaderOutput struct {
 }
 
 func runLoader(loaderJsPath string, filename string, code string) (output *LoaderOutput, err error) {
+	// prevent the store GC from removing the loader
+	markStoreUsed(path.Dir(loaderJsPath))
 	stdout, recycle := NewBuffer()
 	defer recycle()
 	stderr, recycle := NewBuffer()
@@ -78,9 +78,11 @@ func validateModuleFile(filename string) (isESM bool, namedExports []string, err
 }
 
 // minify minifies the given javascript code.
-func minify(code string, loader esbuild.Loader, target esbuild.Target) ([]byte, error) {
+func minify(code string, loader esbuild.Loader, target string) ([]byte, error) {
+	esTarget, engines := getEsbuildTarget(target)
 	ret := esbuild.Transform(code, esbuild.TransformOptions{
-		Target:            target,
+		Target:            esTarget,
+		Engines:           engines,
 		Format:            esbuild.FormatESModule,
 		Platform:          esbuild.PlatformBrowser,
 		MinifyWhitespace:  true,
@@ -95,7 +97,7 @@ func minify(code string, loader esbuild.Loader, target esbuild.Target) ([]byte,
 	return concatBytes(ret.LegalComments, ret.Code), nil
 }
 
-func treeShake(code []byte, exports []string, target esbuild.Target) ([]byte, error) {
+func treeShake(code []byte, exports []string, target string) ([]byte, error) {
 	input := &esbuild.StdinOptions{
 		Contents: fmt.Sprintf(`export { %s } from '.';`, strings.Join(exports, ", ")),
 		Loader:   esbuild.LoaderJS,
@@ -117,11 +119,13 @@ func treeShake(code []byte, exports []string, target esbuild.Target) ([]byte, er
 			},
 		},
 	}
+	esTarget, engines := getEsbuildTarget(target)
 	ret := esbuild.Build(esbuild.BuildOptions{
 		Stdin:             input,
 		Bundle:            true,
 		Format:            esbuild.FormatESModule,
-		Target:            target,
+		Target:            esTarget,
+		Engines:           engines,
 		Platform:          esbuild.PlatformBrowser,
 		MinifyWhitespace:  config.Minify,
 		MinifyIdentifiers: config.Minify,
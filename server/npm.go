@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -40,12 +41,16 @@ type Package struct {
 	Name     string
 	Version  string
 	Github   bool
+	GitHost  string // the git host of the repository, empty for github.com
 	PkgPrNew bool
 }
 
 func (p *Package) String() string {
 	s := p.Name + "@" + p.Version
 	if p.Github {
+		if p.GitHost != "" {
+			return "git/" + p.GitHost + "/" + s
+		}
 		return "gh/" + s
 	}
 	if p.PkgPrNew {
@@ -62,53 +67,101 @@ type NpmPackageMetadata struct {
 
 // PackageJSONRaw defines the package.json of a NPM package
 type PackageJSONRaw struct {
-	Name             string          `json:"name"`
-	Version          string          `json:"version"`
-	Type             string          `json:"type"`
-	Main             JSONAny         `json:"main"`
-	Module           JSONAny         `json:"module"`
-	ES2015           JSONAny         `json:"es2015"`
-	JsNextMain       JSONAny         `json:"jsnext:main"`
-	Browser          JSONAny         `json:"browser"`
-	Types            JSONAny         `json:"types"`
-	Typings          JSONAny         `json:"typings"`
-	SideEffects      any             `json:"sideEffects"`
-	Dependencies     any             `json:"dependencies"`
-	PeerDependencies any             `json:"peerDependencies"`
-	Imports          any             `json:"imports"`
-	TypesVersions    any             `json:"typesVersions"`
-	Exports          json.RawMessage `json:"exports"`
-	Esmsh            any             `json:"esm.sh"`
-	Dist             json.RawMessage `json:"dist"`
-	Deprecated       any             `json:"deprecated"`
+	Name                 string          `json:"name"`
+	Version              string          `json:"version"`
+	Type                 string          `json:"type"`
+	Main                 JSONAny         `json:"main"`
+	Module               JSONAny         `json:"module"`
+	ES2015               JSONAny         `json:"es2015"`
+	JsNextMain           JSONAny         `json:"jsnext:main"`
+	Browser              JSONAny         `json:"browser"`
+	Types                JSONAny         `json:"types"`
+	Typings              JSONAny         `json:"typings"`
+	SideEffects          any             `json:"sideEffects"`
+	Dependencies         any             `json:"dependencies"`
+	PeerDependencies     any             `json:"peerDependencies"`
+	OptionalDependencies any             `json:"optionalDependencies"`
+	Os                   any             `json:"os"`
+	Cpu                  any             `json:"cpu"`
+	Libc                 any             `json:"libc"`
+	Imports              any             `json:"imports"`
+	TypesVersions        any             `json:"typesVersions"`
+	Exports              json.RawMessage `json:"exports"`
+	Esmsh                any             `json:"esm.sh"`
+	Dist                 json.RawMessage `json:"dist"`
+	Deprecated           any             `json:"deprecated"`
+	License              any             `json:"license"`
+	Licenses             any             `json:"licenses"`
 }
 
 // NpmPackageDist defines the dist field of a NPM package
 type NpmPackageDist struct {
-	Tarball string `json:"tarball"`
+	Tarball   string `json:"tarball"`
+	Integrity string `json:"integrity"`
+	Shasum    string `json:"shasum"`
 }
 
 // PackageJSON defines the package.json of a NPM package
 type PackageJSON struct {
-	Name             string
-	PkgName          string
-	Version          string
-	Type             string
-	Main             string
-	Module           string
-	Types            string
-	Typings          string
-	SideEffectsFalse bool
-	SideEffects      set.ReadOnlySet[string]
-	Browser          map[string]string
-	Dependencies     map[string]string
-	PeerDependencies map[string]string
-	Imports          map[string]any
-	TypesVersions    map[string]any
-	Exports          JSONObject
-	Esmsh            map[string]any
-	Dist             NpmPackageDist
-	Deprecated       string
+	Name                 string
+	PkgName              string
+	Version              string
+	Type                 string
+	Main                 string
+	Module               string
+	Types                string
+	Typings              string
+	SideEffectsFalse     bool
+	SideEffects          set.ReadOnlySet[string]
+	Browser              map[string]string
+	Dependencies         map[string]string
+	PeerDependencies     map[string]string
+	OptionalDependencies map[string]string
+	Os                   []string
+	Cpu                  []string
+	Libc                 []string
+	Imports              map[string]any
+	TypesVersions        map[string]any
+	Exports              JSONObject
+	Esmsh                map[string]any
+	Dist                 NpmPackageDist
+	Deprecated           string
+	License              string
+	registry             *NpmRegistry // the registry that serves the metadata
+}
+
+// LicenseString returns the SPDX license expression of the package, the deprecated
+// `{ "type": "MIT" }` object and `licenses` array are supported.
+func (a *PackageJSONRaw) LicenseString() string {
+	licenseType := func(v any) string {
+		if s, ok := v.(string); ok {
+			return strings.TrimSpace(s)
+		}
+		if m, ok := v.(map[string]any); ok {
+			if s, ok := m["type"].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+		return ""
+	}
+	if s := licenseType(a.License); s != "" {
+		return s
+	}
+	if arr, ok := a.Licenses.([]any); ok {
+		var licenses []string
+		for _, v := range arr {
+			if s := licenseType(v); s != "" {
+				licenses = append(licenses, s)
+			}
+		}
+		if len(licenses) == 1 {
+			return licenses[0]
+		}
+		if len(licenses) > 1 {
+			return "(" + strings.Join(licenses, " OR ") + ")"
+		}
+	}
+	return ""
 }
 
 // ToNpmPackage converts PackageJSONRaw to PackageJSON
@@ -155,6 +208,23 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 		}
 	}
 
+	// optional dependencies are installed as dependencies, but the install failures are ignored
+	var optionalDeps map[string]string
+	if m, ok := a.OptionalDependencies.(map[string]any); ok {
+		optionalDeps = make(map[string]string)
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				if k != "" && s != "" {
+					optionalDeps[k] = s
+					if dependencies == nil {
+						dependencies = make(map[string]string)
+					}
+					dependencies[k] = s
+				}
+			}
+		}
+	}
+
 	sideEffects := set.New[string]()
 	sideEffectsFalse := false
 	if a.SideEffects != nil {
@@ -205,24 +275,29 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 	}
 
 	p := &PackageJSON{
-		Name:             a.Name,
-		Version:          a.Version,
-		Type:             a.Type,
-		Main:             a.Main.MainString(),
-		Module:           a.Module.MainString(),
-		Types:            a.Types.MainString(),
-		Typings:          a.Typings.MainString(),
-		Browser:          browser,
-		SideEffectsFalse: sideEffectsFalse,
-		SideEffects:      *sideEffects.ReadOnly(),
-		Dependencies:     dependencies,
-		PeerDependencies: peerDependencies,
-		Imports:          toMap(a.Imports),
-		TypesVersions:    toMap(a.TypesVersions),
-		Exports:          exports,
-		Esmsh:            toMap(a.Esmsh),
-		Deprecated:       depreacted,
-		Dist:             dist,
+		Name:                 a.Name,
+		Version:              a.Version,
+		Type:                 a.Type,
+		Main:                 a.Main.MainString(),
+		Module:               a.Module.MainString(),
+		Types:                a.Types.MainString(),
+		Typings:              a.Typings.MainString(),
+		Browser:              browser,
+		SideEffectsFalse:     sideEffectsFalse,
+		SideEffects:          *sideEffects.ReadOnly(),
+		Dependencies:         dependencies,
+		PeerDependencies:     peerDependencies,
+		OptionalDependencies: optionalDeps,
+		Os:                   toStringSlice(a.Os),
+		Cpu:                  toStringSlice(a.Cpu),
+		Libc:                 toStringSlice(a.Libc),
+		Imports:              toMap(a.Imports),
+		TypesVersions:        toMap(a.TypesVersions),
+		Exports:              exports,
+		Esmsh:                toMap(a.Esmsh),
+		Deprecated:           depreacted,
+		License:              a.LicenseString(),
+		Dist:                 dist,
 	}
 
 	// normalize package module field
@@ -240,6 +315,17 @@ func (a *PackageJSONRaw) ToNpmPackage() *PackageJSON {
 	return p
 }
 
+// IsPlatformSpecific returns true if the package is restricted to some platforms by
+// the `os`, `cpu` or `libc` field, e.g. `@esbuild/linux-x64`.
+func (a *PackageJSON) IsPlatformSpecific() bool {
+	return len(a.Os) > 0 || len(a.Cpu) > 0 || len(a.Libc) > 0
+}
+
+// MatchPlatform checks the `os` and `cpu` fields of the package with current platform.
+func (a *PackageJSON) MatchPlatform() bool {
+	return matchNpmPlatform(a.Os, toNpmOS(runtime.GOOS)) && matchNpmPlatform(a.Cpu, toNpmCPU(runtime.GOARCH))
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface
 func (a *PackageJSON) UnmarshalJSON(b []byte) error {
 	var raw PackageJSONRaw
@@ -251,10 +337,11 @@ func (a *PackageJSON) UnmarshalJSON(b []byte) error {
 }
 
 type NpmRegistry struct {
-	Registry string `json:"registry"`
-	Token    string `json:"token"`
-	User     string `json:"user"`
-	Password string `json:"password"`
+	Registry  string        `json:"registry"`
+	Token     string        `json:"token"`
+	User      string        `json:"user"`
+	Password  string        `json:"password"`
+	Fallbacks []NpmRegistry `json:"fallbacks,omitempty"`
 }
 
 type NpmRC struct {
@@ -273,10 +360,11 @@ func DefaultNpmRC() *NpmRC {
 	}
 	defaultNpmRC = &NpmRC{
 		NpmRegistry: NpmRegistry{
-			Registry: config.NpmRegistry,
-			Token:    config.NpmToken,
-			User:     config.NpmUser,
-			Password: config.NpmPassword,
+			Registry:  config.NpmRegistry,
+			Token:     config.NpmToken,
+			User:      config.NpmUser,
+			Password:  config.NpmPassword,
+			Fallbacks: config.NpmFallbackRegistries,
 		},
 		ScopedRegistries: map[string]NpmRegistry{
 			"@jsr": {
@@ -287,10 +375,11 @@ func DefaultNpmRC() *NpmRC {
 	if len(config.NpmScopedRegistries) > 0 {
 		for scope, reg := range config.NpmScopedRegistries {
 			defaultNpmRC.ScopedRegistries[scope] = NpmRegistry{
-				Registry: reg.Registry,
-				Token:    reg.Token,
-				User:     reg.User,
-				Password: reg.Password,
+				Registry:  reg.Registry,
+				Token:     reg.Token,
+				User:      reg.User,
+				Password:  reg.Password,
+				Fallbacks: reg.Fallbacks,
 			}
 		}
 	}
@@ -343,13 +432,25 @@ func (npmrc *NpmRC) getRegistryByPackageName(packageName string) *NpmRegistry {
 }
 
 func (npmrc *NpmRC) getPackageInfo(pkgName string, version string) (packageJson *PackageJSON, err error) {
+	if isOffline() {
+		return getVendoredPackageInfo(pkgName, normalizePackageVersion(version))
+	}
+	if scope, name, ok := npmrc.splitJsrPackageName(pkgName); ok {
+		return getJsrPackageInfo(pkgName, scope, name, normalizePackageVersion(version))
+	}
+	if module, ok := splitDenoXPackageName(pkgName); ok {
+		return getDenoXPackageInfo(pkgName, module, version)
+	}
+
 	reg := npmrc.getRegistryByPackageName(pkgName)
 	getCacheKey := func(pkgName string, pkgVersion string) string {
 		return reg.Registry + pkgName + "@" + pkgVersion
 	}
 
 	version = normalizePackageVersion(version)
-	return withCache(getCacheKey(pkgName, version), time.Duration(config.NpmQueryCacheTTL)*time.Second, func() (*PackageJSON, string, error) {
+	cacheTtl := time.Duration(config.NpmQueryCacheTTL) * time.Second
+	maxStale := time.Duration(config.NpmQueryMaxStale) * time.Second
+	return withStaleCache(getCacheKey(pkgName, version), cacheTtl, maxStale, func() (*PackageJSON, string, error) {
 		// check if the package has been installed
 		if !isDistTag(version) && isExactVersion(version) {
 			var raw PackageJSONRaw
@@ -359,42 +460,31 @@ func (npmrc *NpmRC) getPackageInfo(pkgName string, version string) (packageJson
 			}
 		}
 
-		regUrl := reg.Registry + pkgName
-		isWellknownVersion := (isExactVersion(version) || isDistTag(version)) && strings.HasPrefix(regUrl, npmRegistry)
-		if isWellknownVersion {
-			// npm registry supports url like `https://registry.npmjs.org/<name>/<version>`
-			regUrl += "/" + version
+		isWellknown := func(reg *NpmRegistry) bool {
+			return (isExactVersion(version) || isDistTag(version)) && strings.HasPrefix(reg.Registry, npmRegistry)
 		}
-
-		u, err := url.Parse(regUrl)
-		if err != nil {
-			return nil, "", err
-		}
-
-		header := http.Header{}
-		if reg.Token != "" {
-			header.Set("Authorization", "Bearer "+reg.Token)
-		} else if reg.User != "" && reg.Password != "" {
-			header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(reg.User+":"+reg.Password)))
+		data, notFound, from, err := fetchNpmMetadataWithFailover(reg, func(reg *NpmRegistry) (string, bool) {
+			regUrl := reg.Registry + pkgName
+			if isWellknown(reg) {
+				// npm registry supports url like `https://registry.npmjs.org/<name>/<version>`
+				return regUrl + "/" + version, false
+			}
+			// use the abbreviated metadata to resolve the version range, then get the full package.json
+			// of the resolved version with the `https://registry.npmjs.org/<name>/<version>` url.
+			return regUrl, strings.HasPrefix(regUrl, npmRegistry)
+		})
+		isWellknownVersion := isWellknown(from)
+		abbreviated := !isWellknownVersion && strings.HasPrefix(from.Registry, npmRegistry)
+		// the stale metadata is returned with a `staleError` if the registry is down
+		var stale error
+		if isStaleError(err) {
+			stale, err = err, nil
 		}
-
-		fetchClient, recycle := NewFetchClient(15, "esmd/"+VERSION, false)
-		defer recycle()
-
-		retryTimes := 0
-	RETRY:
-		res, err := fetchClient.Fetch(u, header)
 		if err != nil {
-			if retryTimes < 3 {
-				retryTimes++
-				time.Sleep(time.Duration(retryTimes) * 100 * time.Millisecond)
-				goto RETRY
-			}
-			return nil, "", err
+			return nil, "", fmt.Errorf("could not get metadata of package '%s' (%v)", pkgName, err)
 		}
-		defer res.Body.Close()
 
-		if res.StatusCode == 404 || res.StatusCode == 401 {
+		if notFound {
 			if isWellknownVersion {
 				err = fmt.Errorf("version %s of '%s' not found", version, pkgName)
 			} else {
@@ -403,22 +493,19 @@ func (npmrc *NpmRC) getPackageInfo(pkgName string, version string) (packageJson
 			return nil, "", err
 		}
 
-		if res.StatusCode != 200 {
-			msg, _ := io.ReadAll(res.Body)
-			return nil, "", fmt.Errorf("could not get metadata of package '%s' (%s: %s)", pkgName, res.Status, string(msg))
-		}
-
 		if isWellknownVersion {
 			var raw PackageJSONRaw
-			err = json.NewDecoder(res.Body).Decode(&raw)
+			err = json.Unmarshal(data, &raw)
 			if err != nil {
 				return nil, "", err
 			}
-			return raw.ToNpmPackage(), getCacheKey(pkgName, raw.Version), nil
+			p := raw.ToNpmPackage()
+			p.registry = from
+			return p, getCacheKey(pkgName, raw.Version), stale
 		}
 
 		var metadata NpmPackageMetadata
-		err = json.NewDecoder(res.Body).Decode(&metadata)
+		err = json.Unmarshal(data, &metadata)
 		if err != nil {
 			return nil, "", err
 		}
@@ -427,56 +514,75 @@ func (npmrc *NpmRC) getPackageInfo(pkgName string, version string) (packageJson
 			return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
 		}
 
-	CHECK:
-		distVersion, ok := metadata.DistTags[version]
-		if ok {
-			raw, ok := metadata.Versions[distVersion]
-			if ok {
-				return raw.ToNpmPackage(), getCacheKey(pkgName, raw.Version), nil
-			}
-		} else {
-			if version == "lastest" {
-				return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
-			}
-			var c *semver.Constraints
-			c, err = semver.NewConstraint(version)
-			if err != nil {
-				// fallback to latest if semverOrDistTag is not a valid semver
-				version = "latest"
-				goto CHECK
-			}
-			vs := make([]*semver.Version, len(metadata.Versions))
-			i := 0
-			for v := range metadata.Versions {
-				// ignore prerelease versions
-				if !strings.ContainsRune(version, '-') && strings.ContainsRune(v, '-') {
-					continue
-				}
-				var ver *semver.Version
-				ver, err = semver.NewVersion(v)
-				if err != nil {
-					return nil, "", err
-				}
-				if c.Check(ver) {
-					vs[i] = ver
-					i++
-				}
-			}
-			if i > 0 {
-				vs = vs[:i]
-				if i > 1 {
-					sort.Sort(semver.Collection(vs))
-				}
-				raw, ok := metadata.Versions[vs[i-1].String()]
-				if ok {
-					return raw.ToNpmPackage(), getCacheKey(pkgName, raw.Version), nil
+		resolved := func(raw PackageJSONRaw) (*PackageJSON, string, error) {
+			if abbreviated {
+				p, err := npmrc.getPackageInfo(pkgName, raw.Version)
+				if err == nil && stale != nil {
+					err = stale
 				}
+				return p, "", err
 			}
+			p := raw.ToNpmPackage()
+			p.registry = from
+			return p, getCacheKey(pkgName, raw.Version), stale
+		}
+
+		raw, ok, err := metadata.resolveVersion(version)
+		if err != nil {
+			return nil, "", err
+		}
+		if ok {
+			return resolved(raw)
 		}
 		return nil, "", fmt.Errorf("version %s of '%s' not found", version, pkgName)
 	})
 }
 
+// resolveVersion resolves the version of the metadata by the dist tag or the semver range, an
+// invalid semver range falls back to the "latest" tag.
+func (metadata *NpmPackageMetadata) resolveVersion(version string) (raw PackageJSONRaw, ok bool, err error) {
+CHECK:
+	distVersion, ok := metadata.DistTags[version]
+	if ok {
+		raw, ok = metadata.Versions[distVersion]
+		return
+	}
+	if version == "lastest" {
+		return
+	}
+	c, e := semver.NewConstraint(version)
+	if e != nil {
+		// fallback to latest if semverOrDistTag is not a valid semver
+		version = "latest"
+		goto CHECK
+	}
+	vs := make([]*semver.Version, len(metadata.Versions))
+	i := 0
+	for v := range metadata.Versions {
+		// ignore prerelease versions
+		if !strings.ContainsRune(version, '-') && strings.ContainsRune(v, '-') {
+			continue
+		}
+		var ver *semver.Version
+		ver, err = semver.NewVersion(v)
+		if err != nil {
+			return
+		}
+		if c.Check(ver) {
+			vs[i] = ver
+			i++
+		}
+	}
+	if i > 0 {
+		vs = vs[:i]
+		if i > 1 {
+			sort.Sort(semver.Collection(vs))
+		}
+		raw, ok = metadata.Versions[vs[i-1].String()]
+	}
+	return
+}
+
 func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err error) {
 	installDir := path.Join(npmrc.StoreDir(), pkg.String())
 	packageJsonPath := path.Join(installDir, "node_modules", pkg.Name, "package.json")
@@ -485,6 +591,7 @@ func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err e
 	var raw PackageJSONRaw
 	if utils.ParseJSONFile(packageJsonPath, &raw) == nil {
 		packageJson = raw.ToNpmPackage()
+		markStoreUsed(installDir)
 		return
 	}
 
@@ -499,7 +606,7 @@ func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err e
 	}
 
 	if pkg.Github {
-		err = ghInstall(installDir, pkg.Name, pkg.Version)
+		err = gitInstall(installDir, pkg.GitHost, pkg.Name, pkg.Version)
 		// ensure 'package.json' file if not exists after installing from github
 		if err == nil && !existsFile(packageJsonPath) {
 			buf := bytes.NewBuffer(nil)
@@ -549,8 +656,16 @@ func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err e
 				return
 			}
 		}
+	} else if scope, name, ok := npmrc.splitJsrPackageName(pkg.Name); ok {
+		var info *PackageJSON
+		info, err = npmrc.getPackageInfo(pkg.Name, pkg.Version)
+		if err == nil {
+			err = jsrInstall(installDir, pkg.Name, scope, name, info.Version)
+		}
+	} else if module, ok := splitDenoXPackageName(pkg.Name); ok {
+		err = denoXInstall(installDir, pkg.Name, module, pkg.Version)
 	} else if pkg.PkgPrNew {
-		err = fetchPackageTarball(&NpmRegistry{}, installDir, pkg.Name, "https://pkg.pr.new/"+pkg.Name+"@"+pkg.Version)
+		err = npmrc.fetchPackageTarball(&NpmRegistry{}, installDir, pkg.Name, pkg.Version, "https://pkg.pr.new/"+pkg.Name+"@"+pkg.Version, "")
 	} else {
 		info, fetchErr := npmrc.getPackageInfo(pkg.Name, pkg.Version)
 		if fetchErr != nil {
@@ -559,7 +674,12 @@ func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err e
 		if info.Deprecated != "" {
 			os.WriteFile(path.Join(installDir, "deprecated.txt"), []byte(info.Deprecated), 0644)
 		}
-		err = fetchPackageTarball(npmrc.getRegistryByPackageName(pkg.Name), installDir, info.Name, info.Dist.Tarball)
+		// fetch the tarball from the registry that serves the metadata
+		reg := info.registry
+		if reg == nil {
+			reg = npmrc.getRegistryByPackageName(pkg.Name)
+		}
+		err = npmrc.fetchPackageTarball(reg, installDir, info.Name, info.Version, info.Dist.Tarball, info.Dist.toIntegrity())
 	}
 	if err != nil {
 		return
@@ -576,8 +696,10 @@ func (npmrc *NpmRC) installPackage(pkg Package) (packageJson *PackageJSON, err e
 	return
 }
 
-func (npmrc *NpmRC) installDependencies(wd string, pkgJson *PackageJSON, npmMode bool, mark *set.Set[string]) {
+// installDependencies installs the dependencies of the package recursively, it returns the installed packages.
+func (npmrc *NpmRC) installDependencies(wd string, pkgJson *PackageJSON, npmMode bool, mark *set.Set[string]) (installed []*PackageJSON) {
 	wg := sync.WaitGroup{}
+	lock := sync.Mutex{}
 	dependencies := map[string]string{}
 	for name, version := range pkgJson.Dependencies {
 		dependencies[name] = version
@@ -596,8 +718,8 @@ func (npmrc *NpmRC) installDependencies(wd string, pkgJson *PackageJSON, npmMode
 		go func(name, version string) {
 			defer wg.Done()
 			pkg := Package{Name: name, Version: version}
-			p, err := resolveDependencyVersion(version)
-			if err != nil {
+			p, e := resolveDependencyVersion(version)
+			if e != nil {
 				return
 			}
 			if p.Name != "" {
@@ -607,6 +729,19 @@ func (npmrc *NpmRC) installDependencies(wd string, pkgJson *PackageJSON, npmMode
 				// skip installing `@types/*` packages
 				return
 			}
+			_, optional := pkgJson.OptionalDependencies[name]
+			if optional && !pkg.Github && !pkg.PkgPrNew {
+				p, e := npmrc.getPackageInfo(pkg.Name, pkg.Version)
+				if e != nil {
+					return
+				}
+				// skip the platform-specific optional dependencies (native modules) unless they
+				// match current platform in _npm_ mode
+				if p.IsPlatformSpecific() && (!npmMode || !p.MatchPlatform()) {
+					return
+				}
+				pkg.Version = p.Version
+			}
 			if !isExactVersion(pkg.Version) && !pkg.Github && !pkg.PkgPrNew {
 				p, e := npmrc.getPackageInfo(pkg.Name, pkg.Version)
 				if e != nil {
@@ -619,26 +754,33 @@ func (npmrc *NpmRC) installDependencies(wd string, pkgJson *PackageJSON, npmMode
 				return
 			}
 			mark.Add(markId)
-			installed, err := npmrc.installPackage(pkg)
-			if err != nil {
+			dep, e := npmrc.installPackage(pkg)
+			if e != nil {
 				return
 			}
+			lock.Lock()
+			installed = append(installed, dep)
+			lock.Unlock()
 			// link the installed package to the node_modules directory of current build context
 			linkDir := path.Join(wd, "node_modules", name)
-			_, err = os.Lstat(linkDir)
-			if err != nil && os.IsNotExist(err) {
+			_, e = os.Lstat(linkDir)
+			if e != nil && os.IsNotExist(e) {
 				if strings.ContainsRune(name, '/') {
 					ensureDir(path.Dir(linkDir))
 				}
 				os.Symlink(path.Join(npmrc.StoreDir(), pkg.String(), "node_modules", pkg.Name), linkDir)
 			}
 			// install dependencies recursively
-			if len(installed.Dependencies) > 0 || (len(installed.PeerDependencies) > 0 && npmMode) {
-				npmrc.installDependencies(wd, installed, npmMode, mark)
+			if len(dep.Dependencies) > 0 || (len(dep.PeerDependencies) > 0 && npmMode) {
+				deps := npmrc.installDependencies(wd, dep, npmMode, mark)
+				lock.Lock()
+				installed = append(installed, deps...)
+				lock.Unlock()
 			}
 		}(name, version)
 	}
 	wg.Wait()
+	return
 }
 
 // If the package is deprecated, a depreacted.txt file will be created by the `intallPackage` function
@@ -654,7 +796,17 @@ func (npmrc *NpmRC) isDeprecated(pkgName string, pkgVersion string) (string, err
 	return string(data), nil
 }
 
-func fetchPackageTarball(reg *NpmRegistry, installDir string, pkgName string, tarballUrl string) (err error) {
+func (npmrc *NpmRC) fetchPackageTarball(reg *NpmRegistry, installDir string, pkgName string, pkgVersion string, tarballUrl string, integrity string) (err error) {
+	if isOffline() {
+		return installVendoredTarball(installDir, pkgName, pkgVersion, integrity)
+	}
+
+	// check the shared tarball storage first
+	cacheKey := getTarballCacheKey(npmrc.zoneId, reg, pkgName, pkgVersion, integrity)
+	if loadCachedTarball(cacheKey, installDir, pkgName, integrity) {
+		return nil
+	}
+
 	u, err := url.Parse(tarballUrl)
 	if err != nil {
 		return
@@ -694,7 +846,34 @@ RETRY:
 		return
 	}
 
-	err = extractPackageTarball(installDir, pkgName, io.LimitReader(res.Body, maxPackageTarballSize))
+	verifier := newIntegrityVerifier(integrity)
+	body := io.TeeReader(io.LimitReader(res.Body, maxPackageTarballSize), verifier)
+
+	// keep a copy of the tarball to fill the shared tarball storage
+	var tarballFile *os.File
+	if npmTarballStorage != nil && cacheKey != "" {
+		tarballFile, err = os.CreateTemp("", "esmd-tarball-*.tgz")
+		if err == nil {
+			body = io.TeeReader(body, tarballFile)
+		}
+	}
+
+	err = extractPackageTarball(installDir, pkgName, body)
+	if err == nil {
+		// drain the body to verify the whole tarball
+		_, err = io.Copy(io.Discard, body)
+	}
+	if err == nil && !verifier.Verify() {
+		err = fmt.Errorf("could not install package '%s': %w", path.Base(installDir), errIntegrityMismatch)
+	}
+	if tarballFile != nil {
+		tarballFile.Close()
+		if err == nil {
+			go saveCachedTarball(cacheKey, tarballFile.Name())
+		} else {
+			os.Remove(tarballFile.Name())
+		}
+	}
 	if err != nil {
 		// clear installDir if failed to extract tarball
 		os.RemoveAll(installDir)
@@ -789,22 +968,50 @@ func resolveDependencyVersion(v string) (Package, error) {
 		return Package{
 			Github:  true,
 			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(fragment), "semver:"),
+			Version: url.QueryEscape(strings.TrimPrefix(fragment, "semver:")),
+		}, nil
+	}
+	if strings.HasPrefix(v, "gitlab:") || strings.HasPrefix(v, "bitbucket:") {
+		provider, rest := utils.SplitByFirstByte(v, ':')
+		hostname := provider + ".com"
+		if provider == "bitbucket" {
+			hostname = "bitbucket.org"
+		}
+		if _, ok := getGitHost(hostname); !ok {
+			return Package{}, errors.New("unsupported git dependency")
+		}
+		repo, fragment := utils.SplitByLastByte(rest, '#')
+		return Package{
+			Github:  true,
+			GitHost: hostname,
+			Name:    repo,
+			Version: url.QueryEscape(strings.TrimPrefix(fragment, "semver:")),
 		}, nil
 	}
 	if strings.HasPrefix(v, "git+ssh://") || strings.HasPrefix(v, "git+https://") || strings.HasPrefix(v, "git://") {
 		gitUrl, e := url.Parse(v)
-		if e != nil || gitUrl.Hostname() != "github.com" {
+		if e != nil {
+			return Package{}, errors.New("unsupported git dependency")
+		}
+		hostname := gitUrl.Hostname()
+		if hostname == "github.com" {
+			hostname = ""
+		} else if _, ok := getGitHost(hostname); !ok {
 			return Package{}, errors.New("unsupported git dependency")
 		}
 		repo := strings.TrimSuffix(gitUrl.Path[1:], ".git")
 		if gitUrl.Scheme == "git+ssh" {
 			repo = gitUrl.Port() + "/" + repo
 		}
+		// only `owner/name` repositories are supported
+		if strings.Count(repo, "/") != 1 {
+			return Package{}, errors.New("unsupported git dependency")
+		}
 		return Package{
 			Github:  true,
+			GitHost: hostname,
 			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(gitUrl.Fragment), "semver:"),
+			Version: url.QueryEscape(strings.TrimPrefix(gitUrl.Fragment, "semver:")),
 		}, nil
 	}
 	// https://pkg.pr.new
@@ -833,7 +1040,7 @@ func resolveDependencyVersion(v string) (Package, error) {
 		return Package{
 			Github:  true,
 			Name:    repo,
-			Version: strings.TrimPrefix(url.QueryEscape(fragment), "semver:"),
+			Version: url.QueryEscape(strings.TrimPrefix(fragment, "semver:")),
 		}, nil
 	}
 	return Package{}, nil
@@ -923,6 +1130,68 @@ func toTypesPackageName(pkgName string) string {
 	return "@types/" + pkgName
 }
 
+// matchNpmPlatform checks the value with the `os`/`cpu` list of the package.json,
+// the list may contain blocked values with the `!` prefix, e.g. `["!win32"]`.
+func matchNpmPlatform(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	allowed := false
+	hasAllowList := false
+	for _, v := range list {
+		if strings.HasPrefix(v, "!") {
+			if v[1:] == value {
+				return false
+			}
+		} else {
+			hasAllowList = true
+			if v == value {
+				allowed = true
+			}
+		}
+	}
+	return allowed || !hasAllowList
+}
+
+// toNpmOS converts the GOOS to the `process.platform` of Node.js
+func toNpmOS(goos string) string {
+	if goos == "windows" {
+		return "win32"
+	}
+	return goos
+}
+
+// toNpmCPU converts the GOARCH to the `process.arch` of Node.js
+func toNpmCPU(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "ia32"
+	default:
+		return goarch
+	}
+}
+
+// toStringSlice converts a string or an array of strings to a `[]string`
+func toStringSlice(v any) []string {
+	switch a := v.(type) {
+	case string:
+		if a != "" {
+			return []string{a}
+		}
+	case []any:
+		ret := make([]string, 0, len(a))
+		for _, v := range a {
+			if s, ok := v.(string); ok && s != "" {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
 // toMap converts any value to a `map[string]any`
 func toMap(v any) map[string]any {
 	if m, ok := v.(map[string]any); ok {
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the abbreviated metadata format, see https://github.com/npm/registry/blob/main/docs/responses/package-metadata.md
+	npmAbbreviatedMetadataAccept = "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*"
+)
+
+// fetchNpmMetadata fetches the metadata from the registry. The response is persisted in the
+// work directory with the `ETag`/`Last-Modified` validators, the next fetch revalidates it
+// with a conditional request instead of downloading the whole document again. The cached
+// metadata is also used as the fallback when the registry is down, it's returned with a
+// `staleError` and is refused once it's older than the `npmQueryMaxStale`.
+func fetchNpmMetadata(reg *NpmRegistry, regUrl string, abbreviated bool) (data []byte, notFound bool, err error) {
+	return fetchRegistryMetadata(reg, regUrl, abbreviated, true)
+}
+
+// fetchRegistryMetadata fetches the metadata from the registry, the cached metadata is returned
+// with a `staleError` on network errors or 5xx responses if `staleIfError` is true, otherwise
+// the error is returned to let the caller try the fallback registries.
+func fetchRegistryMetadata(reg *NpmRegistry, regUrl string, abbreviated bool, staleIfError bool) (data []byte, notFound bool, err error) {
+	u, err := url.Parse(regUrl)
+	if err != nil {
+		return
+	}
+	if isOffline() {
+		return nil, false, fmt.Errorf("offline: %s is not vendored", u.Redacted())
+	}
+
+	header := getNpmMetadataHeader(reg, abbreviated)
+	cachePath := getNpmMetadataCachePath(regUrl, header)
+	etag, lastModified, fetchedAt, cached := readNpmMetadataCache(cachePath)
+	if cached != nil {
+		if etag != "" {
+			header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	// skip the registry if the circuit is open
+	if !isRegistryAvailable(reg.Registry) {
+		if staleIfError {
+			data, err = useStaleNpmMetadata(reg, fetchedAt, cached, errRegistryUnavailable)
+			return
+		}
+		return nil, false, errRegistryUnavailable
+	}
+
+	fetchClient, recycle := NewFetchClient(15, "esmd/"+VERSION, false)
+	defer recycle()
+
+	retryTimes := 0
+RETRY:
+	res, err := fetchClient.Fetch(u, header)
+	if err != nil {
+		if retryTimes < 3 {
+			retryTimes++
+			time.Sleep(time.Duration(retryTimes) * 100 * time.Millisecond)
+			goto RETRY
+		}
+		reportRegistryFailure(reg.Registry)
+		// fallback to the last known good metadata if the registry is down
+		if staleIfError {
+			data, err = useStaleNpmMetadata(reg, fetchedAt, cached, err)
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 || res.StatusCode == 429 {
+		reportRegistryFailure(reg.Registry)
+		msg, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("%s: %s", res.Status, string(msg))
+		if staleIfError {
+			data, err = useStaleNpmMetadata(reg, fetchedAt, cached, err)
+		}
+		return
+	}
+	reportRegistrySuccess(reg.Registry)
+
+	if res.StatusCode == 304 && cached != nil {
+		// renew the fetch time of the cache, the mtime is also used by the GC
+		writeNpmMetadataCache(cachePath, etag, lastModified, cached)
+		return cached, false, nil
+	}
+
+	if res.StatusCode == 404 || res.StatusCode == 401 {
+		return nil, true, nil
+	}
+
+	if res.StatusCode != 200 {
+		msg, _ := io.ReadAll(res.Body)
+		err = fmt.Errorf("%s: %s", res.Status, string(msg))
+		return
+	}
+
+	data, err = io.ReadAll(res.Body)
+	if err != nil {
+		return
+	}
+
+	etag = res.Header.Get("ETag")
+	lastModified = res.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		writeNpmMetadataCache(cachePath, etag, lastModified, data)
+	}
+	return
+}
+
+func getNpmMetadataHeader(reg *NpmRegistry, abbreviated bool) http.Header {
+	header := http.Header{}
+	if reg.Token != "" {
+		header.Set("Authorization", "Bearer "+reg.Token)
+	} else if reg.User != "" && reg.Password != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(reg.User+":"+reg.Password)))
+	}
+	if abbreviated {
+		header.Set("Accept", npmAbbreviatedMetadataAccept)
+	}
+	return header
+}
+
+// readStaleNpmMetadata returns the cached metadata without revalidation, see `useStaleNpmMetadata`.
+func readStaleNpmMetadata(reg *NpmRegistry, regUrl string, abbreviated bool, cause error) ([]byte, error) {
+	_, _, fetchedAt, data := readNpmMetadataCache(getNpmMetadataCachePath(regUrl, getNpmMetadataHeader(reg, abbreviated)))
+	return useStaleNpmMetadata(reg, fetchedAt, data, cause)
+}
+
+// useStaleNpmMetadata returns the cached metadata with a `staleError` as the fallback of the
+// unavailable registry, or the `cause` error if the metadata is older than the `npmQueryMaxStale`.
+func useStaleNpmMetadata(reg *NpmRegistry, fetchedAt time.Time, cached []byte, cause error) ([]byte, error) {
+	if cached == nil || time.Since(fetchedAt) > time.Duration(config.NpmQueryMaxStale)*time.Second {
+		return nil, cause
+	}
+	reportRegistryStaleFallback(reg.Registry)
+	return cached, &staleError{fetchedAt: fetchedAt, err: cause}
+}
+
+// getNpmMetadataCachePath returns the cache path of the metadata, the `Accept` and
+// `Authorization` headers are part of the cache key.
+func getNpmMetadataCachePath(regUrl string, header http.Header) string {
+	h := sha1.New()
+	h.Write([]byte(regUrl))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(header.Get("Accept")))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(header.Get("Authorization")))
+	sum := hex.EncodeToString(h.Sum(nil))
+	return path.Join(config.WorkDir, "metadata", sum[:2], sum[2:]+".json")
+}
+
+// readNpmMetadataCache reads the cached metadata, the format is:
+//
+//	fetch time (unix seconds)\n
+//	ETag\n
+//	Last-Modified\n
+//	data
+func readNpmMetadataCache(cachePath string) (etag string, lastModified string, fetchedAt time.Time, data []byte) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	// the cache files without the fetch time are ignored
+	unix, err := strconv.ParseInt(strings.TrimSuffix(line, "\n"), 10, 64)
+	if err != nil {
+		return
+	}
+	etag, err = r.ReadString('\n')
+	if err != nil {
+		return "", "", time.Time{}, nil
+	}
+	lastModified, err = r.ReadString('\n')
+	if err != nil {
+		return "", "", time.Time{}, nil
+	}
+	data, err = io.ReadAll(r)
+	if err != nil {
+		return "", "", time.Time{}, nil
+	}
+	return strings.TrimSuffix(etag, "\n"), strings.TrimSuffix(lastModified, "\n"), time.Unix(unix, 0), data
+}
+
+func writeNpmMetadataCache(cachePath string, etag string, lastModified string, data []byte) {
+	if ensureDir(path.Dir(cachePath)) != nil {
+		return
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(etag)+len(lastModified)+len(data)+24))
+	buf.WriteString(strconv.FormatInt(time.Now().Unix(), 10))
+	buf.WriteByte('\n')
+	buf.WriteString(etag)
+	buf.WriteByte('\n')
+	buf.WriteString(lastModified)
+	buf.WriteByte('\n')
+	buf.Write(data)
+	// write to a temporary file first to avoid partial reads
+	tmpPath := fmt.Sprintf("%s.%x.tmp", cachePath, time.Now().UnixNano())
+	if os.WriteFile(tmpPath, buf.Bytes(), 0644) == nil {
+		if os.Rename(tmpPath, cachePath) != nil {
+			os.Remove(tmpPath)
+		}
+	}
+}
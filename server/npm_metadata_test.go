@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestNpmMetadataCache(t *testing.T) {
+	dir := path.Join(os.TempDir(), "npm_metadata_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(dir)
+
+	cachePath := path.Join(dir, "ab", "cdef.json")
+	writeNpmMetadataCache(cachePath, `W/"123"`, "", []byte(`{"name":"react"}`))
+
+	etag, lastModified, fetchedAt, data := readNpmMetadataCache(cachePath)
+	if etag != `W/"123"` {
+		t.Fatalf("invalid etag(%s), shoud be 'W/\"123\"'", etag)
+	}
+	if lastModified != "" {
+		t.Fatalf("invalid last-modified(%s), shoud be empty", lastModified)
+	}
+	if string(data) != `{"name":"react"}` {
+		t.Fatalf("invalid data(%s), shoud be '{\"name\":\"react\"}'", string(data))
+	}
+	if time.Since(fetchedAt) > time.Minute {
+		t.Fatalf("invalid fetch time(%s)", fetchedAt)
+	}
+
+	_, _, _, data = readNpmMetadataCache(path.Join(dir, "not-found.json"))
+	if data != nil {
+		t.Fatal("data shoud be nil")
+	}
+
+	// the cache files without the fetch time are ignored
+	os.WriteFile(cachePath, []byte("W/\"123\"\n\n{}"), 0644)
+	_, _, _, data = readNpmMetadataCache(cachePath)
+	if data != nil {
+		t.Fatal("data shoud be nil")
+	}
+}
+
+func TestStaleNpmMetadata(t *testing.T) {
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		w.Write([]byte(`{"name":"foo"}`))
+	}))
+	defer server.Close()
+
+	workDir := config.WorkDir
+	maxStale := config.NpmQueryMaxStale
+	defer func() {
+		config.WorkDir = workDir
+		config.NpmQueryMaxStale = maxStale
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "npm_metadata_test_"+rand.Hex.String(8))
+	config.NpmQueryMaxStale = 3600
+	defer os.RemoveAll(config.WorkDir)
+
+	reg := &NpmRegistry{Registry: server.URL + "/"}
+	regUrl := server.URL + "/foo"
+	data, _, err := fetchNpmMetadata(reg, regUrl, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"foo"}` {
+		t.Fatalf("invalid metadata %s", data)
+	}
+
+	// the registry is down, the cached metadata is returned as stale
+	down.Store(true)
+	defer reportRegistrySuccess(reg.Registry)
+	data, _, err = fetchNpmMetadata(reg, regUrl, false)
+	if !isStaleError(err) {
+		t.Fatalf("shoud return a stale error, got %v", err)
+	}
+	if string(data) != `{"name":"foo"}` {
+		t.Fatalf("invalid metadata %s", data)
+	}
+	if h := getRegistryHealth()[reg.Registry]; h.StaleFallbacks != 1 {
+		t.Fatalf("invalid stale fallbacks(%d), shoud be 1", h.StaleFallbacks)
+	}
+
+	// the stale data is cached since the fetch time instead of now
+	_, _, fetchedAt, _ := readNpmMetadataCache(getNpmMetadataCachePath(regUrl, getNpmMetadataHeader(reg, false)))
+	v, err := withStaleCache("stale-metadata", time.Minute, time.Hour, func() (string, string, error) {
+		data, _, err := fetchNpmMetadata(reg, regUrl, false)
+		return string(data), "", err
+	})
+	if err != nil || v != `{"name":"foo"}` {
+		t.Fatalf("invalid data %s, %v", v, err)
+	}
+	if item, _ := cacheStore.Load("stale-metadata"); item.(*cacheItem).exp != fetchedAt.Add(time.Minute).UnixMilli() {
+		t.Fatal("stale data shoud be cached since the fetch time")
+	}
+
+	// refuse the cached metadata that is older than the `npmQueryMaxStale`
+	config.NpmQueryMaxStale = 0
+	_, _, err = fetchNpmMetadata(reg, regUrl, false)
+	if err == nil || isStaleError(err) {
+		t.Fatalf("shoud refuse the stale metadata, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the circuit of a registry is opened after the consecutive failures
+	registryCircuitThreshold = 3
+	// the max cooldown of an open circuit, it's doubled on every failure after the threshold
+	registryCircuitMaxCooldown = 5 * time.Minute
+)
+
+var errRegistryUnavailable = errors.New("registry is unavailable")
+
+// RegistryHealth is the health status of a registry.
+type RegistryHealth struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+	OpenUntil   time.Time `json:"openUntil,omitempty"`
+	// the count of the stale metadata that is served as the fallback
+	StaleFallbacks int `json:"staleFallbacks,omitempty"`
+}
+
+var (
+	registryHealthLock sync.Mutex
+	registryHealth     = map[string]*RegistryHealth{}
+)
+
+// isRegistryAvailable returns false if the circuit of the registry is open.
+func isRegistryAvailable(registry string) bool {
+	if registry == "" {
+		return true
+	}
+	registryHealthLock.Lock()
+	defer registryHealthLock.Unlock()
+	h, ok := registryHealth[registry]
+	return !ok || time.Now().After(h.OpenUntil)
+}
+
+func reportRegistryFailure(registry string) {
+	if registry == "" {
+		return
+	}
+	registryHealthLock.Lock()
+	defer registryHealthLock.Unlock()
+	h, ok := registryHealth[registry]
+	if !ok {
+		h = &RegistryHealth{}
+		registryHealth[registry] = h
+	}
+	h.Failures++
+	h.LastFailure = time.Now()
+	if h.Failures >= registryCircuitThreshold {
+		cooldown := registryCircuitMaxCooldown
+		if n := h.Failures - registryCircuitThreshold; n < 8 {
+			cooldown = min(time.Duration(1<<n)*time.Second*10, registryCircuitMaxCooldown)
+		}
+		h.OpenUntil = h.LastFailure.Add(cooldown)
+	}
+}
+
+// reportRegistryStaleFallback records that the stale metadata is served as the fallback of the registry.
+func reportRegistryStaleFallback(registry string) {
+	if registry == "" {
+		return
+	}
+	registryHealthLock.Lock()
+	defer registryHealthLock.Unlock()
+	h, ok := registryHealth[registry]
+	if !ok {
+		h = &RegistryHealth{}
+		registryHealth[registry] = h
+	}
+	h.StaleFallbacks++
+}
+
+func reportRegistrySuccess(registry string) {
+	if registry == "" {
+		return
+	}
+	registryHealthLock.Lock()
+	defer registryHealthLock.Unlock()
+	delete(registryHealth, registry)
+}
+
+// getRegistryHealth returns the health status of the registries that have failures.
+func getRegistryHealth() map[string]RegistryHealth {
+	registryHealthLock.Lock()
+	defer registryHealthLock.Unlock()
+	ret := make(map[string]RegistryHealth, len(registryHealth))
+	for registry, h := range registryHealth {
+		ret[registry] = *h
+	}
+	return ret
+}
+
+// candidates returns the registry and its fallbacks in order, the registries with open circuits
+// are moved to the end.
+func (reg *NpmRegistry) candidates() []*NpmRegistry {
+	if len(reg.Fallbacks) == 0 {
+		return []*NpmRegistry{reg}
+	}
+	available := make([]*NpmRegistry, 0, len(reg.Fallbacks)+1)
+	unavailable := []*NpmRegistry{}
+	for i := -1; i < len(reg.Fallbacks); i++ {
+		r := reg
+		if i >= 0 {
+			r = &reg.Fallbacks[i]
+		}
+		if isRegistryAvailable(r.Registry) {
+			available = append(available, r)
+		} else {
+			unavailable = append(unavailable, r)
+		}
+	}
+	return append(available, unavailable...)
+}
+
+// fetchNpmMetadataWithFailover fetches the metadata of the package from the registry and its
+// fallbacks in order. Only the unavailable registries (network errors, 5xx or 429 responses) fall
+// over to the next one, a 404 response doesn't, to avoid resolving private package names from
+// public registries. The registry that serves the metadata is returned.
+func fetchNpmMetadataWithFailover(reg *NpmRegistry, getRegUrl func(reg *NpmRegistry) (regUrl string, abbreviated bool)) (data []byte, notFound bool, from *NpmRegistry, err error) {
+	if len(reg.Fallbacks) == 0 {
+		regUrl, abbreviated := getRegUrl(reg)
+		data, notFound, err = fetchNpmMetadata(reg, regUrl, abbreviated)
+		return data, notFound, reg, err
+	}
+	var errs []string
+	for _, r := range reg.candidates() {
+		regUrl, abbreviated := getRegUrl(r)
+		data, notFound, err = fetchRegistryMetadata(r, regUrl, abbreviated, false)
+		if err == nil {
+			return data, notFound, r, nil
+		}
+		errs = append(errs, r.Registry+": "+err.Error())
+	}
+	// use the last known good metadata if all registries are down
+	err = errors.New(strings.Join(errs, "; "))
+	for _, r := range reg.candidates() {
+		regUrl, abbreviated := getRegUrl(r)
+		if data, staleErr := readStaleNpmMetadata(r, regUrl, abbreviated, err); data != nil {
+			return data, false, r, staleErr
+		}
+	}
+	return nil, false, reg, err
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestRegistryFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer down.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/foo":
+			w.Write([]byte(`{"name":"foo"}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer mirror.Close()
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer private.Close()
+
+	workDir := config.WorkDir
+	defer func() {
+		config.WorkDir = workDir
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "registry_failover_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(config.WorkDir)
+
+	getRegUrl := func(pkgName string) func(reg *NpmRegistry) (string, bool) {
+		return func(reg *NpmRegistry) (string, bool) {
+			return reg.Registry + pkgName, false
+		}
+	}
+
+	reg := &NpmRegistry{
+		Registry:  down.URL + "/",
+		Fallbacks: []NpmRegistry{{Registry: mirror.URL + "/"}},
+	}
+	for i := 0; i < registryCircuitThreshold; i++ {
+		data, notFound, from, err := fetchNpmMetadataWithFailover(reg, getRegUrl("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notFound || string(data) != `{"name":"foo"}` {
+			t.Fatalf("invalid metadata %s", data)
+		}
+		if from.Registry != mirror.URL+"/" {
+			t.Fatalf("invalid registry %s, shoud be %s", from.Registry, mirror.URL+"/")
+		}
+	}
+	if isRegistryAvailable(down.URL + "/") {
+		t.Fatal("circuit shoud be open")
+	}
+	if c := reg.candidates(); c[0].Registry != mirror.URL+"/" || c[1].Registry != down.URL+"/" {
+		t.Fatal("the registry with open circuit shoud be moved to the end")
+	}
+	reportRegistrySuccess(down.URL + "/")
+	if !isRegistryAvailable(down.URL + "/") {
+		t.Fatal("circuit shoud be closed")
+	}
+
+	// a 404 response doesn't fall over to the next registry
+	reg = &NpmRegistry{
+		Registry:  private.URL + "/",
+		Fallbacks: []NpmRegistry{{Registry: mirror.URL + "/"}},
+	}
+	_, notFound, from, err := fetchNpmMetadataWithFailover(reg, getRegUrl("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !notFound || from.Registry != private.URL+"/" {
+		t.Fatal("shoud be not found")
+	}
+}
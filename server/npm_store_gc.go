@@ -0,0 +1,214 @@
+package server
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ije/gox/log"
+)
+
+// NpmStoreGCResult is the result of a npm store GC run.
+type NpmStoreGCResult struct {
+	RemovedPackages int       `json:"removedPackages"`
+	RemovedLinks    int       `json:"removedLinks"`
+	RemovedMetadata int       `json:"removedMetadata"`
+	ReclaimedBytes  int64     `json:"reclaimedBytes"`
+	StartedAt       time.Time `json:"startedAt"`
+	Duration        string    `json:"duration"`
+}
+
+var (
+	npmStoreGCRunning atomic.Bool
+	npmStoreGCLast    atomic.Pointer[NpmStoreGCResult]
+)
+
+// getDiskStatus returns the disk status of the work directory: "ok", "low", "full" or "error".
+func getDiskStatus() string {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(config.WorkDir, &stat)
+	if err != nil {
+		return "error"
+	}
+	avail := stat.Bavail * uint64(stat.Bsize)
+	if avail < 100*MB {
+		return "full"
+	} else if avail < 1024*MB {
+		return "low"
+	}
+	return "ok"
+}
+
+// markStoreUsed updates the mtime of the install directory that is used by the GC to
+// determine the last usage time of the package.
+func markStoreUsed(installDir string) {
+	fi, err := os.Stat(installDir)
+	if err == nil && time.Since(fi.ModTime()) > time.Hour {
+		now := time.Now()
+		os.Chtimes(installDir, now, now)
+	}
+}
+
+// startNpmStoreGC checks the disk status periodically and runs the GC when the disk is low.
+func startNpmStoreGC(logger *log.Logger) {
+	for {
+		if status := getDiskStatus(); status == "low" || status == "full" {
+			triggerNpmStoreGC(logger)
+		}
+		time.Sleep(10 * time.Minute)
+	}
+}
+
+// triggerNpmStoreGC runs the GC in background, it's a no-op if a GC is running.
+func triggerNpmStoreGC(logger *log.Logger) {
+	if !npmStoreGCRunning.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer npmStoreGCRunning.Store(false)
+		result, err := gcNpmStores(time.Duration(config.NpmStoreRetention) * 24 * time.Hour)
+		if err != nil {
+			logger.Errorf("npm store gc: %v", err)
+			return
+		}
+		npmStoreGCLast.Store(result)
+		logger.Infof("npm store gc: removed %d packages, %d links, %d metadata, reclaimed %d MB in %s", result.RemovedPackages, result.RemovedLinks, result.RemovedMetadata, result.ReclaimedBytes/MB, result.Duration)
+	}()
+}
+
+// gcNpmStores runs the GC for all npm stores in the work directory, including the zone stores,
+// and the persisted registry metadata.
+func gcNpmStores(retention time.Duration) (*NpmStoreGCResult, error) {
+	entries, err := os.ReadDir(config.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	result := &NpmStoreGCResult{StartedAt: time.Now()}
+	for _, entry := range entries {
+		if entry.IsDir() && (entry.Name() == "npm" || strings.HasPrefix(entry.Name(), "npm-")) {
+			err = gcNpmStore(path.Join(config.WorkDir, entry.Name()), retention, result)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	gcNpmMetadataCache(path.Join(config.WorkDir, "metadata"), retention, result)
+	result.Duration = time.Since(result.StartedAt).String()
+	return result, nil
+}
+
+// gcNpmMetadataCache removes the persisted registry metadata that is not revalidated within the
+// retention window, see `getNpmMetadataCachePath`.
+func gcNpmMetadataCache(cacheDir string, retention time.Duration, result *NpmStoreGCResult) {
+	expires := time.Now().Add(-retention)
+	filepath.WalkDir(cacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil && fi.ModTime().Before(expires) {
+			if os.Remove(p) == nil {
+				result.RemovedMetadata++
+				result.ReclaimedBytes += fi.Size()
+			}
+		}
+		return nil
+	})
+}
+
+// gcNpmStore removes the package installs in the store directory that are not used within the
+// retention window, and the dangling `node_modules` links of the remaining installs.
+func gcNpmStore(storeDir string, retention time.Duration, result *NpmStoreGCResult) error {
+	installs, err := listStoreInstalls(storeDir, "")
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(-retention)
+	retained := make([]string, 0, len(installs))
+	for _, name := range installs {
+		installDir := path.Join(storeDir, name)
+		fi, err := os.Stat(installDir)
+		if err != nil || fi.ModTime().After(expires) {
+			retained = append(retained, name)
+			continue
+		}
+		// wait for the in-progress installation of the package
+		unlock := installMutex.Lock(name)
+		fi, err = os.Stat(installDir)
+		if err == nil && !fi.ModTime().After(expires) {
+			size := dirSize(installDir)
+			if os.RemoveAll(installDir) == nil {
+				result.RemovedPackages++
+				result.ReclaimedBytes += size
+			}
+		}
+		unlock()
+	}
+	for _, name := range retained {
+		nodeModulesDir := path.Join(storeDir, name, "node_modules")
+		filepath.WalkDir(nodeModulesDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			// only check the top-level packages and scoped packages
+			if d.IsDir() && p != nodeModulesDir && !strings.HasPrefix(d.Name(), "@") {
+				return filepath.SkipDir
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				if _, err := os.Stat(p); os.IsNotExist(err) && os.Remove(p) == nil {
+					result.RemovedLinks++
+				}
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// listStoreInstalls returns the package installs in the store directory, e.g. "react@18.3.1",
+// "@babel/core@7.26.0", "gh/owner/repo@v1.0.0", "git/gitlab.com/owner/repo@v1.0.0", "pr/name@commit".
+func listStoreInstalls(storeDir string, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(path.Join(storeDir, prefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var installs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		fullname := path.Join(prefix, name)
+		// install dirs are named as "<name>@<version>", others are scope or repo owner dirs
+		if strings.LastIndexByte(name, '@') > 0 {
+			installs = append(installs, fullname)
+		} else if strings.Count(fullname, "/") < 3 {
+			sub, err := listStoreInstalls(storeDir, fullname)
+			if err != nil {
+				return nil, err
+			}
+			installs = append(installs, sub...)
+		}
+	}
+	return installs, nil
+}
+
+// dirSize returns the total size of the files in the directory, symlinks are not followed.
+func dirSize(dir string) (size int64) {
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestNpmStoreGC(t *testing.T) {
+	storeDir := path.Join(os.TempDir(), "npm_store_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(storeDir)
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for _, name := range []string{"react@18.3.1", "@babel/core@7.26.0", "gh/ije/esm@v1.0.0", "preact@10.0.0"} {
+		dir := path.Join(storeDir, name, "node_modules", "pkg")
+		ensureDir(dir)
+		os.WriteFile(path.Join(dir, "package.json"), []byte("{}"), 0644)
+		if name != "preact@10.0.0" {
+			os.Chtimes(path.Join(storeDir, name), old, old)
+		}
+	}
+	ensureDir(path.Join(storeDir, "preact@10.0.0", "node_modules", "@babel"))
+	os.Symlink(path.Join(storeDir, "react@18.3.1", "node_modules", "pkg"), path.Join(storeDir, "preact@10.0.0", "node_modules", "react"))
+	os.Symlink(path.Join(storeDir, "@babel/core@7.26.0", "node_modules", "pkg"), path.Join(storeDir, "preact@10.0.0", "node_modules", "@babel", "core"))
+
+	installs, err := listStoreInstalls(storeDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installs) != 4 {
+		t.Fatalf("invalid installs %v, shoud have 4 installs", installs)
+	}
+
+	result := &NpmStoreGCResult{}
+	err = gcNpmStore(storeDir, 7*24*time.Hour, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RemovedPackages != 3 {
+		t.Fatalf("invalid removed packages(%d), shoud be 3", result.RemovedPackages)
+	}
+	if result.RemovedLinks != 2 {
+		t.Fatalf("invalid removed links(%d), shoud be 2", result.RemovedLinks)
+	}
+	if result.ReclaimedBytes != 6 {
+		t.Fatalf("invalid reclaimed bytes(%d), shoud be 6", result.ReclaimedBytes)
+	}
+	if !existsFile(path.Join(storeDir, "preact@10.0.0", "node_modules", "pkg", "package.json")) {
+		t.Fatal("preact@10.0.0 shoud be retained")
+	}
+}
+
+func TestNpmMetadataCacheGC(t *testing.T) {
+	cacheDir := path.Join(os.TempDir(), "npm_metadata_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(cacheDir)
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for _, name := range []string{"aa/old.json", "bb/fresh.json"} {
+		filename := path.Join(cacheDir, name)
+		ensureDir(path.Dir(filename))
+		os.WriteFile(filename, []byte("\n\n{}"), 0644)
+		if name == "aa/old.json" {
+			os.Chtimes(filename, old, old)
+		}
+	}
+
+	result := &NpmStoreGCResult{}
+	gcNpmMetadataCache(cacheDir, 7*24*time.Hour, result)
+	if result.RemovedMetadata != 1 {
+		t.Fatalf("invalid removed metadata(%d), shoud be 1", result.RemovedMetadata)
+	}
+	if result.ReclaimedBytes != 4 {
+		t.Fatalf("invalid reclaimed bytes(%d), shoud be 4", result.ReclaimedBytes)
+	}
+	if existsFile(path.Join(cacheDir, "aa/old.json")) {
+		t.Fatal("aa/old.json shoud be removed")
+	}
+	if !existsFile(path.Join(cacheDir, "bb/fresh.json")) {
+		t.Fatal("bb/fresh.json shoud be retained")
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/esm-dev/esm.sh/server/storage"
+)
+
+var (
+	// the storage to share npm tarballs across nodes, enabled by the `npmTarballCache` config
+	npmTarballStorage storage.Storage
+)
+
+// getTarballCacheKey returns the storage key of a package tarball, the key is
+// based on the registry, name, version and integrity of the package.
+// An empty string is returned if the tarball is not cacheable.
+func getTarballCacheKey(zoneId string, reg *NpmRegistry, pkgName string, pkgVersion string, integrity string) string {
+	if integrity == "" || !isExactVersion(pkgVersion) {
+		return ""
+	}
+	registry := "default"
+	if reg.Registry != "" {
+		if u, err := url.Parse(reg.Registry); err == nil && u.Host != "" {
+			registry = u.Host + strings.TrimSuffix(u.Path, "/")
+		}
+	}
+	h := sha1.New()
+	h.Write([]byte(integrity))
+	return normalizeSavePath(zoneId, "npm/"+registry+"/"+pkgName+"/"+pkgVersion+"-"+hex.EncodeToString(h.Sum(nil))[:16]+".tgz")
+}
+
+// loadCachedTarball extracts the package tarball from the tarball storage.
+func loadCachedTarball(cacheKey string, installDir string, pkgName string, integrity string) (ok bool) {
+	if npmTarballStorage == nil || cacheKey == "" {
+		return false
+	}
+	r, _, err := npmTarballStorage.Get(cacheKey)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	verifier := newIntegrityVerifier(integrity)
+	err = extractPackageTarball(installDir, pkgName, io.TeeReader(io.LimitReader(r, maxPackageTarballSize), verifier))
+	if err == nil {
+		// drain the reader to verify the whole tarball
+		_, err = io.Copy(verifier, r)
+	}
+	if err == nil && verifier.Verify() {
+		return true
+	}
+	// remove the broken tarball from the storage
+	os.RemoveAll(installDir)
+	npmTarballStorage.Delete(cacheKey)
+	return false
+}
+
+// saveCachedTarball saves the downloaded tarball file to the tarball storage and removes the file.
+func saveCachedTarball(cacheKey string, tarballFile string) {
+	defer os.Remove(tarballFile)
+	if npmTarballStorage == nil || cacheKey == "" {
+		return
+	}
+	f, err := os.Open(tarballFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	npmTarballStorage.Put(cacheKey, f)
+}
+
+// integrityVerifier verifies the data by the subresource integrity string of the npm package,
+// e.g. "sha512-[base64]"
+type integrityVerifier struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+func newIntegrityVerifier(integrity string) *integrityVerifier {
+	v := &integrityVerifier{}
+	// pick the strongest algorithm if multiple hashes are provided
+	for _, s := range strings.Fields(integrity) {
+		algo, digest, ok := strings.Cut(s, "-")
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			continue
+		}
+		switch algo {
+		case "sha512":
+			v.hash, v.expected = sha512.New(), sum
+		case "sha384":
+			if v.hash == nil || v.hash.Size() < sha512.Size384 {
+				v.hash, v.expected = sha512.New384(), sum
+			}
+		case "sha256":
+			if v.hash == nil || v.hash.Size() < sha256.Size {
+				v.hash, v.expected = sha256.New(), sum
+			}
+		case "sha1":
+			if v.hash == nil {
+				v.hash, v.expected = sha1.New(), sum
+			}
+		}
+	}
+	return v
+}
+
+func (v *integrityVerifier) Write(p []byte) (int, error) {
+	if v.hash != nil {
+		v.hash.Write(p)
+	}
+	return len(p), nil
+}
+
+// Verify returns true if the written data matches the integrity, the data without integrity is always valid.
+func (v *integrityVerifier) Verify() bool {
+	return v.hash == nil || bytes.Equal(v.hash.Sum(nil), v.expected)
+}
+
+// toIntegrity returns the integrity of the package dist, falls back to the `shasum` field.
+func (dist *NpmPackageDist) toIntegrity() string {
+	if dist.Integrity != "" {
+		return dist.Integrity
+	}
+	if dist.Shasum != "" {
+		sum, err := hex.DecodeString(dist.Shasum)
+		if err == nil {
+			return "sha1-" + base64.StdEncoding.EncodeToString(sum)
+		}
+	}
+	return ""
+}
+
+var errIntegrityMismatch = errors.New("integrity checksum failed")
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"testing"
+)
+
+func TestIntegrityVerifier(t *testing.T) {
+	data := []byte("Hello, World!")
+	sum := sha512.Sum512(data)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	v := newIntegrityVerifier(integrity)
+	v.Write(data)
+	if !v.Verify() {
+		t.Fatal("integrity shoud be verified")
+	}
+
+	v = newIntegrityVerifier(integrity)
+	v.Write([]byte("Hello, esm.sh!"))
+	if v.Verify() {
+		t.Fatal("integrity shoud not be verified")
+	}
+
+	dist := &NpmPackageDist{Shasum: "0a0a9f2a6772942557ab5355d76af442f8f65e01"}
+	if dist.toIntegrity() != "sha1-CgqfKmdylCVXq1NV12r0Qvj2XgE=" {
+		t.Fatalf("invalid integrity(%s)", dist.toIntegrity())
+	}
+
+	if getTarballCacheKey("", &NpmRegistry{Registry: "https://registry.npmjs.org/"}, "react", "^18.0.0", integrity) != "" {
+		t.Fatal("tarball of non-exact version shoud not be cached")
+	}
+	key := getTarballCacheKey("", &NpmRegistry{Registry: "https://registry.npmjs.org/"}, "react", "18.3.1", integrity)
+	if key[:33] != "npm/registry.npmjs.org/react/18.3" {
+		t.Fatalf("invalid cache key(%s)", key)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestOptionalDependencies(t *testing.T) {
+	var p PackageJSON
+	err := json.Unmarshal([]byte(`{
+		"name": "foo",
+		"version": "1.0.0",
+		"dependencies": { "bar": "^1.0.0" },
+		"optionalDependencies": { "@foo/linux-x64": "1.0.0" },
+		"os": ["linux", "!win32"],
+		"cpu": "x64"
+	}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Dependencies["@foo/linux-x64"] != "1.0.0" || p.OptionalDependencies["@foo/linux-x64"] != "1.0.0" {
+		t.Fatal("optional dependencies should be merged into dependencies")
+	}
+	if !p.IsPlatformSpecific() {
+		t.Fatal("shoud be platform specific")
+	}
+	if !matchNpmPlatform(p.Os, "linux") || matchNpmPlatform(p.Os, "win32") || matchNpmPlatform(p.Os, "darwin") {
+		t.Fatal("invalid os match")
+	}
+	if !matchNpmPlatform([]string{"!win32"}, "darwin") || matchNpmPlatform([]string{"!win32"}, "win32") {
+		t.Fatal("invalid blocked os match")
+	}
+	if !matchNpmPlatform(p.Cpu, toNpmCPU("amd64")) || matchNpmPlatform(p.Cpu, toNpmCPU("arm64")) {
+		t.Fatal("invalid cpu match")
+	}
+}
+
+func TestMemoizedOptionalDeps(t *testing.T) {
+	pkgDir := path.Join(os.TempDir(), "optional_deps_test_"+rand.Hex.String(8), "node_modules", "foo")
+	defer os.RemoveAll(path.Dir(path.Dir(pkgDir)))
+	ensureDir(pkgDir)
+	os.WriteFile(path.Join(pkgDir, "package.json"), []byte(`{"name":"foo","version":"1.0.0","optionalDependencies":{"@foo/linux-x64":"1.0.0"}}`), 0644)
+
+	ctx := &BuildContext{esm: EsmPath{PkgName: "app"}, pkgJson: &PackageJSON{Name: "app"}}
+	if v := ctx.getOptionalDeps(pkgDir)["@foo/linux-x64"]; v != "1.0.0" {
+		t.Fatalf("invalid optional dependency version(%s), shoud be 1.0.0", v)
+	}
+	// the package.json is parsed only once
+	os.Remove(path.Join(pkgDir, "package.json"))
+	if v := ctx.getOptionalDeps(pkgDir)["@foo/linux-x64"]; v != "1.0.0" {
+		t.Fatalf("invalid optional dependency version(%s), shoud be 1.0.0", v)
+	}
+	if ctx.isNativeOptionalDep(path.Join(pkgDir, "index.js"), "bar") {
+		t.Fatal("bar shoud not be a native optional dependency")
+	}
+}
+
+func TestResolveGithubDependency(t *testing.T) {
+	for v, want := range map[string]string{
+		"github:facebook/react#semver:^19.0.0":                 "%5E19.0.0",
+		"github:facebook/react#v19.0.0":                        "v19.0.0",
+		"facebook/react#semver:~19.0.0":                        "~19.0.0",
+		"git+https://github.com/facebook/react.git#semver:^19": "%5E19",
+		"github:facebook/react":                                "",
+	} {
+		pkg, err := resolveDependencyVersion(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pkg.Github || pkg.Name != "facebook/react" {
+			t.Fatalf("invalid package %v", pkg)
+		}
+		// the `semver:` prefix is removed before escaping the range
+		if pkg.Version != want {
+			t.Fatalf("invalid version(%s) of '%s', shoud be '%s'", pkg.Version, v, want)
+		}
+	}
+}
+
+// testNpmRegistry is a npm registry that serves the packuments and the tarballs of the test packages.
+type testNpmRegistry struct {
+	*httptest.Server
+	tarballs   map[string][]byte
+	packuments map[string]map[string]any
+}
+
+func newTestNpmRegistry(t *testing.T) *testNpmRegistry {
+	r := &testNpmRegistry{
+		tarballs:   map[string][]byte{},
+		packuments: map[string]map[string]any{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if data, ok := r.tarballs[req.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		if packument, ok := r.packuments[strings.TrimPrefix(req.URL.Path, "/")]; ok {
+			json.NewEncoder(w).Encode(packument)
+			return
+		}
+		w.WriteHeader(404)
+	}))
+	return r
+}
+
+// addPackage adds a package version to the registry, the `index.js` of the package exports "<name>@<version>".
+func (r *testNpmRegistry) addPackage(t *testing.T, name string, version string, license string, deps map[string]string) {
+	depsJson, _ := json.Marshal(deps)
+	tarball := createTestTarball(t, map[string]string{
+		"package.json": `{"name":"` + name + `","version":"` + version + `","license":"` + license + `","main":"index.js","dependencies":` + string(depsJson) + `}`,
+		"index.js":     "module.exports = '" + name + "@" + version + "';\n",
+	})
+	sum := sha512.Sum512(tarball)
+	tarballPath := "/" + name + "/-/" + name + "-" + version + ".tgz"
+	r.tarballs[tarballPath] = tarball
+	if r.packuments[name] == nil {
+		r.packuments[name] = map[string]any{
+			"name":      name,
+			"dist-tags": map[string]string{},
+			"versions":  map[string]any{},
+		}
+	}
+	r.packuments[name]["dist-tags"].(map[string]string)["latest"] = version
+	r.packuments[name]["versions"].(map[string]any)[version] = map[string]any{
+		"name":         name,
+		"version":      version,
+		"license":      license,
+		"dependencies": deps,
+		"dist": map[string]string{
+			"tarball":   r.URL + tarballPath,
+			"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+		},
+	}
+}
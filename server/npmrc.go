@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ije/gox/utils"
+)
+
+var regexpNpmrcEnvVar = regexp.MustCompile(`(\\*)\$\{([^${}?]+)(\?)?\}`)
+
+// NewNpmRcFromFile loads the npmrc from a `.npmrc` file.
+func NewNpmRcFromFile(filename string) (npmrc *NpmRC, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	return NewNpmRcFromIni(data)
+}
+
+// NewNpmRcFromIni parses the `.npmrc` file format, supported keys are:
+//
+//	registry=https://registry.npmjs.org/
+//	@scope:registry=https://npm.example.com/
+//	//npm.example.com/:_authToken=${NPM_TOKEN}
+//	//npm.example.com/:_auth=base64(user:password)
+//	//npm.example.com/:username=user
+//	//npm.example.com/:_password=base64(password)
+//
+// see https://docs.npmjs.com/cli/v10/configuring-npm/npmrc
+func NewNpmRcFromIni(data []byte) (npmrc *NpmRC, err error) {
+	rc := &NpmRC{
+		ScopedRegistries: map[string]NpmRegistry{},
+	}
+	// auth settings keyed by the nerf-darted registry url, e.g. "//registry.npmjs.org/"
+	auths := map[string]*NpmRegistry{}
+	getAuth := func(key string) *NpmRegistry {
+		a, ok := auths[key]
+		if !ok {
+			a = &NpmRegistry{}
+			auths[key] = a
+		}
+		return a
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value, err = expandNpmrcEnv(unquoteNpmrcValue(strings.TrimSpace(value)))
+		if err != nil {
+			return nil, fmt.Errorf("npmrc line %d: %w", lineNum, err)
+		}
+
+		var authKey string
+		if strings.HasPrefix(key, "//") {
+			authKey, key = utils.SplitByLastByte(key, ':')
+		}
+		switch key {
+		case "registry":
+			rc.Registry = value
+		case "_authToken":
+			getAuth(authKey).Token = value
+		case "_auth":
+			auth, e := base64.StdEncoding.DecodeString(value)
+			if e != nil {
+				return nil, fmt.Errorf("npmrc line %d: invalid _auth", lineNum)
+			}
+			user, password := utils.SplitByFirstByte(string(auth), ':')
+			a := getAuth(authKey)
+			a.User = user
+			a.Password = password
+		case "username":
+			getAuth(authKey).User = value
+		case "_password":
+			password, e := base64.StdEncoding.DecodeString(value)
+			if e != nil {
+				return nil, fmt.Errorf("npmrc line %d: invalid _password", lineNum)
+			}
+			getAuth(authKey).Password = string(password)
+		default:
+			if scope, ok := strings.CutSuffix(key, ":registry"); ok && strings.HasPrefix(scope, "@") {
+				rc.ScopedRegistries[scope] = NpmRegistry{Registry: value}
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if rc.Registry != "" {
+		rc.Registry = strings.TrimRight(rc.Registry, "/") + "/"
+	}
+	// the top-level auth settings (without the `//host/` prefix) apply to the default registry
+	if a, ok := auths[""]; ok {
+		rc.Token, rc.User, rc.Password = a.Token, a.User, a.Password
+	}
+	applyNpmrcAuth(&rc.NpmRegistry, auths)
+	for scope, reg := range rc.ScopedRegistries {
+		reg.Registry = strings.TrimRight(reg.Registry, "/") + "/"
+		applyNpmrcAuth(&reg, auths)
+		rc.ScopedRegistries[scope] = reg
+	}
+	return rc, nil
+}
+
+// applyNpmrcAuth applies the auth settings of the longest matched `//host/path/` key to the registry.
+func applyNpmrcAuth(reg *NpmRegistry, auths map[string]*NpmRegistry) {
+	registry := reg.Registry
+	if registry == "" {
+		registry = npmRegistry
+	}
+	u, err := url.Parse(registry)
+	if err != nil {
+		return
+	}
+	nerfDart := "//" + u.Host + strings.TrimRight(u.Path, "/") + "/"
+	var matched *NpmRegistry
+	matchedLen := 0
+	for key, a := range auths {
+		if key != "" && strings.HasPrefix(nerfDart, strings.TrimRight(key, "/")+"/") && len(key) > matchedLen {
+			matched = a
+			matchedLen = len(key)
+		}
+	}
+	if matched != nil {
+		if matched.Token != "" {
+			reg.Token = matched.Token
+		}
+		if matched.User != "" {
+			reg.User = matched.User
+			reg.Password = matched.Password
+		}
+	}
+}
+
+// expandNpmrcEnv replaces `${VAR}` with the environment variable, `${VAR?}` is replaced with
+// an empty string if the variable is not set, and `\${VAR}` is kept as is.
+func expandNpmrcEnv(value string) (string, error) {
+	var err error
+	value = regexpNpmrcEnvVar.ReplaceAllStringFunc(value, func(s string) string {
+		m := regexpNpmrcEnvVar.FindStringSubmatch(s)
+		escapes, name, optional := m[1], m[2], m[3] == "?"
+		if len(escapes)%2 == 1 {
+			return escapes[:len(escapes)-1] + s[len(escapes):]
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok && !optional {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return escapes[:len(escapes)/2] + v
+	})
+	return value, err
+}
+
+func unquoteNpmrcValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'') {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNpmRcFromIni(t *testing.T) {
+	os.Setenv("TEST_NPM_TOKEN", "token-123")
+	defer os.Unsetenv("TEST_NPM_TOKEN")
+
+	rc, err := NewNpmRcFromIni([]byte(`
+; comment
+# comment
+registry=https://npm.example.com
+@scope:registry="https://npm.scope.com/npm/"
+@jsr:registry=https://npm.jsr.io/
+//npm.example.com/:_authToken=${TEST_NPM_TOKEN}
+//npm.scope.com/npm/:_auth=dXNlcjpwYXNz
+//npm.scope.com/:_authToken=should-not-be-used-as-user
+always-auth=true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Registry != "https://npm.example.com/" {
+		t.Fatalf("invalid registry(%s), shoud be 'https://npm.example.com/'", rc.Registry)
+	}
+	if rc.Token != "token-123" {
+		t.Fatalf("invalid token(%s), shoud be 'token-123'", rc.Token)
+	}
+	scope, ok := rc.ScopedRegistries["@scope"]
+	if !ok {
+		t.Fatal("missing registry of '@scope'")
+	}
+	if scope.Registry != "https://npm.scope.com/npm/" {
+		t.Fatalf("invalid registry(%s), shoud be 'https://npm.scope.com/npm/'", scope.Registry)
+	}
+	if scope.User != "user" || scope.Password != "pass" {
+		t.Fatalf("invalid user(%s:%s), shoud be 'user:pass'", scope.User, scope.Password)
+	}
+	if jsr := rc.ScopedRegistries["@jsr"]; jsr.Token != "" || jsr.User != "" {
+		t.Fatal("registry of '@jsr' shoud not have auth")
+	}
+
+	_, err = NewNpmRcFromIni([]byte(`//npm.example.com/:_authToken=${TEST_NPM_TOKEN_NOT_SET}`))
+	if err == nil {
+		t.Fatal("shoud fail with unset environment variable")
+	}
+	rc, err = NewNpmRcFromIni([]byte(`//registry.npmjs.org/:_authToken=${TEST_NPM_TOKEN_NOT_SET?}` + "\n" + `_authToken=\${TEST_NPM_TOKEN}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Token != "${TEST_NPM_TOKEN}" {
+		t.Fatalf("invalid token(%s), shoud be '${TEST_NPM_TOKEN}'", rc.Token)
+	}
+}
@@ -14,6 +14,7 @@ import (
 type EsmPath struct {
 	GhPrefix      bool
 	PrPrefix      bool
+	GitHost       string // the git host of the repository, empty for github.com
 	PkgName       string
 	PkgVersion    string
 	SubPath       string
@@ -23,6 +24,7 @@ type EsmPath struct {
 func (p EsmPath) Package() Package {
 	return Package{
 		Github:   p.GhPrefix,
+		GitHost:  p.GitHost,
 		PkgPrNew: p.PrPrefix,
 		Name:     p.PkgName,
 		Version:  p.PkgVersion,
@@ -35,6 +37,9 @@ func (p EsmPath) Name() string {
 		name += "@" + p.PkgVersion
 	}
 	if p.GhPrefix {
+		if p.GitHost != "" {
+			return "git/" + p.GitHost + "/" + name
+		}
 		return "gh/" + name
 	}
 	if p.PrPrefix {
@@ -81,7 +86,19 @@ func praseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 	}
 
 	var ghPrefix bool
-	if strings.HasPrefix(pathname, "/gh/") {
+	var gitHost string
+	if strings.HasPrefix(pathname, "/git/") {
+		// e.g. "/git/gitlab.example.com/owner/repo@tag"
+		hostname, rest := utils.SplitByFirstByte(pathname[5:], '/')
+		if _, ok := getGitHost(hostname); !ok || hostname == "github.com" || !strings.ContainsRune(rest, '/') {
+			err = errors.New("invalid path")
+			return
+		}
+		// add a leading `@` to the package name
+		pathname = "/@" + rest
+		ghPrefix = true
+		gitHost = hostname
+	} else if strings.HasPrefix(pathname, "/gh/") {
 		if !strings.ContainsRune(pathname[4:], '/') {
 			err = errors.New("invalid path")
 			return
@@ -97,6 +114,9 @@ func praseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 		// add a leading `@` to the package name
 		pathname = "/@" + pathname[12:]
 		ghPrefix = true
+	} else if strings.HasPrefix(pathname, "/denoland/x/") {
+		// e.g. "/denoland/x/oak@v12.6.1/mod.ts"
+		pathname = "/@deno.land/" + pathname[12:]
 	} else if strings.HasPrefix(pathname, "/jsr/") {
 		segs := strings.Split(pathname[5:], "/")
 		if len(segs) < 2 || !strings.HasPrefix(segs[0], "@") {
@@ -141,6 +161,7 @@ func praseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 		SubPath:       subPath,
 		SubModuleName: stripEntryModuleExt(subPath),
 		GhPrefix:      ghPrefix,
+		GitHost:       gitHost,
 	}
 
 	// workaround for es5-ext "../#/.." path
@@ -154,7 +175,8 @@ func praseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 			return
 		}
 		var refs []GitRef
-		refs, err = listRepoRefs(fmt.Sprintf("https://github.com/%s", esm.PkgName))
+		gitHost, _ := getGitHost(esm.GitHost)
+		refs, err = listRepoRefs(gitHost.RemoteUrl(esm.GitHost, esm.PkgName), gitHost.GitEnv())
 		if err != nil {
 			return
 		}
@@ -202,6 +224,17 @@ func praseEsmPath(npmrc *NpmRC, pathname string) (esm EsmPath, extraQuery string
 		return
 	}
 
+	// deno.land/x modules use the tag as the version, e.g. "v12.6.1"
+	if _, ok := splitDenoXPackageName(pkgName); ok {
+		var p *PackageJSON
+		p, err = npmrc.getPackageInfo(pkgName, esm.PkgVersion)
+		if err == nil {
+			withExactVersion = esm.PkgVersion == p.Version
+			esm.PkgVersion = p.Version
+		}
+		return
+	}
+
 	withExactVersion = len(esm.PkgVersion) > 0 && isExactVersion(esm.PkgVersion)
 	if !withExactVersion {
 		var p *PackageJSON
@@ -242,11 +275,9 @@ func validateTargetSegment(segments []string) bool {
 		return false
 	}
 	if strings.HasPrefix(segments[0], "X-") && len(segments) > 2 {
-		_, ok := targets[segments[1]]
-		return ok
+		return isBuildTarget(segments[1])
 	}
-	_, ok := targets[segments[0]]
-	return ok
+	return isBuildTarget(segments[0])
 }
 
 func toPackageName(specifier string) string {
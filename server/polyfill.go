@@ -0,0 +1,246 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+// polyfill is a module that implements a runtime API that is missing in old browsers, the syntax
+// is lowered by esbuild but the runtime APIs are not, e.g. `Array.prototype.at`.
+type polyfill struct {
+	// the global APIs, e.g. "structuredClone" and "Object.hasOwn"
+	globals []string
+	// the property names of the prototype methods, e.g. "at"
+	props []string
+	// the ES version that the API is introduced in
+	es int
+	// the first engine versions that support the API
+	engines map[string][]int
+	code    string
+}
+
+// polyfills is the curated set of the polyfills that are served at `/polyfill/<name>.mjs`.
+// Note: the polyfills are written in ES5 since they are served to the old browsers as they are, and they
+// use `self` instead of `globalThis` since they are only injected for browsers.
+var polyfills = map[string]polyfill{
+	"global-this": {
+		globals: []string{"globalThis"},
+		es:      2020,
+		engines: polyfillEngines(71, 65, 12, 1),
+		code:    `if(typeof globalThis==="undefined")self.globalThis=self;`,
+	},
+	"array-flat": {
+		props:   []string{"flat", "flatMap"},
+		es:      2019,
+		engines: polyfillEngines(69, 62, 12),
+		code: `d(Array.prototype,"flat",function flat(depth){var r=[];(function f(a,n){for(var i=0;i<a.length;i++){if(!(i in a))continue;if(Array.isArray(a[i])&&n>0)f(a[i],n-1);else r.push(a[i])}})(this,depth===undefined?1:Number(depth));return r});
+d(Array.prototype,"flatMap",function flatMap(fn,thisArg){return Array.prototype.map.call(this,fn,thisArg).flat()});`,
+	},
+	"object-from-entries": {
+		globals: []string{"Object.fromEntries"},
+		es:      2019,
+		engines: polyfillEngines(73, 63, 12, 1),
+		code:    `d(Object,"fromEntries",function fromEntries(entries){var o={};Array.from(entries,function(e){o[e[0]]=e[1]});return o});`,
+	},
+	"promise-all-settled": {
+		globals: []string{"Promise.allSettled"},
+		es:      2020,
+		engines: polyfillEngines(76, 71, 13),
+		code:    `d(Promise,"allSettled",function allSettled(it){return Promise.all(Array.from(it,function(p){return Promise.resolve(p).then(function(value){return{status:"fulfilled",value:value}},function(reason){return{status:"rejected",reason:reason}})}))});`,
+	},
+	"string-match-all": {
+		props:   []string{"matchAll"},
+		es:      2020,
+		engines: polyfillEngines(73, 67, 13),
+		code:    `d(String.prototype,"matchAll",function matchAll(re){if(!(re instanceof RegExp))re=new RegExp(re,"g");else if(!re.global)throw new TypeError("matchAll must be called with a global RegExp");var r=new RegExp(re.source,re.flags),s=String(this),done=false,it={next:function(){var m=done?null:r.exec(s);if(m===null){done=true;return{value:undefined,done:true}}if(m[0]==="")r.lastIndex++;return{value:m,done:false}}};r.lastIndex=re.lastIndex;it[Symbol.iterator]=function(){return this};return it});`,
+	},
+	"string-replace-all": {
+		props:   []string{"replaceAll"},
+		es:      2021,
+		engines: polyfillEngines(85, 77, 13, 1),
+		code:    `d(String.prototype,"replaceAll",function replaceAll(search,replacement){if(search instanceof RegExp){if(!search.global)throw new TypeError("replaceAll must be called with a global RegExp");return this.replace(search,replacement)}return this.replace(new RegExp(String(search).replace(/[.*+?^${}()|[\]\\]/g,"\\$&"),"g"),replacement)});`,
+	},
+	"promise-any": {
+		globals: []string{"Promise.any", "AggregateError"},
+		es:      2021,
+		engines: polyfillEngines(85, 79, 14),
+		code: `if(typeof AggregateError==="undefined"){self.AggregateError=function AggregateError(errors,message){var e=new Error(message);Object.setPrototypeOf(e,AggregateError.prototype);e.name="AggregateError";e.errors=Array.from(errors);return e};self.AggregateError.prototype=Object.create(Error.prototype,{constructor:{value:self.AggregateError,writable:true,configurable:true}})}
+d(Promise,"any",function any(it){return new Promise(function(resolve,reject){var ps=Array.from(it),errors=[],n=ps.length;if(n===0)reject(new AggregateError([],"All promises were rejected"));ps.forEach(function(p,i){Promise.resolve(p).then(resolve,function(e){errors[i]=e;if(--n===0)reject(new AggregateError(errors,"All promises were rejected"))})})})});`,
+	},
+	"array-at": {
+		props:   []string{"at"},
+		es:      2022,
+		engines: polyfillEngines(92, 90, 15, 4),
+		code: `function at(n){n=Math.trunc(n)||0;if(n<0)n+=this.length;return n<0||n>=this.length?undefined:this[n]}
+[Array.prototype,String.prototype,Object.getPrototypeOf(Int8Array.prototype)].forEach(function(p){d(p,"at",at)});`,
+	},
+	"object-has-own": {
+		globals: []string{"Object.hasOwn"},
+		es:      2022,
+		engines: polyfillEngines(93, 92, 15, 4),
+		code:    `d(Object,"hasOwn",function hasOwn(o,k){if(o==null)throw new TypeError("Cannot convert undefined or null to object");return Object.prototype.hasOwnProperty.call(Object(o),k)});`,
+	},
+	// `structuredClone` is a web API, es2022 is the closest ES version that is supported by the browsers
+	"structured-clone": {
+		globals: []string{"structuredClone"},
+		es:      2022,
+		engines: polyfillEngines(98, 94, 15, 4),
+		code: `d(self,"structuredClone",function structuredClone(value){var seen=new Map();function clone(v){if(typeof v==="function"||typeof v==="symbol")throw new DOMException("could not be cloned","DataCloneError");if(typeof v!=="object"||v===null)return v;if(seen.has(v))return seen.get(v);var r;
+if(v instanceof Date)r=new Date(v.getTime());else if(v instanceof RegExp)r=new RegExp(v.source,v.flags);else if(v instanceof ArrayBuffer)r=v.slice(0);
+else if(ArrayBuffer.isView(v))r=new v.constructor(clone(v.buffer),v.byteOffset,v instanceof DataView?v.byteLength:v.length);else if(v instanceof Error){r=new v.constructor(v.message);r.stack=v.stack}
+else if(v instanceof Map){r=new Map();seen.set(v,r);v.forEach(function(x,k){r.set(clone(k),clone(x))})}else if(v instanceof Set){r=new Set();seen.set(v,r);v.forEach(function(x){r.add(clone(x))})}
+else{r=Array.isArray(v)?new Array(v.length):{};seen.set(v,r);Object.keys(v).forEach(function(k){r[k]=clone(v[k])})}seen.set(v,r);return r}return clone(value)});`,
+	},
+	"array-find-last": {
+		props:   []string{"findLast", "findLastIndex"},
+		es:      2023,
+		engines: polyfillEngines(97, 104, 15, 4),
+		code: `function findLast(fn,thisArg){for(var i=this.length-1;i>=0;i--){if(fn.call(thisArg,this[i],i,this))return this[i]}}
+function findLastIndex(fn,thisArg){for(var i=this.length-1;i>=0;i--){if(fn.call(thisArg,this[i],i,this))return i}return -1}
+[Array.prototype,Object.getPrototypeOf(Int8Array.prototype)].forEach(function(p){d(p,"findLast",findLast);d(p,"findLastIndex",findLastIndex)});`,
+	},
+	"array-change-by-copy": {
+		props:   []string{"toReversed", "toSorted", "toSpliced", "with"},
+		es:      2023,
+		engines: polyfillEngines(110, 115, 16),
+		code: `var A=Array.prototype;
+d(A,"toReversed",function toReversed(){return Array.from(this).reverse()});
+d(A,"toSorted",function toSorted(fn){return Array.from(this).sort(fn)});
+d(A,"toSpliced",function toSpliced(){var a=Array.from(this);A.splice.apply(a,arguments);return a});
+d(A,"with",function(i,v){var a=Array.from(this);i=Math.trunc(i)||0;if(i<0)i+=a.length;if(i<0||i>=a.length)throw new RangeError("Invalid index : "+i);a[i]=v;return a});`,
+	},
+	"promise-with-resolvers": {
+		globals: []string{"Promise.withResolvers"},
+		es:      2024,
+		engines: polyfillEngines(119, 121, 17, 4),
+		code:    `d(Promise,"withResolvers",function withResolvers(){var r={};r.promise=new this(function(resolve,reject){r.resolve=resolve;r.reject=reject});return r});`,
+	},
+	"group-by": {
+		globals: []string{"Object.groupBy", "Map.groupBy"},
+		es:      2024,
+		engines: polyfillEngines(117, 119, 17, 4),
+		code: `d(Object,"groupBy",function groupBy(items,fn){var o=Object.create(null);Array.from(items).forEach(function(v,i){var k=fn(v,i);(o[k]||(o[k]=[])).push(v)});return o});
+d(Map,"groupBy",function groupBy(items,fn){var m=new Map();Array.from(items).forEach(function(v,i){var k=fn(v,i),g=m.get(k);if(!g)m.set(k,g=[]);g.push(v)});return m});`,
+	},
+	"set-methods": {
+		props:   []string{"union", "intersection", "difference", "symmetricDifference", "isSubsetOf", "isSupersetOf", "isDisjointFrom"},
+		es:      2025,
+		engines: polyfillEngines(122, 127, 17),
+		code: `var S=Set.prototype;function keys(o){var r=[],n,i=o.keys();while(!(n=i.next()).done)r.push(n.value);return r}
+d(S,"union",function union(o){var r=new Set(this);keys(o).forEach(function(v){r.add(v)});return r});
+d(S,"intersection",function intersection(o){var r=new Set();this.forEach(function(v){if(o.has(v))r.add(v)});return r});
+d(S,"difference",function difference(o){var r=new Set(this);this.forEach(function(v){if(o.has(v))r.delete(v)});return r});
+d(S,"symmetricDifference",function symmetricDifference(o){var t=this,r=new Set(this);keys(o).forEach(function(v){if(t.has(v))r.delete(v);else r.add(v)});return r});
+d(S,"isSubsetOf",function isSubsetOf(o){var ok=true;this.forEach(function(v){if(!o.has(v))ok=false});return ok});
+d(S,"isSupersetOf",function isSupersetOf(o){var t=this;return keys(o).every(function(v){return t.has(v)})});
+d(S,"isDisjointFrom",function isDisjointFrom(o){var ok=true;this.forEach(function(v){if(o.has(v))ok=false});return ok});`,
+	},
+}
+
+// polyfillHelper defines the non-enumerable property if it doesn't exist.
+const polyfillHelper = `var d=function(o,k,v){if(!(k in o))Object.defineProperty(o,k,{value:v,writable:true,configurable:true})};` + "\n"
+
+// polyfillEngines returns the first engine versions that support the API by the chrome, firefox and
+// safari versions, edge uses the same version as chrome, opera is 14 versions behind chrome.
+func polyfillEngines(chrome int, firefox int, safari ...int) map[string][]int {
+	return map[string][]int{
+		"chrome":  {chrome},
+		"edge":    {chrome},
+		"opera":   {max(chrome-14, 1)},
+		"firefox": {firefox},
+		"safari":  safari,
+		"ios":     safari,
+	}
+}
+
+// getPolyfillModule returns the code of the polyfill module.
+func getPolyfillModule(name string) ([]byte, bool) {
+	p, ok := polyfills[name]
+	if !ok {
+		return nil, false
+	}
+	return []byte(polyfillHelper + p.code + "\n"), true
+}
+
+// getPolyfills returns the names of the polyfills that are used by the code but missing in the
+// build target, the names are sorted. The usages are found in the AST by esbuild instead of matching
+// the code, the global APIs are replaced with markers by the `define` option, and the accessed
+// properties are collected by the `mangleProps` option.
+func getPolyfills(target string, code []byte) ([]string, error) {
+	var missing []string
+	var props []string
+	define := map[string]string{}
+	for name, p := range polyfills {
+		if !p.isSupportedBy(target) {
+			missing = append(missing, name)
+			for _, g := range p.globals {
+				define[g] = polyfillMarker(name)
+			}
+			props = append(props, p.props...)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	options := esbuild.TransformOptions{
+		Target:      esbuild.ESNext,
+		Format:      esbuild.FormatESModule,
+		Define:      define,
+		MangleCache: map[string]any{},
+	}
+	if len(props) > 0 {
+		options.MangleProps = "^(?:" + strings.Join(props, "|") + ")$"
+	}
+	ret := esbuild.Transform(string(code), options)
+	if len(ret.Errors) > 0 {
+		return nil, errors.New(ret.Errors[0].Text)
+	}
+	var names []string
+	for _, name := range missing {
+		p := polyfills[name]
+		used := len(p.globals) > 0 && strings.Contains(string(ret.Code), polyfillMarker(name))
+		for _, prop := range p.props {
+			if _, ok := ret.MangleCache[prop]; ok {
+				used = true
+			}
+		}
+		if used {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// polyfillMarker returns the identifier that replaces the global APIs of the polyfill.
+func polyfillMarker(name string) string {
+	return "__polyfill$" + strings.ReplaceAll(name, "-", "_")
+}
+
+// isSupportedBy checks if the API is supported natively by the build target.
+func (p *polyfill) isSupportedBy(target string) bool {
+	if year, ok := strings.CutPrefix(target, "es"); ok {
+		if target == "esnext" {
+			return true
+		}
+		if y, err := strconv.Atoi(year); err == nil {
+			return y >= p.es
+		}
+	}
+	versions, ok := parseEngineTargetList(target)
+	if !ok {
+		// deno, denonext and node
+		return true
+	}
+	for name, version := range versions {
+		v, ok := p.engines[name]
+		if !ok || slices.Compare(version, v) < 0 {
+			return false
+		}
+	}
+	return true
+}
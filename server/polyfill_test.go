@@ -0,0 +1,52 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+func TestPolyfillModules(t *testing.T) {
+	for name := range polyfills {
+		code, ok := getPolyfillModule(name)
+		if !ok {
+			t.Fatalf("polyfill '%s' shoud be found", name)
+		}
+		ret := esbuild.Transform(string(code), esbuild.TransformOptions{
+			Target: esbuild.ES5,
+			Format: esbuild.FormatESModule,
+		})
+		if len(ret.Errors) > 0 {
+			t.Fatalf("invalid polyfill '%s': %s", name, ret.Errors[0].Text)
+		}
+	}
+	if _, ok := getPolyfillModule("foo"); ok {
+		t.Fatal("polyfill 'foo' shoud not be found")
+	}
+}
+
+func TestGetPolyfills(t *testing.T) {
+	code := []byte(`const a=[1,2,3].at(-1),b=Object.hasOwn(o,"a"),{promise:p}=Promise.withResolvers();
+// structuredClone(a)
+const c="x.with(1)",d=/\.flat\(/,e=(Object=>Object.fromEntries([]))(Map);`)
+	for target, expected := range map[string][]string{
+		"es2020":             {"array-at", "object-has-own", "promise-with-resolvers"},
+		"es2022":             {"promise-with-resolvers"},
+		"es2024":             nil,
+		"esnext":             nil,
+		"denonext":           nil,
+		"node":               nil,
+		"chrome110":          {"promise-with-resolvers"},
+		"chrome120_safari15": {"array-at", "object-has-own", "promise-with-resolvers"},
+		"firefox130":         nil,
+	} {
+		names, err := getPolyfills(target, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(names, expected) {
+			t.Fatalf("invalid polyfills %v of target '%s', shoud be %v", names, target, expected)
+		}
+	}
+}
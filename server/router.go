@@ -15,7 +15,6 @@ import (
 	"path"
 	"sort"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/esm-dev/esm.sh/server/common"
@@ -41,6 +40,10 @@ const (
 	EsmSourceMap
 	// *.d.ts
 	EsmDts
+	// legal comments of the build (*.LEGAL.txt)
+	EsmLegalComments
+	// licenses of the builds (LICENSES.json)
+	EsmLicenses
 	// package raw file
 	RawFile
 )
@@ -54,6 +57,7 @@ const (
 	ctJSON           = "application/json; charset=utf-8"
 	ctJavaScript     = "application/javascript; charset=utf-8"
 	ctTypeScript     = "application/typescript; charset=utf-8"
+	ctText           = "text/plain; charset=utf-8"
 )
 
 func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) rex.Handle {
@@ -61,11 +65,36 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 		startTime  = time.Now()
 		globalETag = fmt.Sprintf(`W/"%s"`, VERSION)
 		buildQueue = NewBuildQueue(int(config.BuildConcurrency))
+		warmer     = &buildWarmer{queue: buildQueue, db: db, storage: buildStorage, logger: logger}
 	)
 
+	// warm up the builds at startup
+	if config.WarmupFile != "" {
+		go warmer.WarmupFile(config.WarmupFile)
+	}
+
 	return func(ctx *rex.Context) any {
 		pathname := ctx.R.URL.Path
 
+		// select the server-side zone by the hostname or the path prefix
+		zone := matchZone(ctx.R)
+		if zone != nil && zone.PathPrefix != "" {
+			ctx.R.Header.Set("X-Real-Origin", getOrigin(ctx)+zone.PathPrefix)
+			pathname = strings.TrimPrefix(pathname, zone.PathPrefix)
+			if pathname == "" {
+				pathname = "/"
+			}
+			ctx.R.URL.Path = pathname
+		}
+
+		// the zone id of the request, the ids of server-side zones can't be used by the `X-Zone-Id` header
+		zoneIdHeader := ctx.R.Header.Get("X-Zone-Id")
+		if zone != nil {
+			zoneIdHeader = zone.Id
+		} else if zoneIdHeader != "" && (!valid.IsDomain(zoneIdHeader) || isConfiguredZoneId(zoneIdHeader)) {
+			zoneIdHeader = ""
+		}
+
 		// ban malicious requests
 		if strings.HasPrefix(pathname, "/.") || strings.HasSuffix(pathname, ".env") || strings.HasSuffix(pathname, ".php") {
 			return rex.Status(404, "not found")
@@ -88,7 +117,9 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				if len(options.Code) > MB {
 					return rex.Err(429, "Code is too large")
 				}
-				if targets[options.Target] == 0 {
+				if target, err := normalizeBuildTarget(options.Target); err == nil {
+					options.Target = target
+				} else {
 					options.Target = "esnext"
 				}
 				if options.Lang == "" && options.Filename != "" {
@@ -106,7 +137,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				hash := hex.EncodeToString(h.Sum(nil))
 
 				// if previous build exists, return it directly
-				savePath := normalizeSavePath(ctx.R.Header.Get("X-Zone-Id"), fmt.Sprintf("modules/transform/%s.mjs", hash))
+				savePath := normalizeSavePath(zoneIdHeader, fmt.Sprintf("modules/transform/%s.mjs", hash))
 				if file, _, err := buildStorage.Get(savePath); err == nil {
 					data, err := io.ReadAll(file)
 					file.Close()
@@ -152,6 +183,9 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 
 			case "/purge":
 				zoneId := ctx.FormValue("zoneId")
+				if zone != nil {
+					zoneId = zone.Id
+				}
 				packageName := ctx.FormValue("package")
 				version := ctx.FormValue("version")
 				if packageName == "" {
@@ -178,6 +212,30 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				logger.Infof("Purged %d files for %s@%s (ip: %s)", len(deleteKeys), packageName, version, ctx.RemoteIP())
 				return map[string]any{"deleted": deleteKeys}
 
+			case "/_warmup":
+				var options WarmupOptions
+				err := json.NewDecoder(io.LimitReader(ctx.R.Body, MB)).Decode(&options)
+				ctx.R.Body.Close()
+				if err != nil {
+					return rex.Err(400, "require valid json body")
+				}
+				if len(options.Specifiers) == 0 {
+					return rex.Err(400, "specifiers is required")
+				}
+				if len(options.Specifiers) > maxWarmupSpecifiers {
+					return rex.Err(400, fmt.Sprintf("too many specifiers, max is %d", maxWarmupSpecifiers))
+				}
+				npmrc := DefaultNpmRC()
+				if zone != nil {
+					npmrc = zone.NpmRC()
+				}
+				n, err := warmer.Warmup(npmrc, zone, options)
+				if err != nil {
+					return rex.Err(400, err.Error())
+				}
+				logger.Infof("Warmup %d builds (ip: %s)", n, ctx.RemoteIP())
+				return map[string]any{"queued": n}
+
 			default:
 				return rex.Status(404, "not found")
 			}
@@ -296,23 +354,17 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 						"path":        t.ctx.Path(),
 						"status":      t.ctx.status,
 					}
+					if t.lowPriority {
+						m["lowPriority"] = true
+					}
 					q[i] = m
 					i++
 				}
 			}
 
-			disk := "ok"
-			var stat syscall.Statfs_t
-			err := syscall.Statfs(config.WorkDir, &stat)
-			if err == nil {
-				avail := stat.Bavail * uint64(stat.Bsize)
-				if avail < 100*MB {
-					disk = "full"
-				} else if avail < 1024*MB {
-					disk = "low"
-				}
-			} else {
-				disk = "error"
+			disk := getDiskStatus()
+			if disk == "low" || disk == "full" {
+				triggerNpmStoreGC(logger)
 			}
 
 			ctx.SetHeader("Cache-Control", ccMustRevalidate)
@@ -321,6 +373,9 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				"version":    VERSION,
 				"uptime":     time.Since(startTime).String(),
 				"disk":       disk,
+				"npmStoreGC": npmStoreGCLast.Load(),
+				"registries": getRegistryHealth(),
+				"warmup":     warmer.Status(),
 			}
 
 		case "/error.js":
@@ -385,8 +440,8 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 
 			// determine build target by `?target` query or `User-Agent` header
-			target := strings.ToLower(ctx.Query().Get("target"))
-			targetFromUA := targets[target] == 0
+			target, err := normalizeBuildTarget(ctx.Query().Get("target"))
+			targetFromUA := err != nil
 			if targetFromUA {
 				target = getBuildTargetByUA(ctx.UserAgent())
 			}
@@ -406,7 +461,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				}
 				// replace `$TARGET` with the target
 				data = bytes.ReplaceAll(data, []byte("$TARGET"), []byte(target))
-				js, err = minify(string(data), esbuild.LoaderTS, targets[target])
+				js, err = minify(string(data), esbuild.LoaderTS, target)
 				return
 			})
 			if err != nil {
@@ -431,7 +486,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			if len(hash) != 40 || !valid.IsHexString(hash) {
 				return rex.Status(404, "Not Found")
 			}
-			savePath := normalizeSavePath(ctx.R.Header.Get("X-Zone-Id"), fmt.Sprintf("modules/transform/%s.%s", hash, ext))
+			savePath := normalizeSavePath(zoneIdHeader, fmt.Sprintf("modules/transform/%s.%s", hash, ext))
 			f, fi, err := buildStorage.Get(savePath)
 			if err != nil {
 				return rex.Status(500, err.Error())
@@ -473,6 +528,20 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			return code
 		}
 
+		// polyfills
+		if strings.HasPrefix(pathname, "/polyfill/") && strings.HasSuffix(pathname, ".mjs") {
+			if code, ok := getPolyfillModule(strings.TrimSuffix(pathname[10:], ".mjs")); ok {
+				ifNoneMatch := ctx.R.Header.Get("If-None-Match")
+				if ifNoneMatch == globalETag && !DEBUG {
+					return rex.Status(http.StatusNotModified, nil)
+				}
+				ctx.SetHeader("Cache-Control", ccOneDay)
+				ctx.SetHeader("Etag", globalETag)
+				ctx.SetHeader("Content-Type", ctJavaScript)
+				return code
+			}
+		}
+
 		// embed assets
 		if strings.HasPrefix(pathname, "/embed/") {
 			data, err := embedFS.ReadFile(pathname[1:])
@@ -497,7 +566,9 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 		}
 
 		var npmrc *NpmRC
-		if v := ctx.R.Header.Get("X-Npmrc"); v != "" {
+		if zone != nil {
+			npmrc = zone.NpmRC()
+		} else if v := ctx.R.Header.Get("X-Npmrc"); v != "" {
 			rc, err := NewNpmRcFromJSON([]byte(v))
 			if err != nil {
 				return rex.Status(400, "Invalid Npmrc Header")
@@ -507,27 +578,102 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			npmrc = DefaultNpmRC()
 		}
 
-		zoneIdHeader := ctx.R.Header.Get("X-Zone-Id")
-		if zoneIdHeader != "" {
-			if !valid.IsDomain(zoneIdHeader) {
+		if zone == nil && zoneIdHeader != "" {
+			var scopeName string
+			if pkgName := toPackageName(pathname[1:]); strings.HasPrefix(pkgName, "@") {
+				scopeName = pkgName[:strings.Index(pkgName, "/")]
+			}
+			if scopeName != "" {
+				reg, ok := npmrc.ScopedRegistries[scopeName]
+				if !ok || (reg.Registry == jsrRegistry && reg.Token == "" && (reg.User == "" || reg.Password == "")) {
+					zoneIdHeader = ""
+				}
+			} else if npmrc.Registry == npmRegistry && npmrc.Token == "" && (npmrc.User == "" || npmrc.Password == "") {
 				zoneIdHeader = ""
-			} else {
-				var scopeName string
-				if pkgName := toPackageName(pathname[1:]); strings.HasPrefix(pkgName, "@") {
-					scopeName = pkgName[:strings.Index(pkgName, "/")]
+			}
+			if zoneIdHeader != "" {
+				// copy the npmrc to avoid changing the shared default npmrc
+				rc := *npmrc
+				rc.zoneId = zoneIdHeader
+				npmrc = &rc
+			}
+		}
+
+		// bundle analysis report of the build
+		// e.g. /_analyze/react-dom@19.0.0/es2022/react-dom.mjs?exports=createRoot
+		if buildPath, ok := strings.CutPrefix(pathname, "/_analyze/"); ok {
+			build, err := newBuildContextFromPath(npmrc, logger, db, buildStorage, "/"+buildPath)
+			if err != nil || build.target == "types" {
+				return rex.Status(400, "Invalid build path")
+			}
+			meta, ok, err := build.Exists()
+			if err != nil {
+				return rex.Status(500, err.Error())
+			}
+			if !ok {
+				return rex.Status(404, "Build not found")
+			}
+			f, _, err := buildStorage.Get(build.getAnalysisSavepath())
+			if err != nil {
+				if err == storage.ErrNotFound {
+					return rex.Status(404, "Bundle analysis not found")
 				}
-				if scopeName != "" {
-					reg, ok := npmrc.ScopedRegistries[scopeName]
-					if !ok || (reg.Registry == jsrRegistry && reg.Token == "" && (reg.User == "" || reg.Password == "")) {
-						zoneIdHeader = ""
+				return rex.Status(500, err.Error())
+			}
+			var analysis BuildAnalysis
+			err = json.NewDecoder(f).Decode(&analysis)
+			f.Close()
+			if err != nil {
+				return rex.Status(500, "Invalid bundle analysis")
+			}
+			// the tree-shaking result of the `?exports` query
+			if v := ctx.Query().Get("exports"); v != "" && !meta.CJS && build.args.format == "" {
+				jsIdentSet := set.New[string]()
+				for _, p := range strings.Split(v, ",") {
+					p = strings.TrimSpace(p)
+					if isJsIdentifier(p) {
+						jsIdentSet.Add(p)
 					}
-				} else if npmrc.Registry == npmRegistry && npmrc.Token == "" && (npmrc.User == "" || npmrc.Password == "") {
-					zoneIdHeader = ""
+				}
+				exports := jsIdentSet.Values()
+				sort.Strings(exports)
+				if len(exports) > 0 {
+					f, _, err := buildStorage.Get(build.getSavepath())
+					if err != nil {
+						return rex.Status(500, err.Error())
+					}
+					code, err := io.ReadAll(f)
+					f.Close()
+					if err != nil {
+						return rex.Status(500, err.Error())
+					}
+					code, err = treeShake(code, exports, build.target)
+					if err != nil {
+						return rex.Status(500, err.Error())
+					}
+					analysis.Exports = &BuildAnalysisExports{Names: exports, Size: len(code)}
 				}
 			}
+			ctx.SetHeader("Cache-Control", ccImmutable)
+			return analysis
 		}
-		if zoneIdHeader != "" {
-			npmrc.zoneId = zoneIdHeader
+
+		// license inventory of the built packages
+		// e.g. /_licenses?package=react-dom
+		if pathname == "/_licenses" {
+			pkgName := ctx.Query().Get("package")
+			if pkgName == "" {
+				return rex.Status(400, "param `package` is required")
+			}
+			if !validatePackageName(pkgName) {
+				return rex.Status(400, "Invalid package name")
+			}
+			inventory, err := getLicenseInventory(npmrc, db, pkgName)
+			if err != nil {
+				return rex.Status(500, err.Error())
+			}
+			ctx.SetHeader("Cache-Control", ccMustRevalidate)
+			return inventory
 		}
 
 		if strings.HasPrefix(pathname, "/http://") || strings.HasPrefix(pathname, "/https://") {
@@ -551,8 +697,8 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			if !(stringInSlice(moduleExts, extname) || extname == ".vue" || extname == ".svelte" || extname == ".md" || extname == ".css") {
 				return redirect(ctx, modUrl.String(), true)
 			}
-			target := strings.ToLower(query.Get("target"))
-			if targets[target] == 0 {
+			target, err := normalizeBuildTarget(query.Get("target"))
+			if err != nil {
 				target = "es2022"
 			}
 			v := query.Get("v")
@@ -689,6 +835,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				if err != nil {
 					return rex.Status(500, "Failed to generate uno.css: "+err.Error())
 				}
+				esTarget, engines := getEsbuildTarget(target)
 				ret := esbuild.Build(esbuild.BuildOptions{
 					Stdin: &esbuild.StdinOptions{
 						Sourcefile: "uno.css",
@@ -698,7 +845,8 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 					Write:            false,
 					MinifyWhitespace: config.Minify,
 					MinifySyntax:     config.Minify,
-					Target:           targets[target],
+					Target:           esTarget,
+					Engines:          engines,
 				})
 				if len(ret.Errors) > 0 {
 					return rex.Status(500, ret.Errors[0].Text)
@@ -832,6 +980,14 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 		}
 
+		// explain the entry resolution of the module instead of building it
+		// e.g. /_explain/react-dom@19.0.0/client?target=es2022&conditions=react-server
+		explain := false
+		if specifier, ok := strings.CutPrefix(pathname, "/_explain/"); ok {
+			explain = true
+			pathname = "/" + specifier
+		}
+
 		// check `/*pathname` pattern
 		asteriskPrefix := false
 		if strings.HasPrefix(pathname, "/*") {
@@ -863,23 +1019,44 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			return rex.Status(status, message)
 		}
 
-		pkgAllowed := config.AllowList.IsPackageAllowed(esm.PkgName)
-		pkgBanned := config.BanList.IsPackageBanned(esm.PkgName)
-		if !pkgAllowed || pkgBanned {
-			return rex.Status(403, "forbidden")
+		if zone != nil {
+			if !zone.IsPackageAllowed(esm.PkgName) {
+				return rex.Status(403, "forbidden")
+			}
+		} else {
+			pkgAllowed := config.AllowList.IsPackageAllowed(esm.PkgName)
+			pkgBanned := config.BanList.IsPackageBanned(esm.PkgName)
+			if !pkgAllowed || pkgBanned {
+				return rex.Status(403, "forbidden")
+			}
+		}
+
+		// check the security advisories of the package
+		pkgAdvisories := map[string][]Advisory{}
+		if !esm.GhPrefix && !esm.PrPrefix {
+			if list := getPackageAdvisories(esm.PkgName, esm.PkgVersion); len(list) > 0 {
+				pkgAdvisories[esm.PkgName+"@"+esm.PkgVersion] = list
+			}
+		}
+		if err := checkAdvisories(ctx.W.Header(), pkgAdvisories); err != nil {
+			return rex.Status(403, err.Error())
 		}
 
 		origin := getOrigin(ctx)
 
 		registryPrefix := ""
 		if esm.GhPrefix {
-			registryPrefix = "/gh"
+			if esm.GitHost != "" {
+				registryPrefix = "/git/" + esm.GitHost
+			} else {
+				registryPrefix = "/gh"
+			}
 		} else if esm.PrPrefix {
 			registryPrefix = "/pr"
 		}
 
 		// redirect `/@types/PKG` to it's main dts file
-		if strings.HasPrefix(esm.PkgName, "@types/") && esm.SubPath == "" {
+		if strings.HasPrefix(esm.PkgName, "@types/") && esm.SubPath == "" && !explain {
 			info, err := npmrc.getPackageInfo(esm.PkgName, esm.PkgVersion)
 			if err != nil {
 				return rex.Status(500, err.Error())
@@ -901,7 +1078,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 		}
 
 		// redirect to the main css path for CSS packages
-		if css := cssPackages[esm.PkgName]; css != "" && esm.SubModuleName == "" {
+		if css := cssPackages[esm.PkgName]; css != "" && esm.SubModuleName == "" && !explain {
 			url := fmt.Sprintf("%s/%s/%s", origin, esm.Name(), css)
 			return redirect(ctx, url, isExactVersion)
 		}
@@ -967,6 +1144,18 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				} else {
 					pathKind = RawFile
 				}
+			case ".txt":
+				if hasTargetSegment && strings.HasSuffix(esm.SubPath, ".LEGAL.txt") {
+					pathKind = EsmLegalComments
+				} else {
+					pathKind = RawFile
+				}
+			case ".json":
+				if hasTargetSegment && path.Base(esm.SubPath) == "LICENSES.json" {
+					pathKind = EsmLicenses
+				} else {
+					pathKind = RawFile
+				}
 			default:
 				if ext != "" && assetExts[ext[1:]] {
 					pathKind = RawFile
@@ -979,6 +1168,10 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			pathKind = RawFile
 		}
 
+		if explain && (pathKind != EsmEntry || hasTargetSegment) {
+			return rex.Status(400, "Only module specifiers can be explained")
+		}
+
 		// redirect to the url with exact package version
 		if !isExactVersion {
 			if hasTargetSegment {
@@ -1011,6 +1204,8 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				query := ""
 				if strings.HasPrefix(pkgName, "@jsr/") {
 					pkgName = "jsr/@" + strings.ReplaceAll(pkgName[5:], "__", "/")
+				} else if module, ok := splitDenoXPackageName(pkgName); ok {
+					pkgName = "denoland/x/" + module
 				}
 				if asteriskPrefix {
 					if esm.GhPrefix || esm.PrPrefix {
@@ -1090,6 +1285,23 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				return redirect(ctx, url, true)
 			}
 
+			// licenses of the builds in the build directory
+			if pathKind == EsmLicenses {
+				buildDir := strings.TrimSuffix(pathname, "/LICENSES.json")
+				if !isBuildTarget(path.Base(buildDir)) {
+					return rex.Status(400, "Invalid build target")
+				}
+				if asteriskPrefix {
+					buildDir = "/*" + buildDir[1:]
+				}
+				licenses, err := listBuildLicenses(npmrc, logger, db, buildStorage, buildDir)
+				if err != nil {
+					return rex.Status(500, err.Error())
+				}
+				ctx.SetHeader("Cache-Control", ccMustRevalidate)
+				return licenses
+			}
+
 			// package raw files
 			if pathKind == RawFile {
 				if esm.SubPath == "" {
@@ -1204,7 +1416,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 
 			// build/dts files
-			if pathKind == EsmBuild || pathKind == EsmSourceMap || pathKind == EsmDts {
+			if pathKind == EsmBuild || pathKind == EsmSourceMap || pathKind == EsmLegalComments || pathKind == EsmDts {
 				var savePath string
 				if asteriskPrefix {
 					pathname = "/*" + pathname[1:]
@@ -1215,11 +1427,31 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 					savePath = path.Join("modules", pathname)
 				}
 				savePath = normalizeSavePath(npmrc.zoneId, savePath)
+				// check the licenses and the advisories of the bundled packages with the build meta
+				if pathKind == EsmBuild && strings.HasSuffix(pathname, ".mjs") && (!config.LicensePolicy.IsEmpty() || advisories.Load() != nil) {
+					if b, err := newBuildContextFromPath(npmrc, logger, db, buildStorage, pathname); err == nil {
+						if meta, ok, _ := b.Exists(); ok {
+							if err := checkBuildLicenses(meta.Licenses); err != nil {
+								return rex.Status(http.StatusUnavailableForLegalReasons, err.Error())
+							}
+							for pkg, list := range getBuildAdvisories(meta.Packages) {
+								pkgAdvisories[pkg] = list
+							}
+							if err := checkAdvisories(ctx.W.Header(), pkgAdvisories); err != nil {
+								return rex.Status(403, err.Error())
+							}
+							reportInstalledAdvisories(ctx.W.Header(), pkgAdvisories, meta.Installed)
+							if len(pkgAdvisories) > 0 {
+								ctx.SetHeader("Access-Control-Expose-Headers", "X-ESM-Advisories")
+							}
+						}
+					}
+				}
 				f, stat, err := buildStorage.Get(savePath)
 				if err != nil {
 					if err != storage.ErrNotFound {
 						return rex.Status(500, err.Error())
-					} else if pathKind == EsmSourceMap {
+					} else if pathKind == EsmSourceMap || pathKind == EsmLegalComments {
 						return rex.Status(404, "Not found")
 					}
 				}
@@ -1230,6 +1462,8 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 						ctx.SetHeader("Content-Type", ctTypeScript)
 					} else if pathKind == EsmSourceMap {
 						ctx.SetHeader("Content-Type", ctJSON)
+					} else if pathKind == EsmLegalComments {
+						ctx.SetHeader("Content-Type", ctText)
 					} else if strings.HasSuffix(pathname, ".css") {
 						ctx.SetHeader("Content-Type", ctCSS)
 					} else {
@@ -1277,12 +1511,12 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 							target := "es2022"
 							// check target in the pathname
 							for _, seg := range strings.Split(pathname, "/") {
-								if targets[seg] > 0 {
+								if isBuildTarget(seg) {
 									target = seg
 									break
 								}
 							}
-							ret, err := treeShake(code, exports, targets[target])
+							ret, err := treeShake(code, exports, target)
 							if err != nil {
 								return rex.Status(500, err.Error())
 							}
@@ -1305,20 +1539,22 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 		}
 
 		// determine build target by `?target` query or `User-Agent` header
-		target := strings.ToLower(query.Get("target"))
-		targetFromUA := targets[target] == 0
+		target, err := normalizeBuildTarget(query.Get("target"))
+		targetFromUA := err != nil
 		if targetFromUA {
 			target = getBuildTargetByUA(ctx.UserAgent())
 		}
 
 		// redirect to the url with exact package version for `deno` and `denonext` target
-		if !isExactVersion && (target == "denonext" || target == "deno") {
+		if !isExactVersion && !explain && (target == "denonext" || target == "deno") {
 			pkgName := esm.PkgName
 			pkgVersion := esm.PkgVersion
 			subPath := ""
 			qs := ""
 			if strings.HasPrefix(pkgName, "@jsr/") {
 				pkgName = "jsr/@" + strings.ReplaceAll(pkgName[5:], "__", "/")
+			} else if module, ok := splitDenoXPackageName(pkgName); ok {
+				pkgName = "denoland/x/" + module
 			}
 			if asteriskPrefix {
 				if esm.GhPrefix || esm.PrPrefix {
@@ -1379,6 +1615,23 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 		}
 
+		// check `?overrides` query, e.g. `?overrides=bar:2.0.0,foo>baz@^1.0.0:1.2.0`
+		overrides := map[string]string{}
+		if query.Has("overrides") {
+			for _, p := range strings.Split(query.Get("overrides"), ",") {
+				p = strings.TrimSpace(p)
+				if p != "" {
+					selector, version := utils.SplitByFirstByte(p, ':')
+					selector = strings.ReplaceAll(strings.TrimSpace(selector), " ", "")
+					version = strings.TrimSpace(version)
+					if !validateOverride(selector, version) {
+						return rex.Status(400, fmt.Sprintf("Invalid overrides query: %v", p))
+					}
+					overrides[selector] = version
+				}
+			}
+		}
+
 		// check `?conditions` query
 		var conditions []string
 		conditionsSet := set.New[string]()
@@ -1413,6 +1666,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			alias:      alias,
 			conditions: conditions,
 			deps:       deps,
+			overrides:  overrides,
 		}
 		if !externalAll && external.Len() > 0 {
 			buildArgs.external = *external.ReadOnly()
@@ -1434,7 +1688,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 		}
 
-		// resolve `alias`, `deps`, `external` of the build args
+		// resolve `alias`, `deps`, `overrides`, `external` of the build args
 		if !xArgs {
 			err := resolveBuildArgs(npmrc, path.Join(npmrc.StoreDir(), esm.Name()), &buildArgs, esm)
 			if err != nil {
@@ -1479,6 +1733,12 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 						if output.err.Error() == "types not found" {
 							return rex.Status(404, "Types Not Found")
 						}
+						if isLicensePolicyError(output.err) {
+							return rex.Status(http.StatusUnavailableForLegalReasons, output.err.Error())
+						}
+						if isAdvisoryBlockedError(output.err) {
+							return rex.Status(403, output.err.Error())
+						}
 						return rex.Status(500, "Failed to build types: "+output.err.Error())
 					}
 				case <-time.After(time.Duration(config.BuildWaitTime) * time.Second):
@@ -1512,6 +1772,23 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			buildArgs.externalRequire = externalRequire
 			buildArgs.keepNames = query.Has("keep-names")
 			buildArgs.ignoreAnnotations = query.Has("ignore-annotations")
+			buildArgs.polyfill = query.Has("polyfill")
+			if query.Has("splitting") {
+				if v := query.Get("splitting"); v == "false" || v == "0" {
+					buildArgs.splitting = "false"
+				} else {
+					buildArgs.splitting = "true"
+				}
+			}
+			if format := query.Get("format"); format != "" && format != "esm" {
+				buildArgs.format = format
+				if format == "iife" {
+					buildArgs.globalName = query.Get("global-name")
+					if buildArgs.globalName == "" {
+						buildArgs.globalName = toGlobalName(esm.PkgName)
+					}
+				}
+			}
 		}
 
 		bundleMode := BundleDefault
@@ -1532,7 +1809,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			a := strings.Split(esm.SubModuleName, "/")
 			if len(a) > 0 {
 				maybeTarget := a[0]
-				if _, ok := targets[maybeTarget]; ok {
+				if isBuildTarget(maybeTarget) {
 					submodule := strings.Join(a[1:], "/")
 					if strings.HasSuffix(submodule, ".bundle") {
 						submodule = strings.TrimSuffix(submodule, ".bundle")
@@ -1549,11 +1826,11 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 					if strings.HasSuffix(submodule, ".css") && !strings.HasSuffix(esm.SubPath, ".mjs") {
 						if submodule == basename+".css" {
 							esm.SubModuleName = ""
-							target = maybeTarget
 						} else {
-							url := fmt.Sprintf("%s/%s", origin, esm.Specifier())
-							return redirect(ctx, url, isExactVersion)
+							// the CSS build of the sub-module
+							esm.SubModuleName = submodule
 						}
+						target = maybeTarget
 					} else {
 						if submodule == basename {
 							submodule = ""
@@ -1568,6 +1845,33 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 		}
 
+		// check the output format
+		if format := buildArgs.format; format != "" {
+			if !outputFormats[format] {
+				return rex.Status(400, "Invalid format")
+			}
+			if format == "iife" {
+				if bundleMode == BundleFalse {
+					return rex.Status(400, "The IIFE format requires bundling")
+				}
+				if externalAll || buildArgs.external.Len() > 0 {
+					return rex.Status(400, "The IIFE format doesn't support external modules")
+				}
+				if !isValidGlobalName(buildArgs.globalName) {
+					return rex.Status(400, "Invalid global name")
+				}
+				bundleMode = BundleDeps
+			} else if buildArgs.globalName != "" {
+				return rex.Status(400, "The global name is only supported by the IIFE format")
+			}
+			if !strings.HasPrefix(target, "es") && !isEngineTarget(target) {
+				if !targetFromUA || pathKind == EsmBuild {
+					return rex.Status(400, "The "+format+" format only supports browser targets")
+				}
+				target = "es2022"
+			}
+		}
+
 		build := &BuildContext{
 			npmrc:       npmrc,
 			logger:      logger,
@@ -1580,6 +1884,26 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			target:      target,
 			dev:         dev,
 		}
+		if explain {
+			resolution, err := build.explainResolution()
+			if err != nil {
+				if isLicensePolicyError(err) {
+					return rex.Status(http.StatusUnavailableForLegalReasons, err.Error())
+				}
+				if isAdvisoryBlockedError(err) {
+					return rex.Status(403, err.Error())
+				}
+				if strings.HasSuffix(err.Error(), " not found") {
+					return rex.Status(404, err.Error())
+				}
+				return rex.Status(500, err.Error())
+			}
+			if targetFromUA {
+				appendVaryHeader(ctx.W.Header(), "User-Agent")
+			}
+			ctx.SetHeader("Cache-Control", ccMustRevalidate)
+			return resolution
+		}
 		ret, ok, err := build.Exists()
 		if err != nil {
 			return rex.Status(500, err.Error())
@@ -1590,6 +1914,12 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			case output := <-ch:
 				if output.err != nil {
 					msg := output.err.Error()
+					if isLicensePolicyError(output.err) {
+						return rex.Status(http.StatusUnavailableForLegalReasons, msg)
+					}
+					if isAdvisoryBlockedError(output.err) {
+						return rex.Status(403, msg)
+					}
 					if msg == "could not resolve build entry" || strings.HasSuffix(msg, " not found") || strings.Contains(msg, "is not exported from package") || strings.Contains(msg, "no such file or directory") {
 						return rex.Status(404, msg)
 					}
@@ -1602,9 +1932,30 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			}
 		}
 
+		// the license policy may be changed after the module is built
+		if err := checkBuildLicenses(ret.Licenses); err != nil {
+			return rex.Status(http.StatusUnavailableForLegalReasons, err.Error())
+		}
+
+		// check the advisories of the bundled packages
+		for pkg, list := range getBuildAdvisories(ret.Packages) {
+			pkgAdvisories[pkg] = list
+		}
+		if err := checkAdvisories(ctx.W.Header(), pkgAdvisories); err != nil {
+			return rex.Status(403, err.Error())
+		}
+		reportInstalledAdvisories(ctx.W.Header(), pkgAdvisories, ret.Installed)
+
 		if ret.CSSEntry != "" {
-			url := strings.Join([]string{origin, esm.Name(), ret.CSSEntry[2:]}, "/")
-			return redirect(ctx, url, isExactVersion)
+			// redirect to the bundled CSS
+			if ret.CSSInJS {
+				if !strings.HasSuffix(esm.SubPath, ".css") {
+					return redirect(ctx, origin+build.getCSSPath(), isExactVersion)
+				}
+			} else {
+				url := strings.Join([]string{origin, esm.Name(), ret.CSSEntry[2:]}, "/")
+				return redirect(ctx, url, isExactVersion)
+			}
 		}
 
 		// redirect to `*.d.ts` file
@@ -1624,13 +1975,17 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 			if !ret.CSSInJS {
 				return rex.Status(404, "Package CSS not found")
 			}
-			url := origin + strings.TrimSuffix(build.Path(), ".mjs") + ".css"
-			return redirect(ctx, url, isExactVersion)
+			return redirect(ctx, origin+build.getCSSPath(), isExactVersion)
+		}
+
+		// redirect to the build path for the non-ESM formats
+		if buildArgs.format != "" && pathKind != EsmBuild {
+			return redirect(ctx, origin+build.Path(), isExactVersion)
 		}
 
 		// check `?exports` query
 		jsIdentSet := set.New[string]()
-		if query.Has("exports") {
+		if query.Has("exports") && buildArgs.format == "" {
 			for _, p := range strings.Split(query.Get("exports"), ",") {
 				p = strings.TrimSpace(p)
 				if isJsIdentifier(p) {
@@ -1655,9 +2010,11 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				return buf.Bytes()
 			}
 			savePath := build.getSavepath()
-			if strings.HasSuffix(esm.SubPath, ".css") && ret.CSSInJS {
-				path, _ := utils.SplitByLastByte(savePath, '.')
-				savePath = path + ".css"
+			if strings.HasSuffix(esm.SubPath, ".css") {
+				if !ret.CSSInJS {
+					return rex.Status(404, "CSS not found")
+				}
+				savePath = build.getCSSSavepath()
 			}
 			f, fi, err := buildStorage.Get(savePath)
 			if err != nil {
@@ -1680,7 +2037,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				ctx.SetHeader("Content-Type", ctJSON)
 			} else {
 				ctx.SetHeader("Content-Type", ctJavaScript)
-				if query.Has("worker") {
+				if query.Has("worker") && buildArgs.format == "" {
 					defer f.Close()
 					moduleUrl := origin + build.Path()
 					if !ret.CJS && len(exports) > 0 {
@@ -1708,7 +2065,7 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 					if err != nil {
 						return rex.Status(500, err.Error())
 					}
-					ret, err := treeShake(code, exports, targets[target])
+					ret, err := treeShake(code, exports, target)
 					if err != nil {
 						return rex.Status(500, err.Error())
 					}
@@ -1753,12 +2110,15 @@ func esmRouter(db Database, buildStorage storage.Storage, logger *log.Logger) re
 				fmt.Fprintf(buf, "import _ from \"%s\";\n", esm)
 				fmt.Fprintf(buf, "export const { %s } = _;\n", strings.Join(exports, ", "))
 			}
+			exposeHeaders := "X-ESM-Path"
 			if noDts := query.Has("no-dts") || query.Has("no-check"); !noDts && ret.Dts != "" {
 				ctx.SetHeader("X-TypeScript-Types", origin+ret.Dts)
-				ctx.SetHeader("Access-Control-Expose-Headers", "X-ESM-Path, X-TypeScript-Types")
-			} else {
-				ctx.SetHeader("Access-Control-Expose-Headers", "X-ESM-Path")
+				exposeHeaders += ", X-TypeScript-Types"
+			}
+			if len(pkgAdvisories) > 0 {
+				exposeHeaders += ", X-ESM-Advisories"
 			}
+			ctx.SetHeader("Access-Control-Expose-Headers", exposeHeaders)
 		}
 
 		if targetFromUA {
@@ -21,9 +21,11 @@ import (
 // Serve serves the esm.sh server
 func Serve() {
 	var cfile string
+	var warmupFile string
 	var err error
 
 	flag.StringVar(&cfile, "config", "config.json", "the config file path")
+	flag.StringVar(&warmupFile, "warmup", "", "the file of the modules to warm up at startup")
 	flag.Parse()
 
 	if existsFile(cfile) {
@@ -37,6 +39,10 @@ func Serve() {
 		}
 	}
 
+	if warmupFile != "" {
+		config.WarmupFile = warmupFile
+	}
+
 	if DEBUG {
 		config.LogLevel = "debug"
 	} else {
@@ -71,9 +77,24 @@ func Serve() {
 	}
 	logger.Debugf("storage initialized, type: %s, endpoint: %s", config.Storage.Type, config.Storage.Endpoint)
 
+	// share npm tarballs across nodes with the build storage
+	if config.NpmTarballCache {
+		npmTarballStorage = buildStorage
+	}
+
+	if isOffline() {
+		logger.Infof("offline mode, packages are served from %s", config.VendorDir)
+	}
+
 	// setup server
 	Setup(logger)
 
+	// remove unused packages from the npm store when the disk is low
+	go startNpmStoreGC(logger)
+
+	// load the advisory database and reload it when it's updated
+	go startAdvisoryDB(logger)
+
 	// pre-compile uno generator in background
 	go generateUnoCSS(&NpmRC{NpmRegistry: NpmRegistry{Registry: "https://registry.npmjs.org/"}}, "", "")
 
@@ -155,8 +176,12 @@ func Setup(logger *log.Logger) {
 }
 
 func cors(allowOrigins []string) rex.Handle {
-	allowList := set.NewReadOnly(allowOrigins...)
+	globalAllowList := set.NewReadOnly(allowOrigins...)
 	return func(ctx *rex.Context) any {
+		allowList := globalAllowList
+		if zone := matchZone(ctx.R); zone != nil && zone.corsAllowOrigins.Len() > 0 {
+			allowList = zone.corsAllowOrigins
+		}
 		origin := ctx.R.Header.Get("Origin")
 		isOptionsMethod := ctx.R.Method == "OPTIONS"
 		h := ctx.W.Header()
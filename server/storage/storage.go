@@ -11,11 +11,12 @@ var (
 )
 
 type StorageOptions struct {
-	Type            string `json:"type"`
-	Endpoint        string `json:"endpoint"`
-	Region          string `json:"region"`
-	AccessKeyID     string `json:"accessKeyID"`
-	SecretAccessKey string `json:"secretAccessKey"`
+	Type            string             `json:"type"`
+	Endpoint        string             `json:"endpoint"`
+	Region          string             `json:"region"`
+	AccessKeyID     string             `json:"accessKeyID"`
+	SecretAccessKey string             `json:"secretAccessKey"`
+	Encryption      *EncryptionOptions `json:"encryption"`
 }
 
 type Storage interface {
@@ -32,13 +33,23 @@ type Stat interface {
 	ModTime() time.Time
 }
 
+// rangeReader is implemented by the storages that can read a part of the object without
+// downloading the whole object.
+type rangeReader interface {
+	getRange(key string, offset int64, length int64) (content io.ReadCloser, err error)
+}
+
 func New(options *StorageOptions) (storage Storage, err error) {
 	switch options.Type {
 	case "fs":
-		return NewFSStorage(options)
+		storage, err = NewFSStorage(options)
 	case "s3":
-		return NewS3Storage(options)
+		storage, err = NewS3Storage(options)
 	default:
 		return nil, errors.New("unsupported storage type")
 	}
+	if err == nil && options.Encryption != nil {
+		storage, err = NewEncryptedStorage(storage, options.Encryption)
+	}
+	return
 }
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// the magic header of encrypted objects
+var encryptedMagic = []byte{'E', 'S', 'M', 'X', 1}
+
+// the nonce and tag sizes of AES-GCM
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+type EncryptionOptions struct {
+	// Keys maps key IDs to base64 encoded 256-bit keys.
+	Keys map[string]string `json:"keys"`
+	// KeyFile is a file that contains `id=base64key` lines, merged into `Keys`.
+	KeyFile string `json:"keyFile"`
+	// ActiveKey is the key ID used to encrypt new objects, optional if only one key is provided.
+	ActiveKey string `json:"activeKey"`
+	// Prefixes are the key prefixes to encrypt, all objects are encrypted if it's empty.
+	Prefixes []string `json:"prefixes"`
+}
+
+// NewEncryptedStorage wraps the given storage with envelope encryption (AES-GCM).
+// Every object gets a random data key which is encrypted with the active key, the ID
+// of the active key is stored in the object header so old keys can be rotated out.
+func NewEncryptedStorage(backend Storage, options *EncryptionOptions) (Storage, error) {
+	keys := map[string]cipher.AEAD{}
+	rawKeys := map[string]string{}
+	for id, key := range options.Keys {
+		rawKeys[id] = key
+	}
+	if options.KeyFile != "" {
+		fileKeys, err := readKeyFile(options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		for id, key := range fileKeys {
+			rawKeys[id] = key
+		}
+	}
+	if len(rawKeys) == 0 {
+		return nil, errors.New("missing encryption keys")
+	}
+	for id, key := range rawKeys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key id '%s'", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key '%s': %w", id, err)
+		}
+		keys[id] = aead
+	}
+	activeKey := options.ActiveKey
+	if activeKey == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("missing active encryption key")
+		}
+		for id := range keys {
+			activeKey = id
+		}
+	} else if _, ok := keys[activeKey]; !ok {
+		return nil, fmt.Errorf("active encryption key '%s' not found", activeKey)
+	}
+	return &encryptedStorage{
+		backend:   backend,
+		keys:      keys,
+		activeKey: activeKey,
+		prefixes:  options.Prefixes,
+	}, nil
+}
+
+type encryptedStorage struct {
+	backend   Storage
+	keys      map[string]cipher.AEAD
+	activeKey string
+	prefixes  []string
+}
+
+// encryptedStat implements the Stat interface.
+type encryptedStat struct {
+	Stat
+	size int64
+}
+
+func (s *encryptedStat) Size() int64 {
+	return s.size
+}
+
+// Stat returns the stat of the stored object, the size of an encrypted object is the plaintext size.
+func (es *encryptedStorage) Stat(key string) (stat Stat, err error) {
+	stat, err = es.backend.Stat(key)
+	if err != nil || !es.shouldEncrypt(key) {
+		return
+	}
+	// read the fixed-size header to get the length of the key id
+	var r io.ReadCloser
+	if rr, ok := es.backend.(rangeReader); ok {
+		r, err = rr.getRange(key, 0, int64(len(encryptedMagic)+1))
+	} else {
+		r, _, err = es.backend.Get(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	header := make([]byte, len(encryptedMagic)+1)
+	if _, e := io.ReadFull(r, header); e != nil || !bytes.Equal(header[:len(encryptedMagic)], encryptedMagic) {
+		// objects stored before the encryption was enabled
+		return stat, nil
+	}
+	idLen := int(header[len(encryptedMagic)])
+	// keyNonce | sealedDataKey | dataNonce | gcmTag, see `encrypt`
+	overhead := len(header) + idLen + gcmNonceSize + 32 + gcmTagSize + gcmNonceSize + gcmTagSize
+	return &encryptedStat{stat, stat.Size() - int64(overhead)}, nil
+}
+
+func (es *encryptedStorage) List(prefix string) (keys []string, err error) {
+	return es.backend.List(prefix)
+}
+
+func (es *encryptedStorage) Get(key string) (content io.ReadCloser, stat Stat, err error) {
+	content, stat, err = es.backend.Get(key)
+	if err != nil || !es.shouldEncrypt(key) {
+		return
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	// objects stored before the encryption was enabled
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return io.NopCloser(bytes.NewReader(data)), stat, nil
+	}
+	plaintext, err := es.decrypt(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypt %s: %w", key, err)
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), &encryptedStat{stat, int64(len(plaintext))}, nil
+}
+
+func (es *encryptedStorage) Put(key string, r io.Reader) error {
+	if !es.shouldEncrypt(key) {
+		return es.backend.Put(key, r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := es.encrypt(data)
+	if err != nil {
+		return err
+	}
+	return es.backend.Put(key, bytes.NewReader(ciphertext))
+}
+
+func (es *encryptedStorage) Delete(keys ...string) error {
+	return es.backend.Delete(keys...)
+}
+
+func (es *encryptedStorage) DeleteAll(prefix string) (deletedKeys []string, err error) {
+	return es.backend.DeleteAll(prefix)
+}
+
+func (es *encryptedStorage) shouldEncrypt(key string) bool {
+	if len(es.prefixes) == 0 {
+		return true
+	}
+	key = strings.TrimPrefix(key, "/")
+	for _, prefix := range es.prefixes {
+		if strings.HasPrefix(key, strings.TrimPrefix(prefix, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// encrypt encrypts the data with a random data key, the output format is:
+//
+//	magic(5) | keyIdLen(1) | keyId | keyNonce(12) | sealedDataKey(48) | dataNonce(12) | sealedData
+func (es *encryptedStorage) encrypt(data []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	dataAEAD, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	keyAEAD := es.keys[es.activeKey]
+	keyNonce := make([]byte, keyAEAD.NonceSize())
+	dataNonce := make([]byte, dataAEAD.NonceSize())
+	if _, err = rand.Read(keyNonce); err != nil {
+		return nil, err
+	}
+	if _, err = rand.Read(dataNonce); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+128))
+	buf.Write(encryptedMagic)
+	buf.WriteByte(byte(len(es.activeKey)))
+	buf.WriteString(es.activeKey)
+	buf.Write(keyNonce)
+	buf.Write(keyAEAD.Seal(nil, keyNonce, dataKey, []byte(es.activeKey)))
+	buf.Write(dataNonce)
+	buf.Write(dataAEAD.Seal(nil, dataNonce, data, nil))
+	return buf.Bytes(), nil
+}
+
+func (es *encryptedStorage) decrypt(data []byte) ([]byte, error) {
+	p := data[len(encryptedMagic):]
+	if len(p) < 1 {
+		return nil, errors.New("invalid header")
+	}
+	idLen := int(p[0])
+	p = p[1:]
+	if len(p) < idLen {
+		return nil, errors.New("invalid header")
+	}
+	keyId := string(p[:idLen])
+	p = p[idLen:]
+	keyAEAD, ok := es.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id '%s'", keyId)
+	}
+	keyNonceSize := keyAEAD.NonceSize()
+	sealedKeySize := 32 + keyAEAD.Overhead()
+	if len(p) < keyNonceSize+sealedKeySize {
+		return nil, errors.New("invalid header")
+	}
+	dataKey, err := keyAEAD.Open(nil, p[:keyNonceSize], p[keyNonceSize:keyNonceSize+sealedKeySize], []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	p = p[keyNonceSize+sealedKeySize:]
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	dataAEAD, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) < dataAEAD.NonceSize() {
+		return nil, errors.New("invalid header")
+	}
+	return dataAEAD.Open(nil, p[:dataAEAD.NonceSize()], p[dataAEAD.NonceSize():], nil)
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(rawKey) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readKeyFile reads `id=base64key` lines from the given file, empty lines and lines
+// starting with `#` are ignored.
+func readKeyFile(filename string) (keys map[string]string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read key file: %w", err)
+	}
+	defer f.Close()
+	keys = map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, key, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.New("invalid key file line: " + line)
+		}
+		keys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+	}
+	return keys, scanner.Err()
+}
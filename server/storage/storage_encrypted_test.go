@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	root := path.Join(os.TempDir(), "storage_test_"+rand.Hex.String(8))
+	fs, err := NewFSStorage(&StorageOptions{Type: "fs", Endpoint: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	key1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	key2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+
+	es, err := NewEncryptedStorage(fs, &EncryptionOptions{Keys: map[string]string{"k1": key1}, Prefixes: []string{"zone.example.com/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = es.Put("zone.example.com/modules/foo.mjs", bytes.NewBufferString("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = es.Put("modules/foo.mjs", bytes.NewBufferString("Hello, World!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path.Join(root, "zone.example.com/modules/foo.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("Hello, World!")) {
+		t.Fatal("zone file should be encrypted")
+	}
+	raw, err = os.ReadFile(path.Join(root, "modules/foo.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "Hello, World!" {
+		t.Fatal("non-zone file should not be encrypted")
+	}
+
+	// rotate the key, objects encrypted with the old key must be still readable
+	es, err = NewEncryptedStorage(fs, &EncryptionOptions{Keys: map[string]string{"k1": key1, "k2": key2}, ActiveKey: "k2", Prefixes: []string{"zone.example.com/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = es.Put("zone.example.com/modules/bar.mjs", bytes.NewBufferString("Hello, esm.sh!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"zone.example.com/modules/foo.mjs": "Hello, World!",
+		"zone.example.com/modules/bar.mjs": "Hello, esm.sh!",
+		"modules/foo.mjs":                  "Hello, World!",
+	} {
+		f, fi, err := es.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("invalid file content('%s'), shoud be '%s'", string(data), want)
+		}
+		if fi.Size() != int64(len(want)) {
+			t.Fatalf("invalid file size(%d), shoud be %d", fi.Size(), len(want))
+		}
+		stat, err := es.Stat(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Size() != int64(len(want)) {
+			t.Fatalf("invalid stat size(%d), shoud be %d", stat.Size(), len(want))
+		}
+	}
+
+	// all objects are encrypted without prefixes
+	es, err = NewEncryptedStorage(fs, &EncryptionOptions{Keys: map[string]string{"k1": key1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = es.Put("modules/bar.mjs", bytes.NewBufferString("Hello, esm.sh!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err = os.ReadFile(path.Join(root, "modules/bar.mjs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("Hello, esm.sh!")) {
+		t.Fatal("file should be encrypted without prefixes")
+	}
+	stat, err := es.Stat("modules/bar.mjs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != int64(len("Hello, esm.sh!")) {
+		t.Fatalf("invalid stat size(%d), shoud be %d", stat.Size(), len("Hello, esm.sh!"))
+	}
+
+	// the removed key can't decrypt the objects anymore
+	es, err = NewEncryptedStorage(fs, &EncryptionOptions{Keys: map[string]string{"k2": key2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = es.Get("zone.example.com/modules/foo.mjs")
+	if err == nil {
+		t.Fatal("should fail to decrypt with unknown key")
+	}
+
+	_, err = NewEncryptedStorage(fs, &EncryptionOptions{Keys: map[string]string{"k1": key1, "k2": key2}})
+	if err == nil {
+		t.Fatal("should require the active key")
+	}
+}
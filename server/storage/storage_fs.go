@@ -63,6 +63,18 @@ func (fs *fsStorage) Get(key string) (content io.ReadCloser, stat Stat, err erro
 	return
 }
 
+func (fs *fsStorage) getRange(key string, offset int64, length int64) (content io.ReadCloser, err error) {
+	file, _, err := fs.Get(key)
+	if err != nil {
+		return
+	}
+	f := file.(*os.File)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
 func (fs *fsStorage) Put(key string, content io.Reader) (err error) {
 	filename := filepath.Join(fs.root, key)
 	err = ensureDir(filepath.Dir(filename))
@@ -207,6 +207,40 @@ func (s3 *s3Storage) Get(name string) (content io.ReadCloser, stat Stat, err err
 	}, nil
 }
 
+func (s3 *s3Storage) getRange(name string, offset int64, length int64) (content io.ReadCloser, err error) {
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	req, _ := http.NewRequest("GET", s3.apiEndpoint+"/"+name, nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	s3.sign(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode == 404 {
+		defer resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	// the range is out of the object
+	if resp.StatusCode == 416 {
+		resp.Body.Close()
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, parseS3Error(resp)
+	}
+	if resp.StatusCode != 206 {
+		// the range is not supported, read the requested part only
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, length), resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
 func (s3 *s3Storage) Put(name string, content io.Reader) (err error) {
 	if name == "" {
 		return errors.New("name is required")
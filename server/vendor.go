@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The offline mode is enabled when the `vendorDir` is set, packages and repositories are served
+// from the vendor directory that is produced by the `esmd vendor` command, nothing is fetched from
+// the network. The layout of the vendor directory:
+//
+//	npm/<name>/packument.json            the metadata that only contains the vendored versions
+//	npm/<name>/<version>.tgz             the tarball of the version
+//	git/<host>/<owner>/<repo>/refs.json  the refs of the repository
+//	git/<host>/<owner>/<repo>/<sha>.tar.gz
+func isOffline() bool {
+	return config.VendorDir != ""
+}
+
+// errNotVendored returns the error of the resource that is not vendored in offline mode, the
+// message ends with " not found" so it's handled as a 404 error.
+func errNotVendored(what string) error {
+	return fmt.Errorf("%s (not vendored) not found", what)
+}
+
+func getVendoredPackageDir(vendorDir string, pkgName string) string {
+	return path.Join(vendorDir, "npm", pkgName)
+}
+
+func getVendoredRepoDir(vendorDir string, hostname string, repo string) string {
+	if hostname == "" {
+		hostname = "github.com"
+	}
+	return path.Join(vendorDir, "git", hostname, repo)
+}
+
+// readVendoredPackument reads the metadata of the package from the vendor directory.
+func readVendoredPackument(pkgName string) (data []byte, notFound bool, err error) {
+	if !validatePackageName(pkgName) {
+		return nil, true, nil
+	}
+	data, err = os.ReadFile(path.Join(getVendoredPackageDir(config.VendorDir, pkgName), "packument.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+	return data, false, nil
+}
+
+// getVendoredPackageInfo resolves the version of the package with the vendored metadata.
+func getVendoredPackageInfo(pkgName string, version string) (*PackageJSON, error) {
+	cacheTtl := time.Duration(config.NpmQueryCacheTTL) * time.Second
+	return withCache("vendor:"+pkgName+"@"+version, cacheTtl, func() (*PackageJSON, string, error) {
+		data, notFound, err := readVendoredPackument(pkgName)
+		if err != nil {
+			return nil, "", err
+		}
+		if notFound {
+			return nil, "", errNotVendored(fmt.Sprintf("package '%s'", pkgName))
+		}
+		var metadata NpmPackageMetadata
+		err = json.Unmarshal(data, &metadata)
+		if err != nil {
+			return nil, "", err
+		}
+		raw, ok := metadata.Versions[version]
+		if !ok {
+			raw, ok, err = metadata.resolveVersion(version)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		if !ok {
+			return nil, "", errNotVendored(fmt.Sprintf("version %s of '%s'", version, pkgName))
+		}
+		return raw.ToNpmPackage(), "vendor:" + pkgName + "@" + raw.Version, nil
+	})
+}
+
+// installVendoredTarball extracts the vendored tarball of the package to the `installDir`, the
+// integrity is verified in the same way as the tarballs fetched from the registry.
+func installVendoredTarball(installDir string, pkgName string, pkgVersion string, integrity string) (err error) {
+	f, err := openVendoredTarball(pkgName, pkgVersion)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	verifier := newIntegrityVerifier(integrity)
+	body := io.TeeReader(f, verifier)
+	err = extractPackageTarball(installDir, pkgName, body)
+	if err == nil {
+		_, err = io.Copy(io.Discard, body)
+	}
+	if err == nil && !verifier.Verify() {
+		err = fmt.Errorf("could not install package '%s': %w", path.Base(installDir), errIntegrityMismatch)
+	}
+	if err != nil {
+		os.RemoveAll(installDir)
+	}
+	return
+}
+
+// openVendoredTarball opens the tarball of the package from the vendor directory.
+func openVendoredTarball(pkgName string, pkgVersion string) (*os.File, error) {
+	if !validatePackageName(pkgName) || !isExactVersion(pkgVersion) {
+		return nil, errNotVendored(fmt.Sprintf("tarball of package '%s@%s'", pkgName, pkgVersion))
+	}
+	f, err := os.Open(path.Join(getVendoredPackageDir(config.VendorDir, pkgName), pkgVersion+".tgz"))
+	if err != nil && os.IsNotExist(err) {
+		return nil, errNotVendored(fmt.Sprintf("tarball of package '%s@%s'", pkgName, pkgVersion))
+	}
+	return f, err
+}
+
+// readVendoredRepoRefs reads the refs of the repository from the vendor directory, the `remoteUrl`
+// is the url that is used by `git ls-remote`.
+func readVendoredRepoRefs(remoteUrl string) (refs []GitRef, err error) {
+	u, err := url.Parse(remoteUrl)
+	if err != nil {
+		return nil, err
+	}
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if repo == "" || strings.Contains(repo, "..") {
+		return nil, errNotVendored(fmt.Sprintf("repo '%s'", repo))
+	}
+	data, err := os.ReadFile(path.Join(getVendoredRepoDir(config.VendorDir, u.Hostname(), repo), "refs.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errNotVendored(fmt.Sprintf("repo '%s/%s'", u.Hostname(), repo))
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, &refs)
+	return
+}
+
+// openVendoredRepoTarball opens the tarball of the repository from the vendor directory, the `ref`
+// is a tag, a branch or a commit sha (can be shortened).
+func openVendoredRepoTarball(hostname string, repo string, ref string) (*os.File, error) {
+	dir := getVendoredRepoDir(config.VendorDir, hostname, repo)
+	if strings.Contains(repo, "..") || !existsDir(dir) {
+		return nil, errNotVendored(fmt.Sprintf("repo '%s'", repo))
+	}
+	sha := ref
+	data, err := os.ReadFile(path.Join(dir, "refs.json"))
+	if err == nil {
+		var refs []GitRef
+		if json.Unmarshal(data, &refs) == nil {
+			for _, r := range refs {
+				if r.Ref == "refs/tags/"+ref || r.Ref == "refs/heads/"+ref || (ref == "" && r.Ref == "HEAD") {
+					sha = r.Sha
+					break
+				}
+			}
+		}
+	}
+	if len(sha) >= 7 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), ".tar.gz")
+			if ok && strings.HasPrefix(name, sha) {
+				return os.Open(path.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return nil, errNotVendored(fmt.Sprintf("tag \"%s\" of repo '%s'", ref, repo))
+}
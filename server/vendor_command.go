@@ -0,0 +1,431 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ije/gox/utils"
+)
+
+// Vendor implements the `esmd vendor` command, it downloads the packages and their dependencies
+// to the vendor directory that is used by the offline mode, e.g.
+//
+//	esmd vendor --dir ./vendor react@19 react-dom@19 github:esm-dev/tsx
+func Vendor(args []string) {
+	var cfile string
+	var dir string
+	flags := flag.NewFlagSet("vendor", flag.ExitOnError)
+	flags.StringVar(&cfile, "config", "config.json", "the config file path")
+	flags.StringVar(&dir, "dir", "", "the vendor directory, default is the `vendorDir` of the config or \"vendor\"")
+	flags.Parse(args)
+
+	if existsFile(cfile) {
+		c, err := LoadConfig(cfile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		config = c
+	}
+	if dir == "" {
+		dir = config.VendorDir
+	}
+	if dir == "" {
+		dir = "vendor"
+	}
+	if flags.NArg() == 0 {
+		fmt.Println("Usage: esmd vendor [--config config.json] [--dir vendor] <package|repo>...")
+		os.Exit(1)
+	}
+
+	// the packages are fetched from the network, the jsr packages are vendored from the npm
+	// compatibility registry since the native JSR API is not available in offline mode.
+	config.VendorDir = ""
+	config.JsrNative = false
+
+	v := newVendorer(dir, DefaultNpmRC())
+	for _, spec := range flags.Args() {
+		err := v.Add(spec)
+		if err != nil {
+			fmt.Printf("[error] failed to vendor %s: %v\n", spec, err)
+			os.Exit(1)
+		}
+	}
+	err := v.Save()
+	if err != nil {
+		fmt.Printf("[error] failed to save vendored metadata: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// vendorer downloads the packages and repositories to the vendor directory.
+type vendorer struct {
+	dir        string
+	npmrc      *NpmRC
+	packuments map[string]*vendoredPackument
+	upstreams  map[string]*vendoredPackument
+	seen       map[string]bool
+}
+
+// vendoredPackument is the metadata of the vendored package, the versions are kept as they are
+// served by the registry.
+type vendoredPackument struct {
+	Name     string                     `json:"name"`
+	DistTags map[string]string          `json:"dist-tags"`
+	Versions map[string]json.RawMessage `json:"versions"`
+}
+
+func newVendorer(dir string, npmrc *NpmRC) *vendorer {
+	return &vendorer{
+		dir:        dir,
+		npmrc:      npmrc,
+		packuments: map[string]*vendoredPackument{},
+		upstreams:  map[string]*vendoredPackument{},
+		seen:       map[string]bool{},
+	}
+}
+
+// Add vendors the package or repository by the specifier that is allowed in the `dependencies`
+// of a package.json, e.g. "react@19", "jsr:@std/path@1" or "github:owner/repo#tag".
+func (v *vendorer) Add(spec string) error {
+	if !strings.Contains(spec, ":") {
+		spec = "npm:" + spec
+	}
+	pkg, err := resolveDependencyVersion(spec)
+	if err != nil {
+		return err
+	}
+	return v.addPackage(pkg)
+}
+
+func (v *vendorer) addPackage(pkg Package) error {
+	if pkg.PkgPrNew {
+		return errors.New("pkg.pr.new packages can't be vendored")
+	}
+	if pkg.Github {
+		ref, _ := url.QueryUnescape(pkg.Version)
+		return v.addRepo(pkg.GitHost, pkg.Name, ref)
+	}
+	if _, ok := splitDenoXPackageName(pkg.Name); ok {
+		return errors.New("deno.land/x modules can't be vendored")
+	}
+	if pkg.Version == "" {
+		pkg.Version = "latest"
+	}
+
+	info, err := v.npmrc.getPackageInfo(pkg.Name, pkg.Version)
+	if err != nil {
+		return err
+	}
+	if v.seen[info.Name+"@"+info.Version] {
+		return nil
+	}
+	v.seen[info.Name+"@"+info.Version] = true
+
+	reg := info.registry
+	if reg == nil {
+		reg = v.npmrc.getRegistryByPackageName(info.Name)
+	}
+	upstream, err := v.getUpstreamPackument(reg, info.Name)
+	if err != nil {
+		return err
+	}
+	raw, ok := upstream.Versions[info.Version]
+	if !ok {
+		return fmt.Errorf("version %s of '%s' not found", info.Version, info.Name)
+	}
+
+	pkgDir := getVendoredPackageDir(v.dir, info.Name)
+	err = downloadVendorFile(info.Dist.Tarball, getNpmMetadataHeader(reg, false), info.Dist.toIntegrity(), path.Join(pkgDir, info.Version+".tgz"))
+	if err != nil {
+		return err
+	}
+	packument, err := v.getPackument(info.Name)
+	if err != nil {
+		return err
+	}
+	packument.Versions[info.Version] = raw
+	fmt.Printf("vendored %s@%s\n", info.Name, info.Version)
+
+	deps := map[string]string{}
+	for name, version := range info.PeerDependencies {
+		deps[name] = version
+	}
+	for name, version := range info.Dependencies {
+		deps[name] = version
+	}
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dep := Package{Name: name, Version: deps[name]}
+		if p, err := resolveDependencyVersion(deps[name]); err != nil {
+			continue
+		} else if p.Name != "" {
+			dep = p
+		}
+		err = v.addPackage(dep)
+		if err != nil {
+			_, optional := info.OptionalDependencies[name]
+			_, peer := info.PeerDependencies[name]
+			if optional || peer {
+				// optional and peer dependencies may be unavailable, e.g. platform-specific packages
+				continue
+			}
+			return fmt.Errorf("%s@%s: %w", info.Name, info.Version, err)
+		}
+	}
+	return nil
+}
+
+// addRepo vendors the tarball of the repository at the given ref, the tarball is saved with the
+// commit sha and the refs are saved to resolve tags and branches in offline mode.
+func (v *vendorer) addRepo(hostname string, repo string, ref string) error {
+	gitHost, ok := getGitHost(hostname)
+	if !ok {
+		return fmt.Errorf("git: unknown host \"%s\"", hostname)
+	}
+	refs, err := listRepoRefs(gitHost.RemoteUrl(hostname, repo), gitHost.GitEnv())
+	if err != nil {
+		return err
+	}
+	sha := resolveVendorRepoRef(refs, strings.TrimPrefix(ref, "semver:"))
+	if sha == "" {
+		return fmt.Errorf("tag or branch \"%s\" of repo '%s' not found", ref, repo)
+	}
+	if v.seen[hostname+":"+repo+"@"+sha] {
+		return nil
+	}
+	v.seen[hostname+":"+repo+"@"+sha] = true
+
+	repoDir := getVendoredRepoDir(v.dir, hostname, repo)
+	var header http.Header
+	if gitHost.Token != "" {
+		header = http.Header{}
+		header.Set("Authorization", "Bearer "+gitHost.Token)
+	}
+	tarballPath := path.Join(repoDir, sha+".tar.gz")
+	err = downloadVendorFile(gitHost.ArchiveURL(hostname, repo, sha), header, "", tarballPath)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(repoDir, "refs.json"), data, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("vendored %s@%s\n", repo, sha)
+
+	// vendor the dependencies of the repository
+	f, err := os.Open(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tmpDir, err := os.MkdirTemp("", "esmd-vendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	err = extractPackageTarball(tmpDir, repo, f)
+	if err != nil {
+		return err
+	}
+	var raw PackageJSONRaw
+	if utils.ParseJSONFile(path.Join(tmpDir, "node_modules", repo, "package.json"), &raw) != nil {
+		// not a npm package
+		return nil
+	}
+	p := raw.ToNpmPackage()
+	for name, version := range p.Dependencies {
+		dep := Package{Name: name, Version: version}
+		if d, err := resolveDependencyVersion(version); err != nil {
+			continue
+		} else if d.Name != "" {
+			dep = d
+		}
+		if err = v.addPackage(dep); err != nil {
+			if _, optional := p.OptionalDependencies[name]; !optional {
+				return fmt.Errorf("%s@%s: %w", repo, sha, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the metadata of the vendored packages, the dist tags that point to the versions
+// that are not vendored are removed, and the "latest" tag falls back to the highest vendored version.
+func (v *vendorer) Save() error {
+	for name, packument := range v.packuments {
+		if upstream, ok := v.upstreams[name]; ok {
+			for tag, version := range upstream.DistTags {
+				if _, ok := packument.Versions[version]; ok {
+					packument.DistTags[tag] = version
+				}
+			}
+		}
+		for tag, version := range packument.DistTags {
+			if _, ok := packument.Versions[version]; !ok {
+				delete(packument.DistTags, tag)
+			}
+		}
+		if _, ok := packument.DistTags["latest"]; !ok {
+			var latest *semver.Version
+			for version := range packument.Versions {
+				ver, err := semver.NewVersion(version)
+				if err == nil && ver.Prerelease() == "" && (latest == nil || ver.GreaterThan(latest)) {
+					latest = ver
+				}
+			}
+			if latest != nil {
+				packument.DistTags["latest"] = latest.Original()
+			}
+		}
+		data, err := json.MarshalIndent(packument, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path.Join(getVendoredPackageDir(v.dir, name), "packument.json"), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPackument returns the vendored metadata of the package, the versions that have been vendored
+// before are kept.
+func (v *vendorer) getPackument(pkgName string) (*vendoredPackument, error) {
+	if packument, ok := v.packuments[pkgName]; ok {
+		return packument, nil
+	}
+	packument := &vendoredPackument{}
+	data, err := os.ReadFile(path.Join(getVendoredPackageDir(v.dir, pkgName), "packument.json"))
+	if err == nil {
+		err = json.Unmarshal(data, packument)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vendored metadata of '%s': %v", pkgName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	packument.Name = pkgName
+	if packument.DistTags == nil {
+		packument.DistTags = map[string]string{}
+	}
+	if packument.Versions == nil {
+		packument.Versions = map[string]json.RawMessage{}
+	}
+	v.packuments[pkgName] = packument
+	return packument, nil
+}
+
+// getUpstreamPackument fetches the full metadata of the package from the registry.
+func (v *vendorer) getUpstreamPackument(reg *NpmRegistry, pkgName string) (*vendoredPackument, error) {
+	if packument, ok := v.upstreams[pkgName]; ok {
+		return packument, nil
+	}
+	data, notFound, _, err := fetchNpmMetadataWithFailover(reg, func(reg *NpmRegistry) (string, bool) {
+		return reg.Registry + pkgName, false
+	})
+	if err != nil && !isStaleError(err) {
+		return nil, fmt.Errorf("could not get metadata of package '%s' (%v)", pkgName, err)
+	}
+	if notFound {
+		return nil, fmt.Errorf("package '%s' not found", pkgName)
+	}
+	var packument vendoredPackument
+	err = json.Unmarshal(data, &packument)
+	if err != nil {
+		return nil, err
+	}
+	v.upstreams[pkgName] = &packument
+	return &packument, nil
+}
+
+// resolveVendorRepoRef resolves the ref (a tag, a branch, a semver range or a commit sha) of the
+// repository to the commit sha, an empty ref means the HEAD.
+func resolveVendorRepoRef(refs []GitRef, ref string) string {
+	for _, r := range refs {
+		if (ref == "" && r.Ref == "HEAD") || r.Ref == "refs/tags/"+ref || r.Ref == "refs/heads/"+ref {
+			return r.Sha
+		}
+	}
+	if ref == "" {
+		return ""
+	}
+	if c, err := semver.NewConstraint(ref); err == nil {
+		var latest *semver.Version
+		var sha string
+		for _, r := range refs {
+			if tag, ok := strings.CutPrefix(r.Ref, "refs/tags/"); ok {
+				ver, err := semver.NewVersion(tag)
+				if err == nil && c.Check(ver) && (latest == nil || ver.GreaterThan(latest)) {
+					latest, sha = ver, r.Sha
+				}
+			}
+		}
+		if sha != "" {
+			return sha
+		}
+	}
+	if isCommitish(ref) {
+		return ref
+	}
+	return ""
+}
+
+// downloadVendorFile downloads the file to the `savePath`, the integrity is verified if it's not empty.
+func downloadVendorFile(fileUrl string, header http.Header, integrity string, savePath string) error {
+	if existsFile(savePath) {
+		return nil
+	}
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return err
+	}
+	fetchClient, recycle := NewFetchClient(60, "esmd/"+VERSION, false)
+	defer recycle()
+	res, err := fetchClient.Fetch(u, header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("fetch %s failed: %s", u.Redacted(), res.Status)
+	}
+	err = ensureDir(path.Dir(savePath))
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(path.Dir(savePath), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	verifier := newIntegrityVerifier(integrity)
+	_, err = io.Copy(io.MultiWriter(f, verifier), io.LimitReader(res.Body, maxPackageTarballSize))
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !verifier.Verify() {
+		return fmt.Errorf("%s: %w", u.Redacted(), errIntegrityMismatch)
+	}
+	return os.Rename(f.Name(), savePath)
+}
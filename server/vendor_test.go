@@ -0,0 +1,145 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/crypto/rand"
+)
+
+func TestVendor(t *testing.T) {
+	server := newTestNpmRegistry(t)
+	defer server.Close()
+	server.addPackage(t, "foo", "1.0.0", "", map[string]string{"bar": "^1.0.0"})
+	server.addPackage(t, "foo", "2.0.0", "", nil)
+	server.addPackage(t, "bar", "1.0.0", "", nil)
+	server.addPackage(t, "bar", "1.1.0", "", nil)
+
+	workDir := config.WorkDir
+	defer func() {
+		config.WorkDir = workDir
+		config.VendorDir = ""
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "vendor_test_"+rand.Hex.String(8))
+	defer os.RemoveAll(config.WorkDir)
+
+	vendorDir := path.Join(config.WorkDir, "vendor")
+	v := newVendorer(vendorDir, &NpmRC{NpmRegistry: NpmRegistry{Registry: server.URL + "/"}})
+	err := v.Add("foo@1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existsFile(path.Join(vendorDir, "npm", "foo", "1.0.0.tgz")) || !existsFile(path.Join(vendorDir, "npm", "bar", "1.1.0.tgz")) {
+		t.Fatal("tarballs shoud be vendored")
+	}
+	var packument vendoredPackument
+	data, _ := os.ReadFile(path.Join(vendorDir, "npm", "foo", "packument.json"))
+	json.Unmarshal(data, &packument)
+	if len(packument.Versions) != 1 || packument.DistTags["latest"] != "1.0.0" {
+		t.Fatalf("invalid vendored metadata %s", data)
+	}
+
+	// the registry is not used in offline mode
+	server.Close()
+	config.VendorDir = vendorDir
+	npmrc := &NpmRC{NpmRegistry: NpmRegistry{Registry: "https://registry.example.com/"}}
+
+	for version, expected := range map[string]string{"latest": "1.0.0", "^1.0.0": "1.0.0", "1.0.0": "1.0.0"} {
+		p, err := npmrc.getPackageInfo("foo", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != expected {
+			t.Fatalf("invalid version(%s) of '%s', shoud be '%s'", p.Version, version, expected)
+		}
+	}
+	_, err = npmrc.getPackageInfo("foo", "2")
+	if err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Fatalf("unvendored version shoud be not found, got %v", err)
+	}
+	_, err = npmrc.getPackageInfo("baz", "1")
+	if err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Fatalf("unvendored package shoud be not found, got %v", err)
+	}
+
+	p, err := npmrc.installPackage(Package{Name: "foo", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd := path.Join(config.WorkDir, "wd")
+	ensureDir(path.Join(wd, "node_modules"))
+	npmrc.installDependencies(wd, p, false, nil)
+	data, err = os.ReadFile(path.Join(wd, "node_modules", "bar", "index.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "module.exports = 'bar@1.1.0';\n" {
+		t.Fatalf("invalid installed file %s", data)
+	}
+}
+
+func TestVendoredRepo(t *testing.T) {
+	workDir := config.WorkDir
+	defer func() {
+		config.WorkDir = workDir
+		config.VendorDir = ""
+	}()
+	config.WorkDir = path.Join(os.TempDir(), "vendor_test_"+rand.Hex.String(8))
+	config.VendorDir = path.Join(config.WorkDir, "vendor")
+	defer os.RemoveAll(config.WorkDir)
+
+	sha := "1a2b3c4d5e6f7a8b9c0d1a2b3c4d5e6f7a8b9c0d"
+	repoDir := getVendoredRepoDir(config.VendorDir, "", "owner/repo")
+	ensureDir(repoDir)
+	refs, _ := json.Marshal([]GitRef{{Ref: "HEAD", Sha: sha}, {Ref: "refs/tags/v1.0.0", Sha: sha}})
+	os.WriteFile(path.Join(repoDir, "refs.json"), refs, 0644)
+	os.WriteFile(path.Join(repoDir, sha+".tar.gz"), createTestTarball(t, map[string]string{"mod.ts": "export default 1;\n"}), 0644)
+
+	ret, err := listRepoRefs(githubHost.RemoteUrl("", "owner/repo"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ret) != 2 || ret[1].Sha != sha {
+		t.Fatalf("invalid refs %v", ret)
+	}
+	for _, tag := range []string{"v1.0.0", sha[:7]} {
+		installDir := path.Join(config.WorkDir, "gh", tag)
+		err = ghInstall(installDir, "owner/repo", tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !existsFile(path.Join(installDir, "node_modules", "owner/repo", "mod.ts")) {
+			t.Fatal("repo shoud be installed")
+		}
+	}
+	err = ghInstall(path.Join(config.WorkDir, "gh", "v2"), "owner/repo", "v2.0.0")
+	if err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Fatalf("unvendored tag shoud be not found, got %v", err)
+	}
+}
+
+func createTestTarball(t *testing.T, files map[string]string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: "package/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/esm-dev/esm.sh/server/storage"
+	"github.com/ije/gox/log"
+	"github.com/ije/gox/set"
+)
+
+const (
+	// the max number of the specifiers of a `POST /_warmup` request
+	maxWarmupSpecifiers = 100
+	// the number of the workers that check and enqueue the warm-up builds
+	warmupWorkers = 4
+)
+
+// WarmupOptions defines the body of the `POST /_warmup` API and the warm-up file, e.g.
+//
+//	{
+//	  "targets": ["es2022"],
+//	  "specifiers": ["react@19", { "specifier": "react-dom@19/client", "deps": ["react@19"] }]
+//	}
+type WarmupOptions struct {
+	Targets    []string     `json:"targets"`
+	Specifiers []WarmupSpec `json:"specifiers"`
+}
+
+// WarmupSpec defines a module to warm up with the build args, a plain string is the specifier.
+type WarmupSpec struct {
+	Specifier  string            `json:"specifier"`
+	Targets    []string          `json:"targets"`
+	Alias      map[string]string `json:"alias"`
+	Deps       []string          `json:"deps"`
+	External   []string          `json:"external"`
+	Conditions []string          `json:"conditions"`
+	Bundle     bool              `json:"bundle"`
+	Dev        bool              `json:"dev"`
+}
+
+func (spec *WarmupSpec) UnmarshalJSON(data []byte) error {
+	var specifier string
+	if json.Unmarshal(data, &specifier) == nil {
+		spec.Specifier = specifier
+		return nil
+	}
+	type raw WarmupSpec
+	return json.Unmarshal(data, (*raw)(spec))
+}
+
+// WarmupStatus reports the progress of the warm-up builds.
+type WarmupStatus struct {
+	Queued int64 `json:"queued"`
+	Done   int64 `json:"done"`
+	Failed int64 `json:"failed"`
+}
+
+// buildWarmer enqueues the warm-up builds as low-priority tasks, the imports and types of the builds
+// are warmed up recursively. The builds are processed by a bounded number of workers.
+type buildWarmer struct {
+	queue   *BuildQueue
+	db      Database
+	storage storage.Storage
+	logger  *log.Logger
+	queued  atomic.Int64
+	done    atomic.Int64
+	failed  atomic.Int64
+	lock    sync.Mutex
+	pending *list.List
+	workers int
+}
+
+type warmupTask struct {
+	ctx  *BuildContext
+	seen *sync.Map
+}
+
+func (w *buildWarmer) Status() WarmupStatus {
+	return WarmupStatus{
+		Queued: w.queued.Load(),
+		Done:   w.done.Load(),
+		Failed: w.failed.Load(),
+	}
+}
+
+// Warmup resolves the specifiers and enqueues the builds, it returns the number of the queued
+// entry builds.
+func (w *buildWarmer) Warmup(npmrc *NpmRC, zone *Zone, options WarmupOptions) (n int, err error) {
+	var ctxs []*BuildContext
+	for _, spec := range options.Specifiers {
+		targetList := spec.Targets
+		if len(targetList) == 0 {
+			targetList = options.Targets
+		}
+		if len(targetList) == 0 {
+			targetList = []string{"es2022"}
+		}
+		for _, target := range targetList {
+			target, err := normalizeBuildTarget(target)
+			if err != nil {
+				return 0, err
+			}
+			ctx, err := w.newBuildContext(npmrc, zone, spec, target)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %v", spec.Specifier, err)
+			}
+			ctxs = append(ctxs, ctx)
+		}
+	}
+	seen := &sync.Map{}
+	for _, ctx := range ctxs {
+		w.enqueue(ctx, seen)
+	}
+	return len(ctxs), nil
+}
+
+// WarmupFile warms up the modules of the given file that is in the format of `WarmupOptions`.
+func (w *buildWarmer) WarmupFile(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		w.logger.Errorf("warmup: %v", err)
+		return
+	}
+	var options WarmupOptions
+	err = json.Unmarshal(StripJSONC(data), &options)
+	if err != nil {
+		w.logger.Errorf("warmup: invalid file %s: %v", filename, err)
+		return
+	}
+	n, err := w.Warmup(DefaultNpmRC(), nil, options)
+	if err != nil {
+		w.logger.Errorf("warmup: %v", err)
+		return
+	}
+	w.logger.Infof("warmup: %d builds queued from %s", n, filename)
+}
+
+func (w *buildWarmer) newBuildContext(npmrc *NpmRC, zone *Zone, spec WarmupSpec, target string) (*BuildContext, error) {
+	specifier := strings.TrimPrefix(spec.Specifier, "/")
+	externalAll := strings.HasPrefix(specifier, "*")
+	esm, _, _, _, err := praseEsmPath(npmrc, "/"+strings.TrimPrefix(specifier, "*"))
+	if err != nil {
+		return nil, err
+	}
+	if !w.isPackageAllowed(zone, esm.PkgName) {
+		return nil, errors.New("forbidden")
+	}
+	args := BuildArgs{
+		alias:      map[string]string{},
+		deps:       map[string]string{},
+		conditions: spec.Conditions,
+	}
+	for name, to := range spec.Alias {
+		if name != esm.PkgName {
+			args.alias[name] = to
+		}
+	}
+	for _, v := range spec.Deps {
+		m, _, _, _, err := praseEsmPath(npmrc, "/"+strings.TrimPrefix(v, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid deps: %v", err)
+		}
+		if m.PkgName != esm.PkgName {
+			args.deps[m.PkgName] = m.PkgVersion
+		}
+	}
+	if !externalAll && len(spec.External) > 0 {
+		external := set.New[string]()
+		for _, name := range spec.External {
+			if name == "*" {
+				externalAll = true
+				break
+			}
+			external.Add(name)
+		}
+		if !externalAll {
+			args.external = *external.ReadOnly()
+		}
+	}
+	err = resolveBuildArgs(npmrc, path.Join(npmrc.StoreDir(), esm.Name()), &args, esm)
+	if err != nil {
+		return nil, err
+	}
+	bundleMode := BundleDefault
+	if spec.Bundle {
+		bundleMode = BundleDeps
+	}
+	return &BuildContext{
+		npmrc:       npmrc,
+		logger:      w.logger,
+		db:          w.db,
+		storage:     w.storage,
+		esm:         esm,
+		args:        args,
+		bundleMode:  bundleMode,
+		externalAll: externalAll,
+		target:      target,
+		dev:         spec.Dev,
+	}, nil
+}
+
+func (w *buildWarmer) enqueue(ctx *BuildContext, seen *sync.Map) {
+	if _, loaded := seen.LoadOrStore(ctx.npmrc.zoneId+":"+ctx.Path(), true); loaded {
+		return
+	}
+	w.queued.Add(1)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.pending == nil {
+		w.pending = list.New()
+	}
+	w.pending.PushBack(warmupTask{ctx, seen})
+	if w.workers < warmupWorkers {
+		w.workers++
+		go w.work()
+	}
+}
+
+// work processes the pending warm-up tasks until the list is empty.
+func (w *buildWarmer) work() {
+	for {
+		w.lock.Lock()
+		el := w.pending.Front()
+		if el == nil {
+			w.workers--
+			w.lock.Unlock()
+			return
+		}
+		w.pending.Remove(el)
+		w.lock.Unlock()
+		task := el.Value.(warmupTask)
+		w.warmup(task.ctx, task.seen)
+	}
+}
+
+func (w *buildWarmer) warmup(ctx *BuildContext, seen *sync.Map) {
+	meta, ok, err := ctx.Exists()
+	if err == nil && !ok {
+		output := <-w.queue.AddLowPriority(ctx)
+		meta, err = output.meta, output.err
+	}
+	if err != nil {
+		w.failed.Add(1)
+		w.logger.Warnf("warmup '%s': %v", ctx.Path(), err)
+		return
+	}
+	w.done.Add(1)
+	if ctx.target == "types" || meta == nil {
+		return
+	}
+	deps := meta.Imports
+	if meta.Dts != "" {
+		deps = append(deps[:len(deps):len(deps)], meta.Dts)
+	}
+	for _, dep := range deps {
+		b, err := newBuildContextFromPath(ctx.npmrc, w.logger, w.db, w.storage, dep)
+		if err == nil {
+			w.enqueue(b, seen)
+		}
+	}
+}
+
+func (w *buildWarmer) isPackageAllowed(zone *Zone, pkgName string) bool {
+	if zone != nil {
+		return zone.IsPackageAllowed(pkgName)
+	}
+	return config.AllowList.IsPackageAllowed(pkgName) && !config.BanList.IsPackageBanned(pkgName)
+}
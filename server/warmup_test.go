@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWarmupOptions(t *testing.T) {
+	var options WarmupOptions
+	err := json.Unmarshal([]byte(`{"targets":["es2022"],"specifiers":["react@19.0.0",{"specifier":"react-dom@19.0.0/client","deps":["react@19.0.0"],"dev":true}]}`), &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Specifiers) != 2 || options.Specifiers[0].Specifier != "react@19.0.0" {
+		t.Fatalf("invalid specifiers %v", options.Specifiers)
+	}
+	if spec := options.Specifiers[1]; spec.Specifier != "react-dom@19.0.0/client" || len(spec.Deps) != 1 || !spec.Dev {
+		t.Fatalf("invalid spec %v", spec)
+	}
+}
+
+func TestWarmupBuildPath(t *testing.T) {
+	npmrc := DefaultNpmRC()
+	for _, ctx := range []*BuildContext{
+		{npmrc: npmrc, esm: EsmPath{PkgName: "react", PkgVersion: "19.0.0"}, target: "es2022"},
+		{npmrc: npmrc, esm: EsmPath{PkgName: "react", PkgVersion: "19.0.0", SubPath: "jsx-runtime", SubModuleName: "jsx-runtime"}, target: "esnext", dev: true},
+		{npmrc: npmrc, esm: EsmPath{PkgName: "react-dom", PkgVersion: "19.0.0", SubPath: "client", SubModuleName: "client"}, target: "es2022", bundleMode: BundleDeps, args: BuildArgs{deps: map[string]string{"react": "19.0.0"}}},
+		{npmrc: npmrc, esm: EsmPath{PkgName: "preact", PkgVersion: "10.0.0"}, target: "denonext", externalAll: true},
+	} {
+		b, err := newBuildContextFromPath(npmrc, nil, nil, nil, ctx.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Path() != ctx.Path() {
+			t.Fatalf("invalid build path '%s', shoud be '%s'", b.Path(), ctx.Path())
+		}
+	}
+	b, err := newBuildContextFromPath(npmrc, nil, nil, nil, "/react@19.0.0/index.d.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.target != "types" || b.esm.SubPath != "index.d.ts" {
+		t.Fatal("shoud be a types build")
+	}
+	if _, err = newBuildContextFromPath(npmrc, nil, nil, nil, "/react@19.0.0/index.js"); err == nil {
+		t.Fatal("shoud be invalid build path")
+	}
+}
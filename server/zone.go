@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ije/gox/set"
+	"github.com/ije/gox/valid"
+)
+
+// Zone defines a server-side zone that has its own npm registries, storage prefix and access rules.
+// Requests are routed to the zone by the hostname or the path prefix, so the registry credentials
+// never leave the server.
+type Zone struct {
+	// Id is used as the storage prefix of the zone, default is the hostname.
+	Id                  string                 `json:"id"`
+	Hostname            string                 `json:"hostname"`
+	PathPrefix          string                 `json:"pathPrefix"`
+	Npmrc               string                 `json:"npmrc"`
+	NpmRegistry         string                 `json:"npmRegistry"`
+	NpmToken            string                 `json:"npmToken"`
+	NpmUser             string                 `json:"npmUser"`
+	NpmPassword         string                 `json:"npmPassword"`
+	NpmScopedRegistries map[string]NpmRegistry `json:"npmScopedRegistries"`
+	AllowList           AllowList              `json:"allowList"`
+	BanList             BanList                `json:"banList"`
+	CorsAllowOrigins    []string               `json:"corsAllowOrigins"`
+	npmrc               *NpmRC
+	corsAllowOrigins    *set.ReadOnlySet[string]
+	once                sync.Once
+}
+
+// normalize validates the zone and fills the default values.
+func (z *Zone) normalize() error {
+	if z.Hostname == "" && z.PathPrefix == "" {
+		return errors.New("hostname or pathPrefix is required")
+	}
+	if z.Hostname != "" && !valid.IsDomain(z.Hostname) && !isLocalhost(z.Hostname) {
+		return fmt.Errorf("invalid hostname '%s'", z.Hostname)
+	}
+	if z.PathPrefix != "" {
+		z.PathPrefix = "/" + strings.Trim(z.PathPrefix, "/")
+		if z.PathPrefix == "/" {
+			return errors.New("invalid pathPrefix '/'")
+		}
+	}
+	if z.Id == "" {
+		z.Id = z.Hostname
+	}
+	// zone ids are domain names, e.g. "zone.example.com"
+	if !valid.IsDomain(z.Id) {
+		return fmt.Errorf("invalid zone id '%s'", z.Id)
+	}
+	if z.NpmRegistry != "" {
+		if !isHttpSepcifier(z.NpmRegistry) {
+			return fmt.Errorf("invalid npm registry '%s'", z.NpmRegistry)
+		}
+		z.NpmRegistry = strings.TrimRight(z.NpmRegistry, "/") + "/"
+	}
+	if z.Npmrc != "" {
+		rc, err := NewNpmRcFromFile(z.Npmrc)
+		if err != nil {
+			return fmt.Errorf("failed to load npmrc: %w", err)
+		}
+		if z.NpmRegistry == "" && rc.Registry != "" {
+			z.NpmRegistry = rc.Registry
+		}
+		if z.NpmRegistry == rc.Registry || (rc.Registry == "" && (z.NpmRegistry == "" || z.NpmRegistry == npmRegistry)) {
+			if z.NpmToken == "" {
+				z.NpmToken = rc.Token
+			}
+			if z.NpmUser == "" && z.NpmPassword == "" {
+				z.NpmUser = rc.User
+				z.NpmPassword = rc.Password
+			}
+		}
+		for scope, reg := range rc.ScopedRegistries {
+			if _, ok := z.NpmScopedRegistries[scope]; !ok {
+				if z.NpmScopedRegistries == nil {
+					z.NpmScopedRegistries = map[string]NpmRegistry{}
+				}
+				z.NpmScopedRegistries[scope] = reg
+			}
+		}
+	}
+	// the credentials without registry are used for the default npm registry
+	if z.NpmRegistry == "" && (z.NpmToken != "" || z.NpmUser != "") {
+		z.NpmRegistry = npmRegistry
+	}
+	for scope, reg := range z.NpmScopedRegistries {
+		if !strings.HasPrefix(scope, "@") || !isHttpSepcifier(reg.Registry) {
+			return fmt.Errorf("invalid npm registry for scope %s: %s", scope, reg.Registry)
+		}
+		reg.Registry = strings.TrimRight(reg.Registry, "/") + "/"
+		z.NpmScopedRegistries[scope] = reg
+	}
+	z.corsAllowOrigins = set.NewReadOnly(z.CorsAllowOrigins...)
+	return nil
+}
+
+// NpmRC returns the npmrc of the zone, the registries that are not specified by
+// the zone fall back to the global ones.
+func (z *Zone) NpmRC() *NpmRC {
+	z.once.Do(func() {
+		global := DefaultNpmRC()
+		rc := &NpmRC{
+			NpmRegistry:      global.NpmRegistry,
+			ScopedRegistries: map[string]NpmRegistry{},
+			zoneId:           z.Id,
+		}
+		if z.NpmRegistry != "" {
+			rc.NpmRegistry = NpmRegistry{
+				Registry: z.NpmRegistry,
+				Token:    z.NpmToken,
+				User:     z.NpmUser,
+				Password: z.NpmPassword,
+			}
+		}
+		for scope, reg := range global.ScopedRegistries {
+			rc.ScopedRegistries[scope] = reg
+		}
+		for scope, reg := range z.NpmScopedRegistries {
+			rc.ScopedRegistries[scope] = reg
+		}
+		z.npmrc = rc
+	})
+	return z.npmrc
+}
+
+// IsPackageAllowed checks the package with the allow/ban list of the zone, the global
+// ban list is applied as well.
+func (z *Zone) IsPackageAllowed(pkgName string) bool {
+	allowList := &config.AllowList
+	if len(z.AllowList.Packages) > 0 || len(z.AllowList.Scopes) > 0 {
+		allowList = &z.AllowList
+	}
+	return allowList.IsPackageAllowed(pkgName) && !z.BanList.IsPackageBanned(pkgName) && !config.BanList.IsPackageBanned(pkgName)
+}
+
+// matchZone returns the zone of the request by the hostname or the path prefix.
+func matchZone(r *http.Request) *Zone {
+	if len(config.Zones) == 0 {
+		return nil
+	}
+	hostname := r.Host
+	if h, _, ok := strings.Cut(hostname, ":"); ok {
+		hostname = h
+	}
+	var matched *Zone
+	for _, z := range config.Zones {
+		if z.Hostname != "" && z.Hostname != hostname {
+			continue
+		}
+		if z.PathPrefix != "" && r.URL.Path != z.PathPrefix && !strings.HasPrefix(r.URL.Path, z.PathPrefix+"/") {
+			continue
+		}
+		// prefer the longest path prefix, then the zone with hostname
+		if matched == nil || len(z.PathPrefix) > len(matched.PathPrefix) || (len(z.PathPrefix) == len(matched.PathPrefix) && matched.Hostname == "") {
+			matched = z
+		}
+	}
+	return matched
+}
+
+// isConfiguredZoneId checks if the zone id is used by a server-side zone.
+func isConfiguredZoneId(zoneId string) bool {
+	for _, z := range config.Zones {
+		if z.Id == zoneId {
+			return true
+		}
+	}
+	return false
+}
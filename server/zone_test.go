@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestZone(t *testing.T) {
+	config.Zones = []*Zone{
+		{Hostname: "esm.example.com", NpmRegistry: "https://npm.example.com", NpmToken: "secret"},
+		{Id: "internal.example.com", Hostname: "esm.example.com", PathPrefix: "/internal/"},
+		{Id: "team.example.com", PathPrefix: "team", AllowList: AllowList{Scopes: []AllowScope{{Name: "@team"}}}},
+		{Id: "invalid"},
+	}
+	defer func() { config.Zones = nil }()
+	normalizeConfig(config)
+
+	if len(config.Zones) != 3 {
+		t.Fatalf("invalid zones count(%d), shoud be 3", len(config.Zones))
+	}
+
+	for url, id := range map[string]string{
+		"https://esm.example.com/react":               "esm.example.com",
+		"https://esm.example.com:8080/react":          "esm.example.com",
+		"https://esm.example.com/internal/react":      "internal.example.com",
+		"https://esm.example.com/internalx/react":     "esm.example.com",
+		"https://localhost/team/@team/ui":             "team.example.com",
+		"https://esm.example.com/team/@team/ui":       "team.example.com",
+		"https://localhost/react":                     "",
+		"https://other.example.com/internal/react@19": "",
+	} {
+		zone := matchZone(httptest.NewRequest("GET", url, nil))
+		if id == "" {
+			if zone != nil {
+				t.Fatalf("%s shoud not match any zone, got %s", url, zone.Id)
+			}
+		} else if zone == nil || zone.Id != id {
+			t.Fatalf("%s shoud match zone %s", url, id)
+		}
+	}
+
+	rc := config.Zones[0].NpmRC()
+	if rc.Registry != "https://npm.example.com/" || rc.Token != "secret" || rc.zoneId != "esm.example.com" {
+		t.Fatalf("invalid npmrc of zone: %v", rc)
+	}
+	if _, ok := rc.ScopedRegistries["@jsr"]; !ok {
+		t.Fatal("npmrc of zone shoud inherit the global scoped registries")
+	}
+	if !isConfiguredZoneId("internal.example.com") || isConfiguredZoneId("other.example.com") {
+		t.Fatal("invalid configured zone ids")
+	}
+
+	team := config.Zones[2]
+	if !team.IsPackageAllowed("@team/ui") || team.IsPackageAllowed("react") {
+		t.Fatal("invalid allow list of zone")
+	}
+}